@@ -0,0 +1,269 @@
+// api/handlers/admin.go
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/middlewares/httpcache"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/metrics"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/services"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// AdminHandler handles gateway administration requests
+type AdminHandler struct {
+	discovery     *services.ServiceDiscovery
+	revocations   *services.RevocationStore
+	responseCache *httpcache.ResponseCache
+	metrics       *metrics.Collector
+	logger        *zap.Logger
+}
+
+// NewAdminHandler creates a new administration handler
+func NewAdminHandler(discovery *services.ServiceDiscovery, revocations *services.RevocationStore, responseCache *httpcache.ResponseCache, collector *metrics.Collector, logger *zap.Logger) *AdminHandler {
+	return &AdminHandler{
+		discovery:     discovery,
+		revocations:   revocations,
+		responseCache: responseCache,
+		metrics:       collector,
+		logger:        logger,
+	}
+}
+
+// RevokeRequest represents the token revocation request body. Either a
+// single token (jti) or all tokens of a user issued before a point in time
+// are revoked.
+type RevokeRequest struct {
+	TokenID      string    `json:"jti"`
+	ExpiresAt    time.Time `json:"expires_at"` // Expiry of the token, defaults to the maximum token lifetime
+	UserID       string    `json:"user_id"`
+	IssuedBefore time.Time `json:"issued_before"` // Defaults to now
+}
+
+// HandleRevokeToken revokes access tokens at the gateway
+func (h *AdminHandler) HandleRevokeToken(c *gin.Context) {
+	var req RevokeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondWithBadRequest(c, "Invalid request body", utils.WithError(err))
+		return
+	}
+
+	if (req.TokenID == "") == (req.UserID == "") {
+		utils.RespondWithBadRequest(c, "Exactly one of jti or user_id is required")
+		return
+	}
+
+	var err error
+	if req.TokenID != "" {
+		err = h.revocations.RevokeToken(c.Request.Context(), req.TokenID, req.ExpiresAt)
+	} else {
+		before := req.IssuedBefore
+		if before.IsZero() {
+			before = time.Now()
+		}
+		err = h.revocations.RevokeUserTokens(c.Request.Context(), req.UserID, before)
+	}
+
+	if errors.Is(err, services.ErrRevocationDisabled) {
+		utils.RespondWithError(c, http.StatusNotImplemented, "Token revocation is disabled")
+		return
+	}
+	if err != nil {
+		h.logger.Error("token revocation failed",
+			zap.Error(err),
+			zap.String("admin", c.GetString("userID")),
+		)
+		utils.RespondWithError(c, http.StatusServiceUnavailable, "Token revocation failed")
+		return
+	}
+
+	h.logger.Info("tokens revoked by admin",
+		zap.String("admin", c.GetString("userID")),
+		zap.String("jti", req.TokenID),
+		zap.String("user_id", req.UserID),
+	)
+	c.Status(http.StatusNoContent)
+}
+
+// PurgeRequest represents the cache purge request body. Keys are request
+// URIs such as /api/v1/users/42?fields=name, tags are the values of the
+// Surrogate-Key response header.
+type PurgeRequest struct {
+	Keys []string `json:"keys"`
+	Tags []string `json:"tags"`
+}
+
+// HandlePurgeCache removes responses from the response cache
+func (h *AdminHandler) HandlePurgeCache(c *gin.Context) {
+	var req PurgeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondWithBadRequest(c, "Invalid request body", utils.WithError(err))
+		return
+	}
+
+	if len(req.Keys) == 0 && len(req.Tags) == 0 {
+		utils.RespondWithBadRequest(c, "At least one key or tag is required")
+		return
+	}
+
+	err := h.responseCache.Purge(c.Request.Context(), req.Keys, req.Tags)
+	if errors.Is(err, httpcache.ErrCacheDisabled) {
+		utils.RespondWithError(c, http.StatusNotImplemented, "Response cache is disabled")
+		return
+	}
+	if err != nil {
+		h.logger.Error("cache purge failed",
+			zap.Error(err),
+			zap.String("admin", c.GetString("userID")),
+		)
+		utils.RespondWithError(c, http.StatusServiceUnavailable, "Cache purge failed")
+		return
+	}
+
+	h.logger.Info("cache purged by admin",
+		zap.String("admin", c.GetString("userID")),
+		zap.Strings("keys", req.Keys),
+		zap.Strings("tags", req.Tags),
+	)
+	c.Status(http.StatusNoContent)
+}
+
+// ServiceStatus represents the status of a service and its instances.
+// Durations are in milliseconds.
+type ServiceStatus struct {
+	Name             string           `json:"name"`
+	HealthyInstances int              `json:"healthy_instances"`
+	Requests         float64          `json:"requests"`
+	ClientErrors     float64          `json:"client_errors"`
+	ServerErrors     float64          `json:"server_errors"`
+	SuccessRate      float64          `json:"success_rate"`
+	Instances        []InstanceStatus `json:"instances"`
+}
+
+// InstanceStatus represents the status of a service instance
+type InstanceStatus struct {
+	URL             string    `json:"url"`
+	Status          string    `json:"status"`
+	LastChecked     time.Time `json:"last_checked"`
+	HealthCheckTime float64   `json:"health_check_ms"`
+	ChecksFailed    int64     `json:"checks_failed"`
+	ChecksSucceeded int64     `json:"checks_succeeded"`
+	Latency         Latency   `json:"latency"`
+	Circuit         string    `json:"circuit"`
+	InFlight        int64     `json:"in_flight"`
+	Weight          int       `json:"weight"`
+}
+
+// Latency represents the latency percentiles of recent proxied requests
+type Latency struct {
+	P50     float64 `json:"p50_ms"`
+	P90     float64 `json:"p90_ms"`
+	P99     float64 `json:"p99_ms"`
+	Samples int     `json:"samples"`
+}
+
+// HandleListServices reports the status of every registered service
+func (h *AdminHandler) HandleListServices(c *gin.Context) {
+	statuses := make([]ServiceStatus, 0)
+	for _, name := range h.discovery.ServiceNames() {
+		infos, err := h.discovery.GetService(name)
+		if err != nil {
+			// Deregistered since listing the names
+			continue
+		}
+		statuses = append(statuses, h.serviceStatus(name, infos))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"services": statuses})
+}
+
+// HandleGetService reports the status of a single service
+func (h *AdminHandler) HandleGetService(c *gin.Context) {
+	name := c.Param("name")
+	infos, err := h.discovery.GetService(name)
+	if err != nil {
+		utils.RespondWithError(c, http.StatusNotFound, "Service not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, h.serviceStatus(name, infos))
+}
+
+// HandleCheckService health checks every instance of a service immediately
+// and reports its updated status
+func (h *AdminHandler) HandleCheckService(c *gin.Context) {
+	name := c.Param("name")
+	infos, err := h.discovery.CheckService(name)
+	if err != nil {
+		utils.RespondWithError(c, http.StatusNotFound, "Service not found")
+		return
+	}
+
+	status := h.serviceStatus(name, infos)
+	h.logger.Info("service health checked by admin",
+		zap.String("admin", c.GetString("userID")),
+		zap.String("service", name),
+		zap.Int("healthy_instances", status.HealthyInstances),
+	)
+	c.JSON(http.StatusOK, status)
+}
+
+// serviceStatus builds the status of a service from its instances and the
+// request metrics
+func (h *AdminHandler) serviceStatus(name string, infos []*services.ServiceInfo) ServiceStatus {
+	stats := h.metrics.ServiceStats(name)
+	status := ServiceStatus{
+		Name:         name,
+		Requests:     stats.Requests,
+		ClientErrors: stats.ClientErrors,
+		ServerErrors: stats.ServerErrors,
+		SuccessRate:  stats.SuccessRate(),
+		Instances:    make([]InstanceStatus, 0, len(infos)),
+	}
+
+	for _, info := range infos {
+		if info.Status == services.StatusHealthy {
+			status.HealthyInstances++
+		}
+		status.Instances = append(status.Instances, InstanceStatus{
+			URL:             redactURL(info.URL),
+			Status:          string(info.Status),
+			LastChecked:     info.LastChecked,
+			HealthCheckTime: milliseconds(info.ResponseTime),
+			ChecksFailed:    info.ErrorCount,
+			ChecksSucceeded: info.SuccessCount,
+			Latency: Latency{
+				P50:     milliseconds(info.Latency.P50),
+				P90:     milliseconds(info.Latency.P90),
+				P99:     milliseconds(info.Latency.P99),
+				Samples: info.Latency.Samples,
+			},
+			Circuit:  info.Circuit.String(),
+			InFlight: info.InFlight,
+			Weight:   info.Weight,
+		})
+	}
+
+	return status
+}
+
+// redactURL hides the password of credentials embedded in an instance URL,
+// which may come from a secret reference in the configuration
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
+
+// milliseconds converts d to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
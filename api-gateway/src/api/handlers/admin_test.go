@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/metrics"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/services"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// newTestAdminEngine serves the service status endpoints for an
+// "appointments" service whose instance answers health checks with status
+func newTestAdminEngine(t *testing.T, status *int) (*gin.Engine, *services.ServiceInstance) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(*status)
+	}))
+	t.Cleanup(server.Close)
+
+	discovery := services.NewServiceDiscovery(&config.ServicesConfig{}, metrics.NewCollector(prometheus.NewRegistry()), zap.NewNop())
+	instance := &services.ServiceInstance{
+		Name:      "appointments",
+		BaseURL:   server.URL,
+		HealthURL: "/health",
+		IsHealthy: true,
+	}
+	if err := discovery.Registry().RegisterService("appointments", instance); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewAdminHandler(discovery, nil, nil, metrics.NewCollector(prometheus.NewRegistry()), zap.NewNop())
+	engine := gin.New()
+	engine.GET("/admin/services", h.HandleListServices)
+	engine.GET("/admin/services/:name", h.HandleGetService)
+	engine.POST("/admin/services/:name/check", h.HandleCheckService)
+	return engine, instance
+}
+
+// request sends a request to engine and decodes the JSON response into out
+func request(t *testing.T, engine *gin.Engine, method, path string, out any) int {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	if out != nil && w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("invalid response %q: %v", w.Body, err)
+		}
+	}
+	return w.Code
+}
+
+func TestServiceStatus(t *testing.T) {
+	healthStatus := http.StatusOK
+	engine, instance := newTestAdminEngine(t, &healthStatus)
+	for _, ms := range []int{10, 20, 30, 40, 200} {
+		instance.ObserveLatency(time.Duration(ms) * time.Millisecond)
+	}
+
+	var list struct {
+		Services []ServiceStatus `json:"services"`
+	}
+	if code := request(t, engine, http.MethodGet, "/admin/services", &list); code != http.StatusOK {
+		t.Fatalf("list status = %d, want 200", code)
+	}
+	if len(list.Services) != 1 || len(list.Services[0].Instances) != 1 {
+		t.Fatalf("services = %+v, want one service with one instance", list.Services)
+	}
+
+	got := list.Services[0].Instances[0]
+	if got.Status != string(services.StatusUnknown) || got.Circuit != "closed" {
+		t.Errorf("instance = %+v, want an unchecked instance with a closed circuit", got)
+	}
+	want := Latency{P50: 30, P90: 200, P99: 200, Samples: 5}
+	if got.Latency != want {
+		t.Errorf("latency = %+v, want %+v", got.Latency, want)
+	}
+
+	if code := request(t, engine, http.MethodGet, "/admin/services/billing", nil); code != http.StatusNotFound {
+		t.Errorf("unknown service status = %d, want 404", code)
+	}
+}
+
+func TestCheckService(t *testing.T) {
+	healthStatus := http.StatusServiceUnavailable
+	engine, _ := newTestAdminEngine(t, &healthStatus)
+
+	var status ServiceStatus
+	if code := request(t, engine, http.MethodPost, "/admin/services/appointments/check", &status); code != http.StatusOK {
+		t.Fatalf("check status = %d, want 200", code)
+	}
+	if status.HealthyInstances != 0 || status.Instances[0].ChecksFailed != 1 {
+		t.Errorf("status = %+v, want a failed check", status)
+	}
+
+	healthStatus = http.StatusOK
+	request(t, engine, http.MethodPost, "/admin/services/appointments/check", &status)
+	if status.HealthyInstances != 1 || status.Instances[0].Status != string(services.StatusHealthy) {
+		t.Errorf("status = %+v, want a healthy instance", status)
+	}
+
+	if code := request(t, engine, http.MethodPost, "/admin/services/billing/check", nil); code != http.StatusNotFound {
+		t.Errorf("unknown service status = %d, want 404", code)
+	}
+}
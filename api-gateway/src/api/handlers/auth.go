@@ -1,38 +1,60 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/Mir00r/api-gateway/src/api-gateway/src/utils"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/services"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
 )
 
+// Authentication service endpoints, relative to AuthConfig.IssuerURL
+const (
+	authLoginPath        = "/public/v1/login"
+	authLogoutPath       = "/protected/v1/logout"
+	authRefreshTokenPath = "/protected/v1/refresh-token"
+)
+
 // AuthHandler handles authentication-related requests
 type AuthHandler struct {
-	config     *config.AuthConfig
-	logger     *zap.Logger
-	httpClient *http.Client
+	config      atomic.Pointer[config.AuthConfig]
+	revocations *services.RevocationStore
+	logger      *zap.Logger
+	httpClient  *http.Client
 }
 
 // NewAuthHandler creates a new authentication handler
-func NewAuthHandler(config *config.AuthConfig, logger *zap.Logger) *AuthHandler {
-	return &AuthHandler{
-		config: config,
-		logger: logger,
+func NewAuthHandler(config *config.AuthConfig, revocations *services.RevocationStore, logger *zap.Logger) *AuthHandler {
+	h := &AuthHandler{
+		revocations: revocations,
+		logger:      logger,
 		httpClient: &http.Client{
 			Timeout: 5 * time.Second,
 		},
 	}
+	h.Update(config)
+	return h
+}
+
+// Update atomically replaces the authentication settings
+func (h *AuthHandler) Update(config *config.AuthConfig) {
+	h.config.Store(config)
 }
 
 // LoginRequest represents the login request body
 type LoginRequest struct {
-	Username string `json:"username" binding:"required"`
+	Email    string `json:"email" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
 
@@ -43,6 +65,32 @@ type LoginResponse struct {
 	ExpiresIn    int    `json:"expires_in"`
 }
 
+// authServiceResponse is the response envelope used by the authentication service
+type authServiceResponse struct {
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+	Errors  interface{}     `json:"errors"`
+}
+
+// authTokens holds the tokens issued by the authentication service
+type authTokens struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+// AuthServiceError is returned when the authentication service rejects a request
+type AuthServiceError struct {
+	StatusCode int
+	Message    string
+	Details    interface{}
+}
+
+// Error implements the error interface
+func (e *AuthServiceError) Error() string {
+	return fmt.Sprintf("auth service responded %d: %s", e.StatusCode, e.Message)
+}
+
 // HandleLogin handles user login requests
 func (h *AuthHandler) HandleLogin(c *gin.Context) {
 	var loginReq LoginRequest
@@ -60,9 +108,9 @@ func (h *AuthHandler) HandleLogin(c *gin.Context) {
 	if err != nil {
 		h.logger.Error("login request failed",
 			zap.Error(err),
-			zap.String("username", loginReq.Username),
+			zap.String("email", loginReq.Email),
 		)
-		utils.RespondWithError(c, http.StatusInternalServerError, "Login failed")
+		h.respondWithAuthError(c, err, "Login failed")
 		return
 	}
 
@@ -77,10 +125,28 @@ func (h *AuthHandler) HandleLogout(c *gin.Context) {
 		return
 	}
 
+	refreshToken := c.GetHeader("X-Refresh-Token")
+	if refreshToken == "" {
+		utils.RespondWithError(c, http.StatusBadRequest, "No refresh token provided")
+		return
+	}
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	// Revoke the access token at the gateway first so a failure leaves the
+	// session untouched
+	if err := h.revokeAccessToken(ctx, c); err != nil {
+		h.logger.Error("failed to revoke access token", zap.Error(err))
+		utils.RespondWithError(c, http.StatusServiceUnavailable, "Logout failed")
+		return
+	}
+
 	// Invalidate token (call to auth service)
-	if err := h.invalidateToken(c.Request.Context(), token); err != nil {
+	if err := h.invalidateToken(ctx, token, refreshToken); err != nil {
 		h.logger.Error("logout failed", zap.Error(err))
-		utils.RespondWithError(c, http.StatusInternalServerError, "Logout failed")
+		h.respondWithAuthError(c, err, "Logout failed")
 		return
 	}
 
@@ -100,10 +166,10 @@ func (h *AuthHandler) HandleRefreshToken(c *gin.Context) {
 	defer cancel()
 
 	// Call auth service to refresh token
-	response, err := h.refreshToken(ctx, refreshToken)
+	response, err := h.refreshToken(ctx, c.GetHeader("Authorization"), refreshToken)
 	if err != nil {
 		h.logger.Error("token refresh failed", zap.Error(err))
-		utils.RespondWithError(c, http.StatusInternalServerError, "Token refresh failed")
+		h.respondWithAuthError(c, err, "Token refresh failed")
 		return
 	}
 
@@ -112,21 +178,131 @@ func (h *AuthHandler) HandleRefreshToken(c *gin.Context) {
 
 // forwardLoginRequest forwards the login request to the auth service
 func (h *AuthHandler) forwardLoginRequest(ctx context.Context, req LoginRequest) (*LoginResponse, error) {
-	// Implementation of actual auth service call
-	// This would typically make an HTTP request to your auth service
-	return nil, fmt.Errorf("not implemented")
+	var tokens authTokens
+	if err := h.callAuthService(ctx, authLoginPath, "", req, &tokens); err != nil {
+		return nil, err
+	}
+
+	return h.toLoginResponse(tokens), nil
+}
+
+// revokeAccessToken denylists the access token the request was authenticated
+// with, by jti or by a hash of the token when it has none
+func (h *AuthHandler) revokeAccessToken(ctx context.Context, c *gin.Context) error {
+	if h.revocations == nil {
+		return nil
+	}
+
+	return h.revocations.RevokeToken(ctx, c.GetString("tokenID"), c.GetTime("tokenExpiresAt"))
 }
 
-// invalidateToken invalidates the provided token
-func (h *AuthHandler) invalidateToken(ctx context.Context, token string) error {
-	// Implementation of token invalidation
-	// This would typically make an HTTP request to your auth service
-	return fmt.Errorf("not implemented")
+// invalidateToken revokes the refresh token issued alongside the provided access token
+func (h *AuthHandler) invalidateToken(ctx context.Context, token, refreshToken string) error {
+	body := map[string]string{"refreshToken": refreshToken}
+	return h.callAuthService(ctx, authLogoutPath, token, body, nil)
 }
 
 // refreshToken refreshes the provided token
-func (h *AuthHandler) refreshToken(ctx context.Context, refreshToken string) (*LoginResponse, error) {
-	// Implementation of token refresh
-	// This would typically make an HTTP request to your auth service
-	return nil, fmt.Errorf("not implemented")
+func (h *AuthHandler) refreshToken(ctx context.Context, authorization, refreshToken string) (*LoginResponse, error) {
+	var data struct {
+		Tokens authTokens `json:"tokens"`
+	}
+
+	body := map[string]string{"refreshToken": refreshToken}
+	if err := h.callAuthService(ctx, authRefreshTokenPath, authorization, body, &data); err != nil {
+		return nil, err
+	}
+
+	return h.toLoginResponse(data.Tokens), nil
+}
+
+// callAuthService posts a JSON body to the auth service and decodes the data
+// field of a successful response into out. Rejections are returned as
+// *AuthServiceError.
+func (h *AuthHandler) callAuthService(ctx context.Context, path, authorization string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	url := strings.TrimSuffix(h.config.Load().IssuerURL, "/") + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	if id := utils.RequestIDFromContext(ctx); id != "" {
+		req.Header.Set(utils.RequestIDHeader, id)
+	}
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("auth service request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Error bodies and bodies of calls without output are best effort
+	var envelope authServiceResponse
+	err = json.NewDecoder(resp.Body).Decode(&envelope)
+	if err != nil && resp.StatusCode < http.StatusBadRequest && out != nil {
+		return fmt.Errorf("failed to decode auth service response: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return &AuthServiceError{
+			StatusCode: resp.StatusCode,
+			Message:    envelope.Message,
+			Details:    envelope.Errors,
+		}
+	}
+
+	if out == nil || len(envelope.Data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(envelope.Data, out); err != nil {
+		return fmt.Errorf("failed to decode auth service data: %w", err)
+	}
+	return nil
+}
+
+// toLoginResponse converts issued tokens to the gateway login response
+func (h *AuthHandler) toLoginResponse(tokens authTokens) *LoginResponse {
+	return &LoginResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    h.expiresIn(tokens.AccessToken),
+	}
+}
+
+// expiresIn returns the seconds until an issued access token expires, read
+// from its exp claim. The token was just received from the authentication
+// service, so its signature is not checked here. Tokens without an exp
+// claim fall back to the configured expiry.
+func (h *AuthHandler) expiresIn(token string) int {
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err == nil && claims.ExpiresAt != nil {
+		return max(0, int(time.Until(claims.ExpiresAt.Time).Round(time.Second)/time.Second))
+	}
+	return h.config.Load().TokenExpirySecs
+}
+
+// respondWithAuthError maps an auth service failure to a gateway error response.
+// Client errors are passed through, anything else is reported as a gateway failure.
+func (h *AuthHandler) respondWithAuthError(c *gin.Context, err error, fallback string) {
+	var authErr *AuthServiceError
+	switch {
+	case errors.As(err, &authErr) && authErr.StatusCode < http.StatusInternalServerError:
+		message := authErr.Message
+		if message == "" {
+			message = fallback
+		}
+		utils.RespondWithError(c, authErr.StatusCode, message, utils.WithDetails(authErr.Details))
+	case errors.Is(err, context.DeadlineExceeded):
+		utils.RespondWithError(c, http.StatusGatewayTimeout, fallback)
+	default:
+		utils.RespondWithError(c, http.StatusBadGateway, fallback)
+	}
 }
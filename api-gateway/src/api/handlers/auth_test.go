@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/middlewares/auth"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/services"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/utils"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestAuthHandler creates an AuthHandler backed by a stand-in auth service
+func newTestAuthHandler(t *testing.T, authService http.HandlerFunc) *AuthHandler {
+	t.Helper()
+
+	server := httptest.NewServer(authService)
+	t.Cleanup(server.Close)
+
+	return NewAuthHandler(&config.AuthConfig{
+		IssuerURL:       server.URL + "/api/auth",
+		TokenExpirySecs: 900,
+	}, nil, zap.NewNop())
+}
+
+// serve runs a single request through handler and returns the recorded response
+func serve(handler gin.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	engine := gin.New()
+	engine.Handle(req.Method, req.URL.Path, handler)
+	engine.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func TestHandleLoginSuccess(t *testing.T) {
+	h := newTestAuthHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/auth/public/v1/login" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["email"] != "jane@example.com" || body["password"] != "secret" {
+			t.Errorf("unexpected credentials forwarded: %v", body)
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"status": "success",
+			"data": map[string]interface{}{
+				"user":         map[string]string{"id": "1"},
+				"accessToken":  "access",
+				"refreshToken": "refresh",
+			},
+		})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/login",
+		strings.NewReader(`{"email":"jane@example.com","password":"secret"}`))
+	rec := serve(h.HandleLogin, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	var got LoginResponse
+	json.Unmarshal(rec.Body.Bytes(), &got)
+	want := LoginResponse{Token: "access", RefreshToken: "refresh", ExpiresIn: 900}
+	if got != want {
+		t.Errorf("response = %+v, want %+v", got, want)
+	}
+}
+
+func TestHandleLoginExpiresInFromToken(t *testing.T) {
+	// The authentication service signs access tokens for 15 minutes
+	access, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"id":  "1",
+		"exp": time.Now().Add(15 * time.Minute).Unix(),
+	}).SignedString([]byte("auth-service-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"status": "success",
+			"data":   map[string]string{"accessToken": access, "refreshToken": "refresh"},
+		})
+	}))
+	t.Cleanup(server.Close)
+	h := NewAuthHandler(&config.AuthConfig{
+		IssuerURL:       server.URL + "/api/auth",
+		TokenExpirySecs: 3600,
+	}, nil, zap.NewNop())
+
+	req := httptest.NewRequest(http.MethodPost, "/login",
+		strings.NewReader(`{"email":"jane@example.com","password":"secret"}`))
+	rec := serve(h.HandleLogin, req)
+
+	var got LoginResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ExpiresIn < 899 || got.ExpiresIn > 900 {
+		t.Errorf("expires_in = %d, want the token's remaining 900s, not the configured 3600s", got.ExpiresIn)
+	}
+}
+
+func TestHandleLoginMapsDownstreamErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		wantStatus  int
+		wantMessage string
+		wantDetails bool
+	}{
+		{
+			name:        "invalid credentials",
+			status:      http.StatusUnauthorized,
+			body:        `{"status":"error","message":"Invalid email or password"}`,
+			wantStatus:  http.StatusUnauthorized,
+			wantMessage: "Invalid email or password",
+		},
+		{
+			name:        "validation failure",
+			status:      http.StatusBadRequest,
+			body:        `{"status":"error","message":"Validation failed","errors":[{"field":"email","message":"Invalid email"}]}`,
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "Validation failed",
+			wantDetails: true,
+		},
+		{
+			name:        "server error",
+			status:      http.StatusInternalServerError,
+			body:        `{"status":"error","message":"database down"}`,
+			wantStatus:  http.StatusBadGateway,
+			wantMessage: "Login failed",
+		},
+		{
+			name:        "non-JSON error",
+			status:      http.StatusNotFound,
+			body:        `Not Found`,
+			wantStatus:  http.StatusNotFound,
+			wantMessage: "Login failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestAuthHandler(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/login",
+				strings.NewReader(`{"email":"jane@example.com","password":"wrong"}`))
+			rec := serve(h.HandleLogin, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			var got utils.ErrorResponse
+			json.Unmarshal(rec.Body.Bytes(), &got)
+			if got.Message != tt.wantMessage {
+				t.Errorf("message = %q, want %q", got.Message, tt.wantMessage)
+			}
+			if (got.Details != nil) != tt.wantDetails {
+				t.Errorf("details = %v, want present: %v", got.Details, tt.wantDetails)
+			}
+		})
+	}
+}
+
+func TestHandleLoginRejectsInvalidBody(t *testing.T) {
+	h := newTestAuthHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("auth service must not be called")
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":""}`))
+	rec := serve(h.HandleLogin, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandleLoginAuthServiceUnreachable(t *testing.T) {
+	h := NewAuthHandler(&config.AuthConfig{IssuerURL: "http://127.0.0.1:1"}, nil, zap.NewNop())
+
+	req := httptest.NewRequest(http.MethodPost, "/login",
+		strings.NewReader(`{"email":"jane@example.com","password":"secret"}`))
+	rec := serve(h.HandleLogin, req)
+
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadGateway)
+	}
+}
+
+func TestHandleLogout(t *testing.T) {
+	h := newTestAuthHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/auth/protected/v1/logout" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer access" {
+			t.Errorf("Authorization = %q, want %q", got, "Bearer access")
+		}
+
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["refreshToken"] != "refresh" {
+			t.Errorf("refreshToken = %q, want %q", body["refreshToken"], "refresh")
+		}
+
+		writeJSON(w, http.StatusOK, map[string]string{"status": "success", "message": "Logged out successfully"})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	req.Header.Set("Authorization", "Bearer access")
+	req.Header.Set("X-Refresh-Token", "refresh")
+	rec := serve(h.HandleLogout, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusNoContent, rec.Body)
+	}
+}
+
+func TestHandleLogoutRevokesTokenWithoutJTI(t *testing.T) {
+	authService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+	}))
+	t.Cleanup(authService.Close)
+
+	cfg := &config.AuthConfig{
+		SigningMode: config.SigningModeHMAC,
+		JWTSecret:   "auth-service-secret",
+		IssuerURL:   authService.URL + "/api/auth",
+		Revocation:  config.RevocationConfig{Enabled: true},
+	}
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	revocations := services.NewRevocationStore(client, cfg, zap.NewNop())
+
+	jwtAuth, err := auth.NewJWTAuthMiddleware(context.Background(), cfg, revocations, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewAuthHandler(cfg, revocations, zap.NewNop())
+	engine := gin.New()
+	engine.POST("/logout", jwtAuth.Authenticate(), h.HandleLogout)
+	engine.GET("/profile", jwtAuth.Authenticate(), func(c *gin.Context) {})
+
+	// The authentication service signs {id, email, role} without a jti
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"id":    "42",
+		"email": "jane@example.com",
+		"role":  "PATIENT",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(15 * time.Minute).Unix(),
+	}).SignedString([]byte(cfg.JWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("X-Refresh-Token", "refresh")
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if got := send(http.MethodGet, "/profile"); got != http.StatusOK {
+		t.Fatalf("status before logout = %d, want 200", got)
+	}
+	if got := send(http.MethodPost, "/logout"); got != http.StatusNoContent {
+		t.Fatalf("logout status = %d, want 204", got)
+	}
+	if got := send(http.MethodGet, "/profile"); got != http.StatusUnauthorized {
+		t.Errorf("status after logout = %d, want 401", got)
+	}
+
+	// The entry lives until the token expires
+	key := "revoked:jti:" + services.TokenID("", token)
+	if ttl := mr.TTL(key); ttl <= 14*time.Minute || ttl > 15*time.Minute {
+		t.Errorf("denylist TTL = %s, want the remaining token lifetime", ttl)
+	}
+}
+
+func TestHandleLogoutRequiresRefreshToken(t *testing.T) {
+	h := newTestAuthHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("auth service must not be called")
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	req.Header.Set("Authorization", "Bearer access")
+	rec := serve(h.HandleLogout, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandleRefreshToken(t *testing.T) {
+	h := newTestAuthHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/auth/protected/v1/refresh-token" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["refreshToken"] != "old-refresh" {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"status": "error", "message": "Invalid refresh token"})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"status": "success",
+			"data": map[string]interface{}{
+				"tokens": map[string]string{"accessToken": "new-access", "refreshToken": "new-refresh"},
+			},
+		})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/refresh", nil)
+	req.Header.Set("Authorization", "Bearer access")
+	req.Header.Set("X-Refresh-Token", "old-refresh")
+	rec := serve(h.HandleRefreshToken, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	var got LoginResponse
+	json.Unmarshal(rec.Body.Bytes(), &got)
+	if got.Token != "new-access" || got.RefreshToken != "new-refresh" {
+		t.Errorf("response = %+v", got)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/refresh", nil)
+	req.Header.Set("X-Refresh-Token", "revoked")
+	rec = serve(h.HandleRefreshToken, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
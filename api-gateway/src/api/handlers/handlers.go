@@ -0,0 +1,43 @@
+// api/handlers/handlers.go
+
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/middlewares/httpcache"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/metrics"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/services"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Handlers groups all HTTP handlers exposed by the API Gateway
+type Handlers struct {
+	Auth  *AuthHandler
+	Admin *AdminHandler
+	Proxy *ProxyHandler
+}
+
+// NewHandlers creates all handlers from the application configuration.
+// revocations and responseCache may be nil when token revocation or the
+// response cache are disabled.
+func NewHandlers(cfg *config.Config, discovery *services.ServiceDiscovery, revocations *services.RevocationStore, responseCache *httpcache.ResponseCache, collector *metrics.Collector, logger *zap.Logger) *Handlers {
+	return &Handlers{
+		Auth:  NewAuthHandler(&cfg.Auth, revocations, logger),
+		Admin: NewAdminHandler(discovery, revocations, responseCache, collector, logger),
+		Proxy: NewProxyHandler(discovery.Registry(), &cfg.Services, collector, logger),
+	}
+}
+
+// Update atomically replaces the settings of the handlers
+func (h *Handlers) Update(cfg *config.Config) {
+	h.Auth.Update(&cfg.Auth)
+	h.Proxy.Update(&cfg.Services)
+}
+
+// HealthCheck reports the health of the gateway itself
+func (h *Handlers) HealthCheck(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "UP"})
+}
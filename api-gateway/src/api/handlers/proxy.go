@@ -1,63 +1,93 @@
 package handlers
 
 import (
-	"bytes"
-	_ "context"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	_ "net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/metrics"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/tracing"
 	"github.com/Mir00r/api-gateway/src/api-gateway/src/services"
 	"github.com/Mir00r/api-gateway/src/api-gateway/src/utils"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+// routeContextKey is the gin context key holding the matched route
+const routeContextKey = "proxyRoute"
+
+// ErrorCodePreconditionFailed is the error code of requests rejected by If-Match
+const ErrorCodePreconditionFailed = "precondition_failed"
+
 // ProxyHandler handles proxying requests to backend services
 type ProxyHandler struct {
 	serviceRegistry *services.ServiceRegistry
+	config          atomic.Pointer[config.ServicesConfig]
+	collector       *metrics.Collector
 	logger          *zap.Logger
-	httpClient      *http.Client
 }
 
 // NewProxyHandler creates a new proxy handler
-func NewProxyHandler(serviceRegistry *services.ServiceRegistry, logger *zap.Logger) *ProxyHandler {
-	return &ProxyHandler{
+func NewProxyHandler(serviceRegistry *services.ServiceRegistry, cfg *config.ServicesConfig, collector *metrics.Collector, logger *zap.Logger) *ProxyHandler {
+	h := &ProxyHandler{
 		serviceRegistry: serviceRegistry,
+		collector:       collector,
 		logger:          logger,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+	}
+	h.Update(cfg)
+	return h
+}
+
+// Update atomically replaces the proxy settings
+func (h *ProxyHandler) Update(cfg *config.ServicesConfig) {
+	h.config.Store(cfg)
+}
+
+// ProxyRoute returns a handler that proxies requests matched by a configured route
+func (h *ProxyHandler) ProxyRoute(route config.RouteConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(routeContextKey, route)
+		h.ProxyRequest(c)
 	}
 }
 
 // ProxyRequest handles proxying requests to the appropriate service
 func (h *ProxyHandler) ProxyRequest(c *gin.Context) {
-	// Extract service name from the URL path
-	serviceName, path := h.extractServiceInfo(c.Request.URL.Path)
+	// Resolve target service and path
+	serviceName, path := h.resolveTarget(c)
+	c.Set(metrics.ServiceKey, serviceName)
 
-	// Get service instance from registry
-	service, err := h.serviceRegistry.GetService(serviceName)
-	if err != nil {
-		h.logger.Error("service not found",
+	// Select a healthy service instance from the registry
+	_, span := tracing.Start(c.Request.Context(), "discovery.select",
+		trace.WithAttributes(attribute.String("gateway.service", serviceName)),
+	)
+	service, err := h.serviceRegistry.SelectInstance(serviceName, c.Request.Header)
+	tracing.End(span, err)
+	if errors.Is(err, services.ErrNoHealthyInstances) {
+		h.logger.Warn("service unhealthy",
 			zap.String("service", serviceName),
-			zap.Error(err),
 		)
-		utils.RespondWithError(c, http.StatusNotFound, "Service not found")
+		utils.RespondWithError(c, http.StatusServiceUnavailable, "Service unavailable")
 		return
 	}
-
-	// Check if service is healthy
-	if !service.IsHealthy {
-		h.logger.Warn("service unhealthy",
+	if err != nil {
+		h.logger.Error("service not found",
 			zap.String("service", serviceName),
+			zap.Error(err),
 		)
-		utils.RespondWithError(c, http.StatusServiceUnavailable, "Service unavailable")
+		utils.RespondWithError(c, http.StatusNotFound, "Service not found")
 		return
 	}
+	service.Acquire()
+	defer service.Release()
 
 	// Create target URL
 	targetURL := fmt.Sprintf("%s%s", service.BaseURL, path)
@@ -76,33 +106,249 @@ func (h *ProxyHandler) ProxyRequest(c *gin.Context) {
 		return
 	}
 
-	// Execute proxy request
-	resp, err := h.httpClient.Do(proxyReq)
+	// Evaluate If-Match at the gateway, backends may not implement it
+	if !h.checkIfMatch(c, service, targetURL) {
+		return
+	}
+
+	// Protocol upgrades (e.g. WebSocket) take over the connection
+	if utils.IsUpgradeRequest(c.Request) {
+		done, err := service.Breaker().Allow()
+		if err != nil {
+			h.respondCircuitOpen(c, serviceName, err)
+			return
+		}
+		tracing.Inject(proxyReq.Context(), proxyReq.Header)
+		h.proxyUpgrade(c, serviceName, service, proxyReq, done)
+		return
+	}
+
+	// Execute proxy request with the service's timeouts and retries, the
+	// span lasts until the body is forwarded
+	ctx, span := tracing.Start(proxyReq.Context(), "proxy "+serviceName,
+		trace.WithAttributes(attribute.String("gateway.service", serviceName)),
+	)
+	defer span.End()
+	proxyReq = proxyReq.WithContext(ctx)
+	policy := services.NewRetryPolicy(h.config.Load().Registry[serviceName])
+	start := time.Now()
+	resp, err := policy.Send(proxyReq, service, h.logger)
+	tracing.RecordResponse(span, resp, err)
 	if err != nil {
-		h.logger.Error("proxy request failed",
-			zap.Error(err),
-			zap.String("target", targetURL),
-		)
-		utils.RespondWithError(c, http.StatusBadGateway, "Failed to reach service")
+		h.respondSendError(c, serviceName, targetURL, err)
 		return
 	}
+	service.ObserveLatency(time.Since(start))
 	defer resp.Body.Close()
 
+	// Buffer small responses to GET requests to give them a strong ETag
+	var body []byte
+	buffered := false
+	if c.Request.Method == http.MethodGet && resp.StatusCode == http.StatusOK {
+		limit := services.ETagBufferBytes(h.config.Load().ETagBufferBytes)
+		body, buffered, err = services.BufferResponse(resp, limit)
+		if err != nil {
+			h.logger.Error("failed to read response",
+				zap.Error(err),
+				zap.String("target", targetURL),
+			)
+			utils.RespondWithError(c, http.StatusBadGateway, "Failed to reach service")
+			return
+		}
+		if buffered && resp.Header.Get("ETag") == "" {
+			resp.Header.Set("ETag", utils.StrongETag(body))
+		}
+	}
+
 	// Copy response headers
 	h.copyHeaders(c, resp.Header)
 
-	// Copy response body
-	body, err := io.ReadAll(resp.Body)
+	// Answer conditional requests the backend did not evaluate
+	if resp.StatusCode == http.StatusOK && utils.IsNotModified(c.Request, resp.Header) {
+		c.Writer.Header().Del("Content-Length")
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Status(resp.StatusCode)
+
+	if buffered {
+		if _, err := c.Writer.Write(body); err != nil {
+			h.logger.Warn("failed to write response",
+				zap.Error(err),
+				zap.String("target", targetURL),
+			)
+			c.Abort()
+		}
+		return
+	}
+
+	// Stream response body, the status is already sent so errors can only be logged
+	flushInterval := services.FlushInterval(h.config.Load().FlushIntervalMs)
+	if err := services.StreamResponse(c.Writer, resp, flushInterval); err != nil {
+		h.logger.Warn("response stream interrupted",
+			zap.Error(err),
+			zap.String("target", targetURL),
+		)
+		c.Abort()
+	}
+}
+
+// checkIfMatch evaluates the If-Match header of a state-changing request
+// against the current representation of the target, fetched with a GET, and
+// responds with 412 when it does not match. The request proceeds when the
+// current state cannot be determined, leaving the decision to the backend.
+//
+// The check is best-effort: the target can still change between the GET and
+// the forwarded request, so only backends evaluating the forwarded If-Match
+// themselves guarantee an atomic update. It also costs an extra GET per
+// conditional write.
+func (h *ProxyHandler) checkIfMatch(c *gin.Context, service *services.ServiceInstance, targetURL string) bool {
+	values := c.Request.Header.Values("If-Match")
+	if len(values) == 0 || !isStateChanging(c.Request.Method) {
+		return true
+	}
+
+	etag, err := h.currentETag(c, service, targetURL)
 	if err != nil {
-		h.logger.Error("failed to read response body",
+		h.logger.Warn("failed to evaluate If-Match",
 			zap.Error(err),
 			zap.String("target", targetURL),
 		)
-		utils.RespondWithError(c, http.StatusInternalServerError, "Failed to process response")
+		return true
+	}
+	if utils.ETagMatches(values, etag, true) {
+		return true
+	}
+
+	utils.RespondWithError(c, http.StatusPreconditionFailed, "Precondition failed",
+		utils.WithCode(ErrorCodePreconditionFailed),
+	)
+	return false
+}
+
+// currentETag fetches the entity tag of the target's current representation,
+// empty when it does not exist. Representations without an ETag get the
+// one the gateway would generate for them.
+func (h *ProxyHandler) currentETag(c *gin.Context, service *services.ServiceInstance, targetURL string) (string, error) {
+	policy := services.NewRetryPolicy(h.config.Load().Registry[service.Name])
+	ctx, cancel := context.WithTimeout(c.Request.Context(), policy.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, targetURL, nil)
+	if err != nil {
+		return "", err
+	}
+	h.copyRequestHeaders(req, c.Request)
+	for _, name := range []string{"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since", "Content-Length", "Content-Type"} {
+		req.Header.Del(name)
+	}
+	req.Header.Set("X-Forwarded-For", c.ClientIP())
+	setRequestID(req, c)
+
+	req, span := tracing.StartClient(req, "precondition "+c.Request.Method)
+	defer span.End()
+	resp, err := service.Client().Do(req)
+	tracing.RecordResponse(span, resp, err)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone:
+		return "", nil
+	default:
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		return etag, nil
+	}
+	body, buffered, err := services.BufferResponse(resp, services.ETagBufferBytes(h.config.Load().ETagBufferBytes))
+	if err != nil {
+		return "", err
+	}
+	if !buffered {
+		return "", errors.New("representation too large for an ETag")
+	}
+	return utils.StrongETag(body), nil
+}
+
+// isStateChanging reports whether If-Match is evaluated for a request method
+func isStateChanging(method string) bool {
+	return method == http.MethodPut || method == http.MethodPatch || method == http.MethodDelete
+}
+
+// respondSendError responds to a request that did not get a response from
+// the backend: 503 while the circuit is open, 504 when the service did not
+// respond in time and 502 otherwise
+func (h *ProxyHandler) respondSendError(c *gin.Context, serviceName, targetURL string, err error) {
+	if errors.Is(err, services.ErrCircuitOpen) {
+		h.respondCircuitOpen(c, serviceName, err)
 		return
 	}
 
-	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	var timeoutErr *services.TimeoutError
+	if errors.As(err, &timeoutErr) {
+		h.logger.Warn("proxy request timed out",
+			zap.Error(err),
+			zap.String("target", targetURL),
+		)
+		utils.RespondWithError(c, http.StatusGatewayTimeout, "Service timed out",
+			utils.WithCode(services.ErrorCodeServiceTimeout),
+			utils.WithError(err),
+		)
+		return
+	}
+
+	h.logger.Error("proxy request failed",
+		zap.Error(err),
+		zap.String("target", targetURL),
+	)
+	utils.RespondWithError(c, http.StatusBadGateway, "Failed to reach service")
+}
+
+// respondCircuitOpen responds with 503 and Retry-After for a short-circuited request
+func (h *ProxyHandler) respondCircuitOpen(c *gin.Context, serviceName string, err error) {
+	h.logger.Warn("request short-circuited",
+		zap.String("service", serviceName),
+		zap.Error(err),
+	)
+
+	var circuitErr *services.CircuitOpenError
+	if errors.As(err, &circuitErr) {
+		c.Header("Retry-After", strconv.Itoa(circuitErr.RetryAfterSeconds()))
+	}
+	utils.RespondWithError(c, http.StatusServiceUnavailable, "Service unavailable", utils.WithError(err))
+}
+
+// resolveTarget determines the target service and path for the request,
+// using the matched route when present and the first path segment otherwise
+func (h *ProxyHandler) resolveTarget(c *gin.Context) (string, string) {
+	value, exists := c.Get(routeContextKey)
+	if !exists {
+		return h.extractServiceInfo(c.Request.URL.Path)
+	}
+
+	route := value.(config.RouteConfig)
+	return route.Service, h.rewritePath(route, c.Request.URL.Path)
+}
+
+// rewritePath applies the route's strip-prefix and rewrite rules
+func (h *ProxyHandler) rewritePath(route config.RouteConfig, path string) string {
+	if route.StripPrefix {
+		path = strings.TrimPrefix(path, strings.TrimSuffix(route.PathPrefix, "/"))
+	}
+
+	if route.Rewrite != "" {
+		path = strings.TrimSuffix(route.Rewrite, "/") + path
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
 }
 
 // extractServiceInfo extracts service name and path from the URL
@@ -116,24 +362,24 @@ func (h *ProxyHandler) extractServiceInfo(fullPath string) (string, string) {
 
 // createProxyRequest creates a new HTTP request for proxying
 func (h *ProxyHandler) createProxyRequest(c *gin.Context, targetURL string) (*http.Request, error) {
-	var bodyReader io.Reader
-	if c.Request.Body != nil {
-		body, err := io.ReadAll(c.Request.Body)
-		if err != nil {
-			return nil, err
-		}
-		bodyReader = bytes.NewReader(body)
+	// Small bodies are buffered so they can be replayed, large ones are streamed
+	limit := services.RetryBufferBytes(h.config.Load().RetryBufferBytes)
+	body, getBody, err := services.PrepareBody(c.Request.Body, c.Request.ContentLength, limit)
+	if err != nil {
+		return nil, err
 	}
 
 	proxyReq, err := http.NewRequestWithContext(
 		c.Request.Context(),
 		c.Request.Method,
 		targetURL,
-		bodyReader,
+		body,
 	)
 	if err != nil {
 		return nil, err
 	}
+	proxyReq.ContentLength = c.Request.ContentLength
+	proxyReq.GetBody = getBody
 
 	// Copy headers
 	h.copyRequestHeaders(proxyReq, c.Request)
@@ -141,6 +387,7 @@ func (h *ProxyHandler) createProxyRequest(c *gin.Context, targetURL string) (*ht
 	// Add proxy-specific headers
 	proxyReq.Header.Set("X-Forwarded-For", c.ClientIP())
 	proxyReq.Header.Set("X-Original-URI", c.Request.RequestURI)
+	setRequestID(proxyReq, c)
 
 	return proxyReq, nil
 }
@@ -156,15 +403,24 @@ func (h *ProxyHandler) copyRequestHeaders(dst *http.Request, src *http.Request)
 	}
 }
 
+// setRequestID forwards the ID of the client request, replacing any sent by the client
+func setRequestID(dst *http.Request, c *gin.Context) {
+	if id := c.GetString(utils.RequestIDKey); id != "" {
+		dst.Header.Set(utils.RequestIDHeader, id)
+	} else {
+		dst.Header.Del(utils.RequestIDHeader)
+	}
+}
+
 // copyHeaders copies response headers to the client response
 func (h *ProxyHandler) copyHeaders(c *gin.Context, headers http.Header) {
 	for key, values := range headers {
-		// Skip hop-by-hop headers
-		if utils.IsHopByHopHeader(key) {
+		// Skip hop-by-hop headers, and request IDs echoed by the backend
+		if utils.IsHopByHopHeader(key) || strings.EqualFold(key, utils.RequestIDHeader) {
 			continue
 		}
 		for _, value := range values {
-			c.Header(key, value)
+			c.Writer.Header().Add(key, value)
 		}
 	}
 }
@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/metrics"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/services"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// newTestProxyHandler creates a ProxyHandler forwarding the "appointments"
+// service to a stand-in backend
+func newTestProxyHandler(t *testing.T, backend http.HandlerFunc) *ProxyHandler {
+	t.Helper()
+	return newTestProxyHandlerWithConfig(t, config.ServiceConfig{}, backend)
+}
+
+// newTestProxyHandlerWithConfig is newTestProxyHandler with the timeouts and
+// retries of service
+func newTestProxyHandlerWithConfig(t *testing.T, service config.ServiceConfig, backend http.HandlerFunc) *ProxyHandler {
+	t.Helper()
+
+	server := httptest.NewServer(backend)
+	t.Cleanup(server.Close)
+
+	cfg := &config.ServicesConfig{
+		Registry: map[string]config.ServiceConfig{"appointments": service},
+	}
+	registry := services.NewServiceRegistry(cfg, metrics.NewCollector(prometheus.NewRegistry()), zap.NewNop())
+	if err := registry.RegisterService("appointments", &services.ServiceInstance{
+		Name:      "appointments",
+		BaseURL:   server.URL,
+		IsHealthy: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return NewProxyHandler(registry, cfg, metrics.NewCollector(prometheus.NewRegistry()), zap.NewNop())
+}
+
+// proxy sends a request through h with optional headers as name, value pairs
+func proxy(h *ProxyHandler, method, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/appointments/42", strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	return serve(h.ProxyRequest, req)
+}
+
+func TestProxyGeneratesETag(t *testing.T) {
+	h := newTestProxyHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":42}`))
+	})
+
+	w := proxy(h, http.MethodGet, "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || w.Body.String() != `{"id":42}` {
+		t.Fatalf("response = %d %q, want the backend's", w.Code, w.Body)
+	}
+	if etag != utils.StrongETag([]byte(`{"id":42}`)) {
+		t.Errorf("ETag = %q, want the body's", etag)
+	}
+
+	w = proxy(h, http.MethodGet, "", "If-None-Match", `"other", `+etag)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("response = %d %q, want 304 without body", w.Code, w.Body)
+	}
+	if w.Header().Get("ETag") != etag {
+		t.Errorf("304 ETag = %q, want %q", w.Header().Get("ETag"), etag)
+	}
+
+	w = proxy(h, http.MethodGet, "", "If-None-Match", `"other"`)
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d for a changed representation, want 200", w.Code)
+	}
+}
+
+func TestProxyKeepsBackendValidators(t *testing.T) {
+	h := newTestProxyHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `W/"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2026 15:04:05 GMT")
+		w.Write([]byte("body"))
+	})
+
+	if got := proxy(h, http.MethodGet, "").Header().Get("ETag"); got != `W/"v1"` {
+		t.Errorf("ETag = %q, want the backend's", got)
+	}
+	if w := proxy(h, http.MethodGet, "", "If-None-Match", `"v1"`); w.Code != http.StatusNotModified {
+		t.Errorf("status = %d for a weakly matching tag, want 304", w.Code)
+	}
+	if w := proxy(h, http.MethodGet, "", "If-Modified-Since", "Mon, 02 Jan 2026 15:04:05 GMT"); w.Code != http.StatusNotModified {
+		t.Errorf("status = %d for an unmodified representation, want 304", w.Code)
+	}
+	if w := proxy(h, http.MethodGet, "", "If-Modified-Since", "Mon, 02 Jan 2026 15:04:04 GMT"); w.Code != http.StatusOK {
+		t.Errorf("status = %d for a modified representation, want 200", w.Code)
+	}
+}
+
+func TestProxyIfMatch(t *testing.T) {
+	current := `{"id":42,"status":"booked"}`
+	updates := 0
+	h := newTestProxyHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Write([]byte(current))
+		case http.MethodPut:
+			updates++
+			if r.Header.Get("If-Match") == "" {
+				t.Error("If-Match not forwarded")
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	etag := utils.StrongETag([]byte(current))
+
+	if w := proxy(h, http.MethodPut, `{"status":"cancelled"}`, "If-Match", etag); w.Code != http.StatusNoContent {
+		t.Errorf("status = %d for a matching If-Match, want 204", w.Code)
+	}
+
+	w := proxy(h, http.MethodPut, `{"status":"cancelled"}`, "If-Match", `"stale"`)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("status = %d for a stale If-Match, want 412", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), ErrorCodePreconditionFailed) {
+		t.Errorf("body = %q, want the error code", w.Body)
+	}
+	if w := proxy(h, http.MethodPut, `{}`, "If-Match", "W/"+etag); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("status = %d for a weak If-Match, want 412", w.Code)
+	}
+	if updates != 1 {
+		t.Errorf("backend updated %d times, want 1", updates)
+	}
+}
+
+func TestProxyIfMatchMissingResource(t *testing.T) {
+	h := newTestProxyHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	if w := proxy(h, http.MethodDelete, "", "If-Match", "*"); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("status = %d for If-Match * on a missing resource, want 412", w.Code)
+	}
+	if w := proxy(h, http.MethodDelete, ""); w.Code != http.StatusNoContent {
+		t.Errorf("status = %d without If-Match, want 204", w.Code)
+	}
+}
+
+func TestProxyForwardsRequestID(t *testing.T) {
+	var forwarded string
+	h := newTestProxyHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get(utils.RequestIDHeader)
+		w.Header().Set(utils.RequestIDHeader, "backend-id")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/appointments/42", nil)
+	req.Header.Set(utils.RequestIDHeader, "client-id")
+	recorder := httptest.NewRecorder()
+	engine := gin.New()
+	engine.GET("/appointments/42", func(c *gin.Context) {
+		c.Set(utils.RequestIDKey, "gateway-id")
+		c.Header(utils.RequestIDHeader, "gateway-id")
+	}, h.ProxyRequest)
+	engine.ServeHTTP(recorder, req)
+
+	if forwarded != "gateway-id" {
+		t.Errorf("forwarded ID = %q, want the gateway's", forwarded)
+	}
+	if got := recorder.Header().Values(utils.RequestIDHeader); len(got) != 1 || got[0] != "gateway-id" {
+		t.Errorf("response IDs = %q, want only the gateway's", got)
+	}
+}
+
+func TestProxyServiceTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":42}`))
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.ServicesConfig{
+		HealthCheckInterval: 60,
+		Registry: map[string]config.ServiceConfig{
+			"appointments": {
+				BaseURL:     server.URL,
+				HealthCheck: "/health",
+				TLS:         config.ServiceTLSConfig{CAFile: caFile},
+			},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	discovery := services.NewServiceDiscovery(cfg, metrics.NewCollector(prometheus.NewRegistry()), zap.NewNop())
+	if err := discovery.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The health check reaches the backend only if it trusts the CA
+	infos, err := discovery.CheckService("appointments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if infos[0].Status != services.StatusHealthy {
+		t.Fatalf("status = %s, want %s", infos[0].Status, services.StatusHealthy)
+	}
+
+	h := NewProxyHandler(discovery.Registry(), cfg, metrics.NewCollector(prometheus.NewRegistry()), zap.NewNop())
+	w := proxy(h, http.MethodGet, "")
+	if w.Code != http.StatusOK || w.Body.String() != `{"id":42}` {
+		t.Errorf("response = %d %s, want 200 with the backend body", w.Code, w.Body)
+	}
+}
+
+func TestProxyTimeout(t *testing.T) {
+	var attempts atomic.Int32
+	var deadline atomic.Value
+	h := newTestProxyHandlerWithConfig(t, config.ServiceConfig{
+		Timeout:          1,
+		AttemptTimeoutMs: 100,
+		RetryCount:       1,
+		RetryBackoffMs:   10,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		deadline.Store(r.Header.Get(services.DeadlineHeader))
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+
+	w := proxy(h, http.MethodGet, "")
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want 504", w.Code)
+	}
+	var body utils.ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Code != services.ErrorCodeServiceTimeout || body.Error != "service appointments did not respond within 1s" {
+		t.Errorf("body = %+v, want a service timeout", body)
+	}
+	if got := attempts.Load(); got != 2 {
+		t.Errorf("attempts = %d, want 2", got)
+	}
+	if got := deadline.Load(); got != "100" {
+		t.Errorf("%s = %q, want the attempt timeout", services.DeadlineHeader, got)
+	}
+}
+
+func TestProxyRetriesIdempotentRequests(t *testing.T) {
+	var attempts atomic.Int32
+	h := newTestProxyHandlerWithConfig(t, config.ServiceConfig{
+		RetryCount:     2,
+		RetryBackoffMs: 10,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		// Drop the connection of every first attempt
+		if attempts.Add(1)%2 == 1 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Write([]byte(`{"id":42}`))
+	})
+
+	if w := proxy(h, http.MethodGet, ""); w.Code != http.StatusOK {
+		t.Errorf("GET status = %d, want 200 after a retry", w.Code)
+	}
+	if got := attempts.Load(); got != 2 {
+		t.Errorf("GET attempts = %d, want 2", got)
+	}
+
+	attempts.Store(0)
+	if w := proxy(h, http.MethodPost, `{"id":42}`); w.Code != http.StatusBadGateway {
+		t.Errorf("POST status = %d, want 502 without a retry", w.Code)
+	}
+	if got := attempts.Load(); got != 1 {
+		t.Errorf("POST attempts = %d, want 1", got)
+	}
+}
+
+func TestProxyRetriesGatewayErrors(t *testing.T) {
+	var attempts, failures, failStatus atomic.Int32
+	h := newTestProxyHandlerWithConfig(t, config.ServiceConfig{
+		RetryCount:     2,
+		RetryBackoffMs: 10,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) <= failures.Load() {
+			w.WriteHeader(int(failStatus.Load()))
+			w.Write([]byte(`{"error":"upstream"}`))
+			return
+		}
+		w.Write([]byte(`{"id":42}`))
+	})
+
+	tests := []struct {
+		name         string
+		method       string
+		failures     int32
+		failStatus   int
+		wantStatus   int
+		wantAttempts int32
+	}{
+		{name: "recovered", method: http.MethodGet, failures: 1, failStatus: http.StatusServiceUnavailable, wantStatus: http.StatusOK, wantAttempts: 2},
+		{name: "retries exhausted", method: http.MethodGet, failures: 3, failStatus: http.StatusBadGateway, wantStatus: http.StatusBadGateway, wantAttempts: 3},
+		{name: "not a gateway error", method: http.MethodGet, failures: 1, failStatus: http.StatusInternalServerError, wantStatus: http.StatusInternalServerError, wantAttempts: 1},
+		{name: "not idempotent", method: http.MethodPost, failures: 1, failStatus: http.StatusGatewayTimeout, wantStatus: http.StatusGatewayTimeout, wantAttempts: 1},
+	}
+
+	for _, tt := range tests {
+		attempts.Store(0)
+		failures.Store(tt.failures)
+		failStatus.Store(int32(tt.failStatus))
+
+		if w := proxy(h, tt.method, ""); w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.wantStatus)
+		}
+		if got := attempts.Load(); got != tt.wantAttempts {
+			t.Errorf("%s: attempts = %d, want %d", tt.name, got, tt.wantAttempts)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// api/handlers/upgrade.go
+
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/services"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Upgrade proxy timeouts
+const (
+	upgradeDialTimeout        = 10 * time.Second
+	upgradeHandshakeTimeout   = 30 * time.Second
+	defaultUpgradeIdleTimeout = 5 * time.Minute
+	upgradeCopyBufferSize     = 32 << 10
+)
+
+// proxyUpgrade proxies a protocol upgrade handshake (e.g. WebSocket) and then
+// splices the client and backend connections until either side closes or
+// the connection stays idle for too long. done reports the handshake outcome
+// to the circuit breaker.
+func (h *ProxyHandler) proxyUpgrade(c *gin.Context, serviceName string, service *services.ServiceInstance, proxyReq *http.Request, done func(bool)) {
+	protocol := c.Request.Header.Get("Upgrade")
+	proxyReq.Header.Set("Connection", "Upgrade")
+	proxyReq.Header.Set("Upgrade", protocol)
+
+	backendConn, err := h.dialBackend(proxyReq.Context(), service, proxyReq.URL)
+	if err != nil {
+		done(false)
+		h.logger.Error("upgrade dial failed",
+			zap.Error(err),
+			zap.String("service", serviceName),
+		)
+		utils.RespondWithError(c, http.StatusBadGateway, "Failed to reach service")
+		return
+	}
+
+	// Perform the handshake with the backend
+	backendConn.SetDeadline(time.Now().Add(upgradeHandshakeTimeout))
+	backendReader := bufio.NewReader(backendConn)
+
+	var resp *http.Response
+	if err = proxyReq.Write(backendConn); err == nil {
+		resp, err = http.ReadResponse(backendReader, proxyReq)
+	}
+	if err != nil {
+		backendConn.Close()
+		done(false)
+		h.logger.Error("upgrade handshake failed",
+			zap.Error(err),
+			zap.String("service", serviceName),
+		)
+		utils.RespondWithError(c, http.StatusBadGateway, "Failed to reach service")
+		return
+	}
+
+	// Backend declined the upgrade, relay its response as is
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer backendConn.Close()
+		defer resp.Body.Close()
+
+		done(resp.StatusCode < http.StatusInternalServerError)
+		h.copyHeaders(c, resp.Header)
+		c.Status(resp.StatusCode)
+		io.Copy(c.Writer, resp.Body)
+		return
+	}
+
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), protocol) {
+		backendConn.Close()
+		done(false)
+		h.logger.Error("backend switched to unexpected protocol",
+			zap.String("service", serviceName),
+			zap.String("requested", protocol),
+			zap.String("received", resp.Header.Get("Upgrade")),
+		)
+		utils.RespondWithError(c, http.StatusBadGateway, "Unexpected upgrade protocol")
+		return
+	}
+	done(true)
+
+	// Take over the client connection
+	c.Status(http.StatusSwitchingProtocols)
+	clientConn, clientBuf, err := c.Writer.Hijack()
+	if err != nil {
+		backendConn.Close()
+		h.logger.Error("failed to hijack client connection", zap.Error(err))
+		utils.RespondWithInternalError(c, "")
+		return
+	}
+	defer clientConn.Close()
+	defer backendConn.Close()
+
+	// Relay the backend's 101 response to the client
+	fmt.Fprintf(clientBuf, "HTTP/1.1 %s\r\n", resp.Status)
+	resp.Header.Write(clientBuf)
+	clientBuf.WriteString("\r\n")
+	if err := clientBuf.Flush(); err != nil {
+		h.logger.Warn("failed to complete client handshake", zap.Error(err))
+		return
+	}
+
+	h.collector.IncUpgradedConnections(serviceName, protocol)
+	defer h.collector.DecUpgradedConnections(serviceName, protocol)
+
+	h.logger.Debug("upgraded connection opened",
+		zap.String("service", serviceName),
+		zap.String("protocol", protocol),
+	)
+
+	err = h.splice(clientConn, clientBuf.Reader, backendConn, backendReader)
+
+	h.logger.Debug("upgraded connection closed",
+		zap.String("service", serviceName),
+		zap.String("protocol", protocol),
+		zap.Error(err),
+	)
+}
+
+// dialBackend opens a raw connection to the backend for the upgrade, using
+// the TLS settings of the instance's transport for https backends
+func (h *ProxyHandler) dialBackend(ctx context.Context, service *services.ServiceInstance, target *url.URL) (net.Conn, error) {
+	port := target.Port()
+	if port == "" {
+		port = "80"
+		if target.Scheme == "https" {
+			port = "443"
+		}
+	}
+	addr := net.JoinHostPort(target.Hostname(), port)
+
+	ctx, cancel := context.WithTimeout(ctx, upgradeDialTimeout)
+	defer cancel()
+
+	dialer := &net.Dialer{}
+	if target.Scheme == "https" {
+		tlsConfig := &tls.Config{}
+		if base := service.Transport().TLSClientConfig; base != nil {
+			tlsConfig = base.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = target.Hostname()
+		}
+		tlsDialer := &tls.Dialer{
+			NetDialer: dialer,
+			Config:    tlsConfig,
+		}
+		return tlsDialer.DialContext(ctx, "tcp", addr)
+	}
+	return dialer.DialContext(ctx, "tcp", addr)
+}
+
+// splice copies data in both directions until one side closes or both stay
+// idle past the configured timeout. Any activity extends the deadline of
+// both connections.
+func (h *ProxyHandler) splice(client net.Conn, clientReader io.Reader, backend net.Conn, backendReader io.Reader) error {
+	idleTimeout := defaultUpgradeIdleTimeout
+	if secs := h.config.Load().UpgradeIdleTimeoutSecs; secs > 0 {
+		idleTimeout = time.Duration(secs) * time.Second
+	}
+
+	extend := func() {
+		deadline := time.Now().Add(idleTimeout)
+		client.SetDeadline(deadline)
+		backend.SetDeadline(deadline)
+	}
+	extend()
+
+	errc := make(chan error, 2)
+	go func() { errc <- copyWithActivity(backend, clientReader, extend) }()
+	go func() { errc <- copyWithActivity(client, backendReader, extend) }()
+
+	// The first direction to finish ends the session; the caller closes
+	// both connections, which unblocks the other direction
+	return <-errc
+}
+
+// copyWithActivity copies src to dst, calling onActivity for every read
+func copyWithActivity(dst io.Writer, src io.Reader, onActivity func()) error {
+	buf := make([]byte, upgradeCopyBufferSize)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			onActivity()
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
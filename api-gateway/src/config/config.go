@@ -4,15 +4,27 @@ package config
 
 import (
 	"fmt"
+	"strings"
+
 	"github.com/spf13/viper"
 )
 
 // Config holds all configuration for our application
 type Config struct {
-	Server   ServerConfig
-	Services ServicesConfig
-	Auth     AuthConfig
-	Redis    RedisConfig
+	Server     ServerConfig
+	Services   ServicesConfig
+	Auth       AuthConfig
+	Redis      RedisConfig
+	Routes     []RouteConfig
+	Policies   []PolicyConfig
+	RateLimits []RateLimitConfig
+	// Behaviour of the rate limits while Redis is unavailable
+	RateLimitFallback RateLimitFallbackConfig
+	Cache             CacheConfig
+	Tracing           TracingConfig
+
+	references map[string]bool // Paths of settings resolved from file or environment references
+	files      []string        // Files read by file references, sorted
 }
 
 // ServerConfig holds all server-related configuration
@@ -25,25 +37,212 @@ type ServerConfig struct {
 
 // ServicesConfig holds configuration for downstream services
 type ServicesConfig struct {
-	UserService         ServiceConfig
-	NotificationService ServiceConfig
-	AppointmentService  ServiceConfig
-	HealthCheckInterval int // Time in seconds between health checks
+	Registry            map[string]ServiceConfig // Services by the name routes refer to
+	HealthCheckInterval int                      // Time in seconds between health checks
+
+	RetryBufferBytes int64 // Request bodies up to this size are buffered for retries, larger ones are streamed
+	ETagBufferBytes  int64 // Responses up to this size are buffered to compute an ETag, larger ones are streamed
+	FlushIntervalMs  int   // Max delay before streamed response data is flushed, negative flushes every write
+
+	UpgradeIdleTimeoutSecs int // Idle time after which upgraded (WebSocket) connections are closed
 }
 
 // ServiceConfig holds configuration for a single service
 type ServiceConfig struct {
-	BaseURL     string
-	Timeout     int
-	RetryCount  int
-	HealthCheck string
+	BaseURL      string
+	Instances    []InstanceConfig // Service replicas, BaseURL is used when empty
+	LoadBalancer string           // Instance selection strategy, round-robin by default
+	HashHeader   string           // Request header hashed by the consistent-hash strategy
+	Timeout      int              // Seconds to wait for the response headers across all attempts, defaults to 5
+	HealthCheck  string
+
+	AttemptTimeoutMs int // Limit of a single attempt, the remaining time of Timeout when 0
+	RetryCount       int // Retries of failed idempotent requests while time remains
+	RetryBackoffMs   int // Delay before the first retry, doubled for each further retry, defaults to 100
+
+	CircuitBreaker CircuitBreakerConfig
+	TLS            ServiceTLSConfig
+}
+
+// ServiceTLSConfig holds the TLS settings of a service's https endpoints.
+// Zero values use the system roots without a client certificate.
+type ServiceTLSConfig struct {
+	CAFile             string // PEM bundle of the CAs trusted instead of the system roots
+	CertFile           string // Client certificate for mutual TLS
+	KeyFile            string // Key of the client certificate
+	ServerName         string // Name verified in the service's certificate, defaults to the endpoint host
+	InsecureSkipVerify bool   // Skip certificate verification, for development only
+}
+
+// CircuitBreakerConfig holds circuit breaker settings for a service.
+// Zero values fall back to the breaker defaults.
+type CircuitBreakerConfig struct {
+	FailureThreshold    int     // Consecutive failures that open the circuit
+	ErrorRateThreshold  float64 // Failure ratio (0-1) in the window that opens the circuit, disabled when 0
+	MinRequests         int     // Requests required in the window before the error rate applies
+	WindowSecs          int     // Length of the error rate window
+	OpenTimeoutSecs     int     // Time the circuit stays open before probing
+	HalfOpenMaxRequests int     // Successful probes required to close the circuit
+	PerInstance         bool    // Use a breaker per instance instead of per service
+}
+
+// InstanceConfig holds configuration for a single service replica
+type InstanceConfig struct {
+	BaseURL string
+	Weight  int // Relative weight for weighted-round-robin, defaults to 1
+}
+
+// Endpoints returns the configured replicas of the service
+func (sc ServiceConfig) Endpoints() []InstanceConfig {
+	if len(sc.Instances) > 0 {
+		return sc.Instances
+	}
+	if sc.BaseURL == "" {
+		return nil
+	}
+	return []InstanceConfig{{BaseURL: sc.BaseURL, Weight: 1}}
+}
+
+// RouteConfig declares a route proxied to a downstream service
+type RouteConfig struct {
+	PathPrefix   string   // Incoming path prefix, e.g. /api/v1/users
+	Methods      []string // Allowed HTTP methods, all methods when empty
+	Service      string   // Name of the target service in the registry
+	StripPrefix  bool     // Remove PathPrefix before forwarding
+	Rewrite      string   // Prefix prepended to the forwarded path
+	AuthRequired bool     // Require a valid JWT
+	Cache        RouteCacheConfig
+}
+
+// RouteCacheConfig overrides the response cache settings for a route
+type RouteCacheConfig struct {
+	Disabled                 bool // Never cache responses of this route
+	TTLSecs                  int  // Freshness lifetime replacing the backend's, 0 keeps it. Not allowed on authenticated routes.
+	StaleWhileRevalidateSecs int  // Used when the backend does not set stale-while-revalidate
+}
+
+// PolicyConfig declares who may call the authenticated routes matching a
+// path pattern. Patterns match whole segments: "*" or ":name" match one
+// segment and a trailing "**" matches any remainder. Every policy matching
+// a request must allow it.
+type PolicyConfig struct {
+	Path       string   // Path pattern, e.g. /api/v1/users/:id or /api/v1/appointments/**
+	Methods    []string // Methods the policy applies to, all methods when empty
+	Roles      []string // Any of these roles is required
+	Privileges []string // All of these privileges are required
+}
+
+// RateLimitConfig declares a rate limit. Requests within its scope are
+// counted separately for every client of its tier.
+type RateLimitConfig struct {
+	Name       string // Unique name, used in Redis keys and metrics
+	PathPrefix string // Only requests below this prefix, all when empty
+	Service    string // Only requests routed to this service, all when empty
+	Tier       string // all (default), anonymous, user or role:<name>
+	Requests   int    // Requests allowed per period
+	PeriodSecs int    // Defaults to 1
+	Burst      int    // Token bucket capacity, defaults to Requests
+	Algorithm  string // token-bucket (default) or sliding-window
+}
+
+// Rate limit failure modes, applied while Redis is unavailable
+const (
+	RateLimitFailOpen      = "fail-open"      // Admit every request
+	RateLimitFailClosed    = "fail-closed"    // Reject every request
+	RateLimitLocalFallback = "local-fallback" // Count requests in memory, per gateway instance
+)
+
+// RateLimitFallbackConfig controls rate limiting while Redis is unavailable
+type RateLimitFallbackConfig struct {
+	Mode               string // local-fallback (default), fail-open or fail-closed
+	RedisTimeoutMillis int    // Deadline of a single Redis check, none when 0
+	RetryIntervalSecs  int    // How often Redis is probed again while it is failing
+}
+
+// Response cache stores
+const (
+	CacheStoreLocal  = "local"  // In-memory LRU of each gateway instance
+	CacheStoreRedis  = "redis"  // Shared by all gateway instances
+	CacheStoreTiered = "tiered" // Short-lived local copies in front of Redis
+)
+
+// CacheConfig holds the configuration of the response cache for GET requests
+// to proxied routes
+type CacheConfig struct {
+	Enabled                  bool
+	Store                    string // local, redis or tiered (default)
+	LocalEntries             int    // Capacity of the in-memory LRU
+	LocalTTLSecs             int    // Lifetime of local copies in tiered mode, bounding how long purges take to reach every instance
+	MaxBodyBytes             int    // Larger responses are not cached
+	DefaultTTLSecs           int    // Freshness when the backend sets none, responses without one are not cached when 0
+	StaleWhileRevalidateSecs int    // Used when the backend does not set stale-while-revalidate
+}
+
+// Trace exporters
+const (
+	TraceExporterOTLPHTTP = "otlp-http" // OTLP over HTTP/protobuf
+	TraceExporterOTLPGRPC = "otlp-grpc" // OTLP over gRPC
+	TraceExporterStdout   = "stdout"    // Pretty-printed JSON on stdout, for development and tests
+)
+
+// TracingConfig holds the OpenTelemetry tracing configuration. Trace context
+// is propagated to backends even when tracing is disabled.
+type TracingConfig struct {
+	Enabled     bool
+	Exporter    string            // otlp-http (default), otlp-grpc or stdout
+	Endpoint    string            // Collector host:port, defaults to the exporter's standard endpoint
+	Insecure    bool              // Export without TLS
+	Headers     map[string]string // Sent with every export, e.g. collector credentials
+	ServiceName string
+	SampleRatio float64 // Fraction of new traces recorded, sampled parents are always followed
 }
 
+// Token signing modes
+const (
+	SigningModeHMAC       = "hmac"       // Shared JWTSecret
+	SigningModeAsymmetric = "asymmetric" // Public keys from JWKS or a PEM file
+)
+
+// DefaultUserIDClaim is the claim the authentication service puts the user ID in
+const DefaultUserIDClaim = "id"
+
 // AuthConfig holds authentication-related configuration
 type AuthConfig struct {
-	JWTSecret       string
-	TokenExpirySecs int
-	IssuerURL       string
+	JWTSecret                  string
+	TokenExpirySecs            int // Reported expiry of issued tokens without an exp claim
+	IssuerURL                  string
+	SigningMode                string   // hmac or asymmetric, defaults to asymmetric
+	Algorithms                 []string // Accepted asymmetric algorithms, defaults to RS256, ES256 and EdDSA
+	JWKSURL                    string   // Defaults to IssuerURL + /.well-known/jwks.json
+	PublicKeyFile              string   // PEM file with verification keys, used instead of JWKS
+	JWKSRefreshIntervalSecs    int      // Background refresh of the key set
+	JWKSMinRefetchIntervalSecs int      // Minimum delay between refetches triggered by unknown key IDs
+	Issuers                    []string // Accepted iss values, any issuer when empty
+	Audiences                  []string // Accepted aud values, any audience when empty
+	LeewaySecs                 int      // Clock skew tolerated when checking exp, nbf and iat
+	RequiredClaims             []string // Claims every token must carry, defaults to exp
+	UserIDClaim                string   // Claim holding the user ID, defaults to id; sub when absent from a token
+	Revocation                 RevocationConfig
+}
+
+// RevocationConfig holds settings of the token denylist
+type RevocationConfig struct {
+	Enabled      bool
+	CacheSize    int  // Entries of the in-memory cache in front of Redis
+	CacheTTLSecs int  // How long a "not revoked" answer is trusted locally
+	FailClosed   bool // Reject tokens when the denylist cannot be read
+
+	// Longest lifetime of the tokens the issuer signs. Revocations of users
+	// are kept this long, tokens living longer would become valid again.
+	MaxTokenLifetimeSecs int
+}
+
+// JWKSEndpoint returns the URL the verification keys are fetched from
+func (ac AuthConfig) JWKSEndpoint() string {
+	if ac.JWKSURL != "" || ac.IssuerURL == "" {
+		return ac.JWKSURL
+	}
+	return strings.TrimSuffix(ac.IssuerURL, "/") + "/.well-known/jwks.json"
 }
 
 // RedisConfig holds Redis-related configuration
@@ -54,8 +253,18 @@ type RedisConfig struct {
 	DB       int
 }
 
+// defaultServiceTimeoutSecs applies to services without a timeout
+const defaultServiceTimeoutSecs = 5
+
 // LoadConfig loads configuration from files and environment variables
 func LoadConfig(configPath string) (*Config, error) {
+	config, _, err := loadConfig(configPath)
+	return config, err
+}
+
+// loadConfig loads configuration and returns the settings it was decoded
+// from, which include keys the configuration does not declare
+func loadConfig(configPath string) (*Config, map[string]any, error) {
 	v := viper.New()
 
 	// Set default configurations
@@ -69,15 +278,23 @@ func LoadConfig(configPath string) (*Config, error) {
 	v.AutomaticEnv()
 
 	if err := v.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
 	config := &Config{}
 	if err := v.Unmarshal(config); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+		return nil, nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
-	return config, nil
+	// Viper cannot set defaults for map entries
+	for name, service := range config.Services.Registry {
+		if service.Timeout == 0 {
+			service.Timeout = defaultServiceTimeoutSecs
+		}
+		config.Services.Registry[name] = service
+	}
+
+	return config, v.AllSettings(), nil
 }
 
 // setDefaults sets default values for configuration
@@ -87,12 +304,33 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("server.writeTimeoutSecs", 30)
 	v.SetDefault("server.shutdownTimeoutSecs", 30)
 
-	// Service defaults
-	v.SetDefault("services.userService.timeout", 5)
-	v.SetDefault("services.userService.retryCount", 3)
-
 	// Auth defaults
 	v.SetDefault("auth.tokenExpirySecs", 3600)
+	v.SetDefault("auth.signingMode", SigningModeAsymmetric)
+	v.SetDefault("auth.algorithms", []string{"RS256", "ES256", "EdDSA"})
+	v.SetDefault("auth.jwksRefreshIntervalSecs", 300)
+	v.SetDefault("auth.jwksMinRefetchIntervalSecs", 10)
+	v.SetDefault("auth.requiredClaims", []string{"exp"})
+	v.SetDefault("auth.userIDClaim", DefaultUserIDClaim)
+	v.SetDefault("auth.revocation.cacheSize", 10000)
+	v.SetDefault("auth.revocation.cacheTTLSecs", 5)
+	v.SetDefault("auth.revocation.maxTokenLifetimeSecs", 86400)
+
+	// Rate limit defaults
+	v.SetDefault("rateLimitFallback.mode", RateLimitLocalFallback)
+	v.SetDefault("rateLimitFallback.redisTimeoutMillis", 100)
+	v.SetDefault("rateLimitFallback.retryIntervalSecs", 5)
+
+	// Cache defaults
+	v.SetDefault("cache.store", CacheStoreTiered)
+	v.SetDefault("cache.localEntries", 10000)
+	v.SetDefault("cache.localTTLSecs", 10)
+	v.SetDefault("cache.maxBodyBytes", 1<<20)
+
+	// Tracing defaults
+	v.SetDefault("tracing.exporter", TraceExporterOTLPHTTP)
+	v.SetDefault("tracing.serviceName", "api-gateway")
+	v.SetDefault("tracing.sampleRatio", 1.0)
 
 	// Add health check interval default
 	v.SetDefault("services.healthCheckInterval", 30) // Check every 30 seconds by default
@@ -0,0 +1,175 @@
+// config/diff.go
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// redacted replaces the values of secret settings in diffs
+const redacted = "<redacted>"
+
+// unset stands for settings missing on one side of a diff
+const unset = "<unset>"
+
+// secretKeys are the settings whose values are never shown in diffs
+var secretKeys = map[string]bool{
+	"jwtSecret": true,
+	"password":  true,
+	"headers":   true, // Tracing exporter credentials
+}
+
+// Change is a setting whose value differs between two configurations
+type Change struct {
+	Path string // Key path as written in YAML, e.g. routes[0].pathPrefix
+	Old  string
+	New  string
+}
+
+// String formats the change for logs
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Path, c.Old, c.New)
+}
+
+// Diff returns the settings that differ between two configurations, in
+// declaration order. Values of secrets and of settings resolved from file or
+// environment references are redacted.
+func Diff(old, new *Config) []Change {
+	var changes []Change
+	diffValues(&changes, "", reflect.ValueOf(*old), reflect.ValueOf(*new), false)
+
+	for i, change := range changes {
+		if old.fromReference(change.Path) || new.fromReference(change.Path) {
+			changes[i].Old = redact(change.Old)
+			changes[i].New = redact(change.New)
+		}
+	}
+	return changes
+}
+
+// redact hides a formatted value unless it is unset
+func redact(value string) string {
+	if value == unset {
+		return unset
+	}
+	return redacted
+}
+
+// diffValues appends the differences between a and b below path
+func diffValues(changes *[]Change, path string, a, b reflect.Value, secret bool) {
+	switch a.Kind() {
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			field := a.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			key := yamlKey(field.Name)
+			diffValues(changes, joinPath(path, key), a.Field(i), b.Field(i), secret || secretKeys[key])
+		}
+
+	case reflect.Map:
+		keys := make(map[string]reflect.Value)
+		for _, k := range append(a.MapKeys(), b.MapKeys()...) {
+			keys[fmt.Sprint(k.Interface())] = k
+		}
+		names := make([]string, 0, len(keys))
+		for name := range keys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			va, vb := a.MapIndex(keys[name]), b.MapIndex(keys[name])
+			diffElements(changes, joinPath(path, name), va, vb, secret)
+		}
+
+	case reflect.Slice:
+		// Lists of settings are compared entry by entry, lists of plain values as a whole
+		if a.Type().Elem().Kind() != reflect.Struct {
+			diffScalars(changes, path, a, b, secret)
+			return
+		}
+		for i := 0; i < max(a.Len(), b.Len()); i++ {
+			var va, vb reflect.Value
+			if i < a.Len() {
+				va = a.Index(i)
+			}
+			if i < b.Len() {
+				vb = b.Index(i)
+			}
+			diffElements(changes, fmt.Sprintf("%s[%d]", path, i), va, vb, secret)
+		}
+
+	default:
+		diffScalars(changes, path, a, b, secret)
+	}
+}
+
+// diffElements compares map or slice elements, either of which may be missing
+func diffElements(changes *[]Change, path string, a, b reflect.Value, secret bool) {
+	switch {
+	case a.IsValid() && b.IsValid():
+		diffValues(changes, path, a, b, secret)
+	case a.IsValid() || b.IsValid():
+		*changes = append(*changes, Change{
+			Path: path,
+			Old:  formatValue(a, secret),
+			New:  formatValue(b, secret),
+		})
+	}
+}
+
+// diffScalars appends a change if a and b differ
+func diffScalars(changes *[]Change, path string, a, b reflect.Value, secret bool) {
+	if reflect.DeepEqual(a.Interface(), b.Interface()) {
+		return
+	}
+	*changes = append(*changes, Change{
+		Path: path,
+		Old:  formatValue(a, secret),
+		New:  formatValue(b, secret),
+	})
+}
+
+// formatValue formats a setting for a diff
+func formatValue(v reflect.Value, secret bool) string {
+	switch {
+	case !v.IsValid():
+		return unset
+	case secret:
+		return redacted
+	case v.Kind() == reflect.String:
+		return fmt.Sprintf("%q", v.String())
+	default:
+		return fmt.Sprintf("%+v", v.Interface())
+	}
+}
+
+// joinPath appends key to a key path
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// yamlKey returns the camelCase YAML key of a field, e.g. jwtSecret for
+// JWTSecret and baseURL for BaseURL
+func yamlKey(field string) string {
+	runes := []rune(field)
+	upper := 0
+	for upper < len(runes) && unicode.IsUpper(runes[upper]) {
+		upper++
+	}
+
+	// Keep the capital starting the next word of an initialism
+	if upper > 1 && upper < len(runes) {
+		upper--
+	}
+	return strings.ToLower(string(runes[:upper])) + string(runes[upper:])
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestYAMLKey(t *testing.T) {
+	for field, want := range map[string]string{
+		"Port":      "port",
+		"JWTSecret": "jwtSecret",
+		"BaseURL":   "baseURL",
+		"DB":        "db",
+		"TTLSecs":   "ttlSecs",
+	} {
+		if got := yamlKey(field); got != want {
+			t.Errorf("yamlKey(%q) = %q, want %q", field, got, want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := &Config{
+		Server: ServerConfig{Port: 8080},
+		Auth:   AuthConfig{JWTSecret: "old-secret", Issuers: []string{"a"}},
+		Routes: []RouteConfig{
+			{PathPrefix: "/api/v1/users", Service: "user-service"},
+		},
+		Tracing: TracingConfig{Headers: map[string]string{"authorization": "Bearer 1"}},
+	}
+	new := &Config{
+		Server: ServerConfig{Port: 9090},
+		Auth:   AuthConfig{JWTSecret: "new-secret", Issuers: []string{"a", "b"}},
+		Routes: []RouteConfig{
+			{PathPrefix: "/api/v1/users", Service: "user-service", AuthRequired: true},
+			{PathPrefix: "/api/v1/reviews", Service: "review-service"},
+		},
+		Tracing: TracingConfig{Headers: map[string]string{"authorization": "Bearer 2"}},
+	}
+
+	got := Diff(old, new)
+	want := []Change{
+		{Path: "server.port", Old: "8080", New: "9090"},
+		{Path: "auth.jwtSecret", Old: redacted, New: redacted},
+		{Path: "auth.issuers", Old: "[a]", New: "[a b]"},
+		{Path: "routes[0].authRequired", Old: "false", New: "true"},
+		{Path: "routes[1]", Old: unset, New: "{PathPrefix:/api/v1/reviews Methods:[] Service:review-service StripPrefix:false Rewrite: AuthRequired:false Cache:{Disabled:false TTLSecs:0 StaleWhileRevalidateSecs:0}}"},
+		{Path: "tracing.headers.authorization", Old: redacted, New: redacted},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff =\n%v\nwant\n%v", got, want)
+	}
+
+	if changes := Diff(new, new); len(changes) != 0 {
+		t.Errorf("Diff of equal configs = %v, want none", changes)
+	}
+}
@@ -4,8 +4,13 @@ package config
 
 import (
 	"fmt"
+	"maps"
+	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 )
 
 // ConfigLoader handles configuration loading and validation
@@ -21,7 +26,14 @@ func NewConfigLoader(configPath string) *ConfigLoader {
 	}
 }
 
-// Load loads and validates the configuration
+// Validation limits
+const (
+	maxTimeoutSecs       = 3600 // Upper bound of timeouts and intervals in seconds
+	minSecretEntropyBits = 128  // Estimated entropy a production JWT secret needs
+)
+
+// Load loads and validates the configuration. Validation problems are
+// reported together as a *ValidationError.
 func (cl *ConfigLoader) Load() (*Config, error) {
 	// Check if config file exists
 	if _, err := os.Stat(cl.configPath); os.IsNotExist(err) {
@@ -29,67 +41,372 @@ func (cl *ConfigLoader) Load() (*Config, error) {
 	}
 
 	// Load configuration
-	config, err := LoadConfig(cl.configPath)
+	config, settings, err := loadConfig(cl.configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
 
 	// Validate configuration
-	if err := cl.validateConfig(config); err != nil {
-		return nil, fmt.Errorf("config validation failed: %w", err)
+	v := &validator{}
+	v.checkKnownKeys("", settings, reflect.TypeOf(*config))
+	resolveReferences(v, config)
+	cl.validateConfig(v, config)
+	if err := v.err(); err != nil {
+		return nil, fmt.Errorf("config validation failed:\n%w", err)
 	}
 
 	cl.config = config
 	return config, nil
 }
 
-// validateConfig performs validation on the loaded configuration
-func (cl *ConfigLoader) validateConfig(config *Config) error {
-	// Validate Server Configuration
-	if config.Server.Port <= 0 || config.Server.Port > 65535 {
-		return fmt.Errorf("invalid server port: %d", config.Server.Port)
+// validateConfig records the problems of the loaded configuration in v
+func (cl *ConfigLoader) validateConfig(v *validator, config *Config) {
+	cl.validateServer(v, config.Server)
+	cl.validateServices(v, config.Services)
+	cl.validateAuth(v, config.Auth)
+	cl.validateRedis(v, config)
+	cl.validateRoutes(v, config.Routes, config.Services)
+	cl.validatePolicies(v, config.Policies)
+	cl.validateRateLimits(v, config.RateLimits, config.Services)
+	cl.validateRateLimitFallback(v, config.RateLimitFallback)
+	cl.validateCache(v, config.Cache)
+	cl.validateTracing(v, config.Tracing)
+}
+
+// validateServer validates the listener settings
+func (cl *ConfigLoader) validateServer(v *validator, server ServerConfig) {
+	v.checkRange("server.port", server.Port, 1, 65535)
+	v.checkRange("server.readTimeoutSecs", server.ReadTimeoutSecs, 0, maxTimeoutSecs)
+	v.checkRange("server.writeTimeoutSecs", server.WriteTimeoutSecs, 0, maxTimeoutSecs)
+	v.checkRange("server.shutdownTimeoutSecs", server.ShutdownTimeoutSecs, 0, maxTimeoutSecs)
+}
+
+// validateRedis validates the Redis settings when a feature relies on Redis
+func (cl *ConfigLoader) validateRedis(v *validator, config *Config) {
+	usesRedis := len(config.RateLimits) > 0 || config.Auth.Revocation.Enabled ||
+		(config.Cache.Enabled && config.Cache.Store != CacheStoreLocal)
+	if !usesRedis {
+		return
+	}
+
+	if config.Redis.Host == "" {
+		v.addf("redis.host", "is required by rate limits, token revocation and the shared response cache")
+	}
+	v.checkRange("redis.port", config.Redis.Port, 1, 65535)
+	v.checkRange("redis.db", config.Redis.DB, 0, 15)
+}
+
+// validateTracing validates the tracing configuration
+func (cl *ConfigLoader) validateTracing(v *validator, tracing TracingConfig) {
+	switch tracing.Exporter {
+	case "", TraceExporterOTLPHTTP, TraceExporterOTLPGRPC, TraceExporterStdout:
+	default:
+		v.addf("tracing.exporter", "invalid exporter %q", tracing.Exporter)
+	}
+
+	if tracing.SampleRatio < 0 || tracing.SampleRatio > 1 {
+		v.addf("tracing.sampleRatio", "must be between 0 and 1, got %g", tracing.SampleRatio)
+	}
+}
+
+// validateCache validates the response cache configuration
+func (cl *ConfigLoader) validateCache(v *validator, cache CacheConfig) {
+	switch cache.Store {
+	case "", CacheStoreLocal, CacheStoreRedis, CacheStoreTiered:
+	default:
+		v.addf("cache.store", "invalid store %q", cache.Store)
+	}
+
+	v.checkNotNegative("cache.localEntries", int64(cache.LocalEntries))
+	v.checkNotNegative("cache.maxBodyBytes", int64(cache.MaxBodyBytes))
+	v.checkRange("cache.localTTLSecs", cache.LocalTTLSecs, 0, maxTimeoutSecs)
+	v.checkNotNegative("cache.defaultTTLSecs", int64(cache.DefaultTTLSecs))
+	v.checkNotNegative("cache.staleWhileRevalidateSecs", int64(cache.StaleWhileRevalidateSecs))
+}
+
+// validateRateLimits validates the declared rate limits
+func (cl *ConfigLoader) validateRateLimits(v *validator, limits []RateLimitConfig, services ServicesConfig) {
+	names := make(map[string]bool, len(limits))
+	for i, limit := range limits {
+		path := fmt.Sprintf("rateLimits[%d]", i)
+
+		if limit.Name == "" {
+			v.addf(path+".name", "is required")
+		} else if names[limit.Name] {
+			v.addf(path+".name", "duplicate name %q", limit.Name)
+		}
+		names[limit.Name] = true
+
+		if limit.PathPrefix != "" && !strings.HasPrefix(limit.PathPrefix, "/") {
+			v.addf(path+".pathPrefix", "must start with '/'")
+		}
+
+		if limit.Service != "" {
+			if _, ok := services.Registry[limit.Service]; !ok {
+				v.addf(path+".service", "unknown service %q", limit.Service)
+			}
+		}
+
+		if !isValidTier(limit.Tier) {
+			v.addf(path+".tier", "invalid tier %q", limit.Tier)
+		}
+
+		if limit.Requests <= 0 {
+			v.addf(path+".requests", "must be positive")
+		}
+		v.checkNotNegative(path+".periodSecs", int64(limit.PeriodSecs))
+		v.checkNotNegative(path+".burst", int64(limit.Burst))
+
+		switch limit.Algorithm {
+		case "", "token-bucket", "sliding-window":
+		default:
+			v.addf(path+".algorithm", "invalid algorithm %q", limit.Algorithm)
+		}
+	}
+}
+
+// validateRateLimitFallback validates the behaviour of the rate limits
+// while Redis is unavailable
+func (cl *ConfigLoader) validateRateLimitFallback(v *validator, fallback RateLimitFallbackConfig) {
+	switch fallback.Mode {
+	case "", RateLimitFailOpen, RateLimitFailClosed, RateLimitLocalFallback:
+	default:
+		v.addf("rateLimitFallback.mode", "invalid mode %q", fallback.Mode)
+	}
+
+	v.checkNotNegative("rateLimitFallback.redisTimeoutMillis", int64(fallback.RedisTimeoutMillis))
+	v.checkRange("rateLimitFallback.retryIntervalSecs", fallback.RetryIntervalSecs, 0, maxTimeoutSecs)
+}
+
+// isValidTier reports whether tier is a known client tier
+func isValidTier(tier string) bool {
+	switch tier {
+	case "", "all", "anonymous", "user":
+		return true
+	}
+	return strings.HasPrefix(tier, "role:") && len(tier) > len("role:")
+}
+
+// validatePolicies validates the route authorization policies
+func (cl *ConfigLoader) validatePolicies(v *validator, policies []PolicyConfig) {
+	for i, policy := range policies {
+		path := fmt.Sprintf("policies[%d]", i)
+
+		if !strings.HasPrefix(policy.Path, "/") {
+			v.addf(path+".path", "must start with '/'")
+		}
+
+		if idx := strings.Index(policy.Path, "**"); idx >= 0 && idx != len(policy.Path)-2 {
+			v.addf(path+".path", "'**' is only allowed at the end of the path")
+		}
+
+		if len(policy.Roles) == 0 && len(policy.Privileges) == 0 {
+			v.addf(path, "roles or privileges are required")
+		}
+
+		for j, method := range policy.Methods {
+			if !isValidMethod(method) {
+				v.addf(fmt.Sprintf("%s.methods[%d]", path, j), "invalid method %q", method)
+			}
+		}
+	}
+}
+
+// validateAuth validates the token verification settings
+func (cl *ConfigLoader) validateAuth(v *validator, auth AuthConfig) {
+	switch auth.SigningMode {
+	case SigningModeHMAC:
+		if auth.JWTSecret == "" {
+			v.addf("auth.jwtSecret", "is required in hmac signing mode")
+		}
+	case SigningModeAsymmetric:
+		if auth.PublicKeyFile == "" && auth.JWKSEndpoint() == "" {
+			v.addf("auth", "publicKeyFile, jwksURL or issuerURL is required in asymmetric signing mode")
+		}
+		if len(auth.Algorithms) == 0 {
+			v.addf("auth.algorithms", "at least one algorithm is required in asymmetric signing mode")
+		}
+		for i, alg := range auth.Algorithms {
+			if !isAsymmetricAlgorithm(alg) {
+				v.addf(fmt.Sprintf("auth.algorithms[%d]", i), "unsupported algorithm %q", alg)
+			}
+		}
+	default:
+		v.addf("auth.signingMode", "invalid signing mode %q", auth.SigningMode)
+	}
+
+	// A guessable secret lets anyone mint tokens
+	if auth.JWTSecret != "" && environment() == "production" {
+		if bits := secretEntropyBits(auth.JWTSecret); bits < minSecretEntropyBits {
+			v.addf("auth.jwtSecret", "too weak for production, about %.0f bits of entropy, at least %d required", bits, minSecretEntropyBits)
+		}
+	}
+
+	if auth.IssuerURL != "" {
+		v.checkURL("auth.issuerURL", auth.IssuerURL, "http", "https")
+	}
+	if auth.JWKSURL != "" {
+		v.checkURL("auth.jwksURL", auth.JWKSURL, "http", "https")
+	}
+
+	v.checkNotNegative("auth.tokenExpirySecs", int64(auth.TokenExpirySecs))
+	v.checkNotNegative("auth.jwksRefreshIntervalSecs", int64(auth.JWKSRefreshIntervalSecs))
+	v.checkNotNegative("auth.jwksMinRefetchIntervalSecs", int64(auth.JWKSMinRefetchIntervalSecs))
+	v.checkRange("auth.leewaySecs", auth.LeewaySecs, 0, maxTimeoutSecs)
+
+	for i, claim := range auth.RequiredClaims {
+		if claim == "" {
+			v.addf(fmt.Sprintf("auth.requiredClaims[%d]", i), "must not be empty")
+		}
+	}
+
+	v.checkNotNegative("auth.revocation.cacheSize", int64(auth.Revocation.CacheSize))
+	v.checkNotNegative("auth.revocation.cacheTTLSecs", int64(auth.Revocation.CacheTTLSecs))
+	v.checkNotNegative("auth.revocation.maxTokenLifetimeSecs", int64(auth.Revocation.MaxTokenLifetimeSecs))
+}
+
+// isAsymmetricAlgorithm reports whether alg is a supported public key algorithm
+func isAsymmetricAlgorithm(alg string) bool {
+	switch alg {
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512",
+		"ES256", "ES384", "ES512", "EdDSA":
+		return true
+	}
+	return false
+}
+
+// validateRoutes validates the declared proxy routes
+func (cl *ConfigLoader) validateRoutes(v *validator, routes []RouteConfig, services ServicesConfig) {
+	for i, route := range routes {
+		path := fmt.Sprintf("routes[%d]", i)
+
+		if !strings.HasPrefix(route.PathPrefix, "/") {
+			v.addf(path+".pathPrefix", "must start with '/'")
+		}
+
+		// Routes sharing or nesting a prefix may only split it by method
+		if conflict, ok := RouteConflict(routes, i); ok {
+			v.addf(path+".pathPrefix", "%s", conflict)
+		}
+
+		if route.Service == "" {
+			v.addf(path+".service", "is required")
+		} else if _, ok := services.Registry[route.Service]; !ok {
+			v.addf(path+".service", "unknown service %q", route.Service)
+		}
+
+		if route.Rewrite != "" && !strings.HasPrefix(route.Rewrite, "/") {
+			v.addf(path+".rewrite", "must start with '/'")
+		}
+
+		for j, method := range route.Methods {
+			if !isValidMethod(method) {
+				v.addf(fmt.Sprintf("%s.methods[%d]", path, j), "invalid method %q", method)
+			}
+		}
+
+		v.checkNotNegative(path+".cache.ttlSecs", int64(route.Cache.TTLSecs))
+		if route.AuthRequired && route.Cache.TTLSecs > 0 {
+			// Authorized responses are only shared when the backend marks them public
+			v.addf(path+".cache.ttlSecs", "cannot override the freshness of authenticated routes")
+		}
+		v.checkNotNegative(path+".cache.staleWhileRevalidateSecs", int64(route.Cache.StaleWhileRevalidateSecs))
+	}
+}
+
+// methodsOverlap reports whether two route method lists share a method. An
+// empty list allows every method.
+func methodsOverlap(a, b []string) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return true
+	}
+	for _, method := range a {
+		if slices.ContainsFunc(b, func(other string) bool { return strings.EqualFold(method, other) }) {
+			return true
+		}
 	}
+	return false
+}
 
-	// Validate Services Configuration
-	if err := cl.validateServices(config.Services); err != nil {
-		return fmt.Errorf("services validation failed: %w", err)
+// isValidMethod reports whether method is a supported HTTP method
+func isValidMethod(method string) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return true
 	}
+	return false
+}
 
-	// Validate Auth Configuration
-	if config.Auth.JWTSecret == "" {
-		return fmt.Errorf("JWT secret is required")
+// validateServices validates the service registry and the settings shared
+// by all services
+func (cl *ConfigLoader) validateServices(v *validator, services ServicesConfig) {
+	if len(services.Registry) == 0 {
+		v.addf("services.registry", "at least one service is required")
+	}
+	for _, name := range slices.Sorted(maps.Keys(services.Registry)) {
+		cl.validateService(v, "services.registry."+name, services.Registry[name])
 	}
 
-	return nil
+	v.checkRange("services.healthCheckInterval", services.HealthCheckInterval, 1, maxTimeoutSecs)
+	v.checkNotNegative("services.retryBufferBytes", services.RetryBufferBytes)
+	v.checkNotNegative("services.etagBufferBytes", services.ETagBufferBytes)
+	v.checkNotNegative("services.upgradeIdleTimeoutSecs", int64(services.UpgradeIdleTimeoutSecs))
 }
 
-// validateServices validates service-specific configurations
-func (cl *ConfigLoader) validateServices(services ServicesConfig) error {
-	// Validate User Service
-	if services.UserService.BaseURL == "" {
-		return fmt.Errorf("user service BaseURL is required")
+// validateService validates the endpoints, timeouts and TLS settings of a
+// single service
+func (cl *ConfigLoader) validateService(v *validator, path string, service ServiceConfig) {
+	if len(service.Endpoints()) == 0 {
+		v.addf(path, "baseURL or instances are required")
+	}
+
+	if len(service.Instances) == 0 && service.BaseURL != "" {
+		v.checkURL(path+".baseURL", service.BaseURL, "http", "https")
+	}
+	for i, instance := range service.Instances {
+		instancePath := fmt.Sprintf("%s.instances[%d]", path, i)
+		if instance.BaseURL == "" {
+			v.addf(instancePath+".baseURL", "is required")
+		} else {
+			v.checkURL(instancePath+".baseURL", instance.BaseURL, "http", "https")
+		}
+		v.checkNotNegative(instancePath+".weight", int64(instance.Weight))
+	}
+
+	if service.HealthCheck != "" && !strings.HasPrefix(service.HealthCheck, "/") {
+		v.addf(path+".healthCheck", "must start with '/'")
 	}
+	v.checkRange(path+".timeout", service.Timeout, 1, maxTimeoutSecs)
+	v.checkRange(path+".attemptTimeoutMs", service.AttemptTimeoutMs, 0, service.Timeout*1000)
+	v.checkNotNegative(path+".retryCount", int64(service.RetryCount))
+	v.checkRange(path+".retryBackoffMs", service.RetryBackoffMs, 0, service.Timeout*1000)
 
-	// Validate Notification Service
-	if services.NotificationService.BaseURL == "" {
-		return fmt.Errorf("notification service BaseURL is required")
+	breaker := service.CircuitBreaker
+	if breaker.ErrorRateThreshold < 0 || breaker.ErrorRateThreshold > 1 {
+		v.addf(path+".circuitBreaker.errorRateThreshold", "must be between 0 and 1, got %g", breaker.ErrorRateThreshold)
 	}
+	v.checkNotNegative(path+".circuitBreaker.failureThreshold", int64(breaker.FailureThreshold))
+	v.checkNotNegative(path+".circuitBreaker.minRequests", int64(breaker.MinRequests))
+	v.checkRange(path+".circuitBreaker.windowSecs", breaker.WindowSecs, 0, maxTimeoutSecs)
+	v.checkRange(path+".circuitBreaker.openTimeoutSecs", breaker.OpenTimeoutSecs, 0, maxTimeoutSecs)
+	v.checkNotNegative(path+".circuitBreaker.halfOpenMaxRequests", int64(breaker.HalfOpenMaxRequests))
 
-	// Validate Appointment Service
-	if services.AppointmentService.BaseURL == "" {
-		return fmt.Errorf("appointment service BaseURL is required")
+	if (service.TLS.CertFile == "") != (service.TLS.KeyFile == "") {
+		v.addf(path+".tls", "certFile and keyFile must be set together")
 	}
+}
 
-	return nil
+// environment returns the deployment environment, development by default
+func environment() string {
+	if env := os.Getenv("APP_ENV"); env != "" {
+		return env
+	}
+	return "development"
 }
 
 // GetDefaultConfigPath returns the default configuration path
 func GetDefaultConfigPath() string {
 	// Check for environment-specific config
-	env := os.Getenv("APP_ENV")
-	if env == "" {
-		env = "development"
-	}
-
-	return filepath.Join("config", fmt.Sprintf("config.%s.yaml", env))
+	return filepath.Join("config", fmt.Sprintf("config.%s.yaml", environment()))
 }
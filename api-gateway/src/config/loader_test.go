@@ -0,0 +1,143 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// problems returns the validation problems of the configuration in yaml
+func problems(t *testing.T, yaml string) []string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewConfigLoader(path).Load()
+	if err == nil {
+		return nil
+	}
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Load error = %v, want a *ValidationError", err)
+	}
+
+	var lines []string
+	for _, problem := range invalid.Errors {
+		lines = append(lines, problem.Error())
+	}
+	return lines
+}
+
+const validConfig = `
+auth:
+  signingMode: "hmac"
+  jwtSecret: "7f3a9c1e5b8d2f6a4c0e9b7d3f1a5c8e2b6d4f0a9c7e5b3d1f8a6c4e2b0d9f7a"
+services:
+  registry:
+    user-service:
+      baseURL: "http://user-service:5000"
+routes:
+  - pathPrefix: "/api/v1/users"
+    service: "user-service"
+`
+
+func TestLoadValidConfig(t *testing.T) {
+	if got := problems(t, validConfig); got != nil {
+		t.Errorf("problems = %q, want none", got)
+	}
+}
+
+func TestLoadReportsAllProblems(t *testing.T) {
+	got := problems(t, `
+server:
+  port: 70000
+  readTimeoutSecs: -1
+auth:
+  signingMode: "hmac"
+  jwtSecret: "secret"
+  issuerURL: "user-service:5000"
+services:
+  healthCheckInterval: 30
+  registry:
+    user-service:
+      baseURL: "ftp://user-service:5000"
+      retryCount: -1
+      timout: 10
+    payment-service:
+      instances:
+        - baseURL: ""
+        - baseURL: "http://payment-service-2:7000"
+          weight: -1
+      tls:
+        certFile: "client.pem"
+    search-service:
+      healthCheck: "/health"
+routes:
+  - pathPrefix: "/api/v1/users"
+    methods: ["GET"]
+    service: "user-service"
+    authRequired: true
+    cache:
+      ttlSecs: 30
+  - pathPrefix: "/api/v1/users"
+    methods: ["POST"]
+    service: "user-service"
+  - pathPrefix: "/api/v1/users"
+    service: "review-service"
+  - pathPrefix: "/api/v1/users/admins"
+    methods: ["get"]
+    service: "user-service"
+  - pathPrefix: "/metrics"
+    service: "user-service"
+rateLimits:
+  - name: "global"
+    requests: 100
+`)
+
+	want := []string{
+		"services.registry.user-service.timout: unknown setting",
+		"server.port: must be between 1 and 65535, got 70000",
+		"server.readTimeoutSecs: must be between 0 and 3600, got -1",
+		"services.registry.payment-service.instances[0].baseURL: is required",
+		"services.registry.payment-service.instances[1].weight: must not be negative, got -1",
+		"services.registry.payment-service.tls: certFile and keyFile must be set together",
+		"services.registry.search-service: baseURL or instances are required",
+		"services.registry.user-service.baseURL: URL \"ftp://user-service:5000\" must use http or https",
+		"services.registry.user-service.retryCount: must not be negative, got -1",
+		"auth.issuerURL: URL \"user-service:5000\" must use http or https",
+		"redis.host: is required by rate limits, token revocation and the shared response cache",
+		"redis.port: must be between 1 and 65535, got 0",
+		"routes[0].cache.ttlSecs: cannot override the freshness of authenticated routes",
+		"routes[2].pathPrefix: duplicates routes[0] for the same methods",
+		"routes[2].service: unknown service \"review-service\"",
+		"routes[3].pathPrefix: is nested under routes[0] for the same methods",
+		"routes[4].pathPrefix: conflicts with the gateway path /metrics",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("problems =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestLoadRejectsWeakSecretInProduction(t *testing.T) {
+	weak := strings.Replace(validConfig,
+		"7f3a9c1e5b8d2f6a4c0e9b7d3f1a5c8e2b6d4f0a9c7e5b3d1f8a6c4e2b0d9f7a",
+		"changeme-changeme-changeme-changeme", 1)
+
+	if got := problems(t, weak); got != nil {
+		t.Errorf("development problems = %q, want none", got)
+	}
+
+	t.Setenv("APP_ENV", "production")
+	got := problems(t, weak)
+	if len(got) != 1 || !strings.HasPrefix(got[0], "auth.jwtSecret: too weak for production") {
+		t.Errorf("production problems = %q, want a weak secret", got)
+	}
+	if got := problems(t, validConfig); got != nil {
+		t.Errorf("production problems with a strong secret = %q, want none", got)
+	}
+}
@@ -0,0 +1,123 @@
+// config/references.go
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// fileReferencePrefix marks a setting read from a file, e.g. a Docker or
+// Kubernetes secret mount: file:///run/secrets/jwt-secret
+const fileReferencePrefix = "file://"
+
+// envReference matches ${NAME} references to environment variables
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// resolveReferences replaces file and environment references in every
+// string setting of config with the values they refer to. The paths of
+// resolved settings are remembered so their values can be redacted, and the
+// files read so they can be watched.
+func resolveReferences(v *validator, config *Config) {
+	config.references = make(map[string]bool)
+	v.references = config.references
+	v.files = make(map[string]bool)
+	resolveValue(v, "", reflect.ValueOf(config).Elem())
+
+	config.files = nil
+	for name := range v.files {
+		config.files = append(config.files, name)
+	}
+	slices.Sort(config.files)
+}
+
+// resolveValue resolves the references in the settable value at path
+func resolveValue(v *validator, path string, value reflect.Value) {
+	switch value.Kind() {
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if field := value.Type().Field(i); field.IsExported() {
+				resolveValue(v, joinPath(path, yamlKey(field.Name)), value.Field(i))
+			}
+		}
+
+	case reflect.Map:
+		// Map elements are not addressable, resolve a copy and store it back
+		iter := value.MapRange()
+		for iter.Next() {
+			elem := reflect.New(value.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+			resolveValue(v, joinPath(path, fmt.Sprint(iter.Key().Interface())), elem)
+			value.SetMapIndex(iter.Key(), elem)
+		}
+
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			resolveValue(v, fmt.Sprintf("%s[%d]", path, i), value.Index(i))
+		}
+
+	case reflect.String:
+		resolved, ok, err := resolveString(value.String())
+		if err != nil {
+			v.addf(path, "%v", err)
+			return
+		}
+		if ok {
+			if name, isFile := strings.CutPrefix(value.String(), fileReferencePrefix); isFile {
+				v.files[name] = true
+			}
+			value.SetString(resolved)
+			v.references[path] = true
+		}
+	}
+}
+
+// resolveString returns the value s refers to and whether s held a reference
+func resolveString(s string) (string, bool, error) {
+	if name, ok := strings.CutPrefix(s, fileReferencePrefix); ok {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to read referenced file: %w", err)
+		}
+		// Secret files usually end with a newline that is not part of the secret
+		return strings.TrimRight(string(content), "\r\n"), true, nil
+	}
+
+	if !envReference.MatchString(s) {
+		return s, false, nil
+	}
+	var missing []string
+	resolved := envReference.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envReference.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", false, fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return resolved, true, nil
+}
+
+// fromReference reports whether the setting at path, or one below it, was
+// resolved from a reference
+func (c *Config) fromReference(path string) bool {
+	for ref := range c.references {
+		if ref == path || strings.HasPrefix(ref, path+".") || strings.HasPrefix(ref, path+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// ReferencedFiles returns the files read by file references, e.g. secret
+// mounts, sorted. Their content is only read when the configuration loads.
+func (c *Config) ReferencedFiles() []string {
+	return c.files
+}
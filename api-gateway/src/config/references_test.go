@@ -0,0 +1,78 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveReferences(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "jwt-secret")
+	if err := os.WriteFile(secretFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("REDIS_PASSWORD", "from-env")
+	t.Setenv("USER_SERVICE_HOST", "user-service")
+	t.Setenv("COLLECTOR_TOKEN", "token")
+
+	config := &Config{
+		Auth:  AuthConfig{JWTSecret: "file://" + secretFile},
+		Redis: RedisConfig{Host: "redis", Password: "${REDIS_PASSWORD}"},
+		Services: ServicesConfig{Registry: map[string]ServiceConfig{
+			"user-service": {BaseURL: "http://${USER_SERVICE_HOST}:5000"},
+		}},
+		Routes:  []RouteConfig{{PathPrefix: "/api/v1/users", Rewrite: "${UNSET_REWRITE}"}},
+		Tracing: TracingConfig{Headers: map[string]string{"authorization": "Bearer ${COLLECTOR_TOKEN}"}},
+	}
+
+	v := &validator{}
+	resolveReferences(v, config)
+
+	if config.Auth.JWTSecret != "from-file" {
+		t.Errorf("jwtSecret = %q, want the file content without its newline", config.Auth.JWTSecret)
+	}
+	if config.Redis.Password != "from-env" {
+		t.Errorf("redis password = %q, want from-env", config.Redis.Password)
+	}
+	if got := config.Services.Registry["user-service"].BaseURL; got != "http://user-service:5000" {
+		t.Errorf("baseURL = %q, want http://user-service:5000", got)
+	}
+	if got := config.Tracing.Headers["authorization"]; got != "Bearer token" {
+		t.Errorf("tracing header = %q, want Bearer token", got)
+	}
+	if config.Redis.Host != "redis" {
+		t.Errorf("redis host = %q, want it unchanged", config.Redis.Host)
+	}
+
+	want := map[string]bool{
+		"auth.jwtSecret":                         true,
+		"redis.password":                         true,
+		"services.registry.user-service.baseURL": true,
+		"tracing.headers.authorization":          true,
+	}
+	if !reflect.DeepEqual(config.references, want) {
+		t.Errorf("references = %v, want %v", config.references, want)
+	}
+	if got := config.ReferencedFiles(); !reflect.DeepEqual(got, []string{secretFile}) {
+		t.Errorf("ReferencedFiles = %v, want [%s]", got, secretFile)
+	}
+
+	if len(v.errs) != 1 || v.errs[0].Error() != "routes[0].rewrite: environment variable UNSET_REWRITE is not set" {
+		t.Errorf("problems = %v, want the unset variable", v.errs)
+	}
+}
+
+func TestDiffRedactsReferences(t *testing.T) {
+	old := &Config{Redis: RedisConfig{Host: "redis-1"}}
+	new := &Config{
+		Redis:      RedisConfig{Host: "redis-2"},
+		references: map[string]bool{"redis.host": true},
+	}
+
+	got := Diff(old, new)
+	want := []Change{{Path: "redis.host", Old: redacted, New: redacted}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,55 @@
+// config/routes.go
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GatewayPaths are the paths the gateway serves itself. Routes must neither
+// use nor contain them, and a trailing "/*" reserves every path below.
+var GatewayPaths = []string{
+	"/health",
+	"/metrics",
+	"/admin/*",
+	"/api/v1/public/login",
+	"/api/v1/protected/*",
+}
+
+// RouteConflict reports why routes[i] cannot be served next to the gateway
+// paths and the routes declared before it. Each route serves its prefix and
+// every path below it, so prefixes may only be shared or nested when the
+// routes' methods differ.
+func RouteConflict(routes []RouteConfig, i int) (string, bool) {
+	route := routes[i]
+	prefix := strings.TrimSuffix(route.PathPrefix, "/")
+
+	for _, reserved := range GatewayPaths {
+		path, subtree := strings.CutSuffix(reserved, "/*")
+		if prefix == path || isBelow(path, prefix) || (subtree && isBelow(prefix, path)) {
+			return fmt.Sprintf("conflicts with the gateway path %s", reserved), true
+		}
+	}
+
+	for j, other := range routes[:i] {
+		if !methodsOverlap(other.Methods, route.Methods) {
+			continue
+		}
+		otherPrefix := strings.TrimSuffix(other.PathPrefix, "/")
+		switch {
+		case prefix == otherPrefix:
+			return fmt.Sprintf("duplicates routes[%d] for the same methods", j), true
+		case isBelow(prefix, otherPrefix):
+			return fmt.Sprintf("is nested under routes[%d] for the same methods", j), true
+		case isBelow(otherPrefix, prefix):
+			return fmt.Sprintf("contains routes[%d] for the same methods", j), true
+		}
+	}
+	return "", false
+}
+
+// isBelow reports whether path lies below prefix
+func isBelow(path, prefix string) bool {
+	return strings.HasPrefix(path, prefix+"/")
+}
@@ -0,0 +1,33 @@
+package config
+
+import "testing"
+
+func TestRouteConflict(t *testing.T) {
+	users := RouteConfig{PathPrefix: "/shop/users", Methods: []string{"GET"}}
+
+	tests := []struct {
+		name  string
+		route RouteConfig
+		want  string
+	}{
+		{name: "sibling", route: RouteConfig{PathPrefix: "/shop/orders"}},
+		{name: "sibling sharing a name prefix", route: RouteConfig{PathPrefix: "/shop/users-archive"}},
+		{name: "same prefix, other methods", route: RouteConfig{PathPrefix: "/shop/users/", Methods: []string{"POST"}}},
+		{name: "nested, other methods", route: RouteConfig{PathPrefix: "/shop/users/42", Methods: []string{"delete"}}},
+		{name: "below a gateway path", route: RouteConfig{PathPrefix: "/health/live"}},
+		{name: "same prefix", route: RouteConfig{PathPrefix: "/shop/users/", Methods: []string{"get"}}, want: "duplicates routes[0] for the same methods"},
+		{name: "nested", route: RouteConfig{PathPrefix: "/shop/users/42"}, want: "is nested under routes[0] for the same methods"},
+		{name: "containing", route: RouteConfig{PathPrefix: "/shop", Methods: []string{"GET"}}, want: "contains routes[0] for the same methods"},
+		{name: "gateway path", route: RouteConfig{PathPrefix: "/metrics"}, want: "conflicts with the gateway path /metrics"},
+		{name: "containing a gateway path", route: RouteConfig{PathPrefix: "/api/v1/public"}, want: "conflicts with the gateway path /api/v1/public/login"},
+		{name: "below a reserved subtree", route: RouteConfig{PathPrefix: "/admin/reports"}, want: "conflicts with the gateway path /admin/*"},
+		{name: "root", route: RouteConfig{PathPrefix: "/"}, want: "conflicts with the gateway path /health"},
+	}
+
+	for _, tt := range tests {
+		got, conflict := RouteConflict([]RouteConfig{users, tt.route}, 1)
+		if got != tt.want || conflict != (tt.want != "") {
+			t.Errorf("%s: RouteConflict = %q, %t, want %q", tt.name, got, conflict, tt.want)
+		}
+	}
+}
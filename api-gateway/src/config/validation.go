@@ -0,0 +1,165 @@
+// config/validation.go
+
+package config
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// FieldError is a problem with the setting at a configuration path
+type FieldError struct {
+	Path    string // Key path as written in YAML, e.g. services.registry.user-service.baseURL
+	Message string
+}
+
+// Error formats the problem with its path
+func (e *FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+// Error lists the problems one per line
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validator collects the problems found while validating a configuration
+type validator struct {
+	errs       []*FieldError
+	references map[string]bool // Settings resolved from references, whose values are not shown
+	files      map[string]bool // Files read by references
+}
+
+// display returns the value of the setting at path as shown in problems
+func (v *validator) display(path, value string) string {
+	if v.references[path] {
+		return redacted
+	}
+	return fmt.Sprintf("%q", value)
+}
+
+// addf records a problem with the setting at path
+func (v *validator) addf(path, format string, args ...any) {
+	v.errs = append(v.errs, &FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// err returns the collected problems, nil when there are none
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: v.errs}
+}
+
+// checkRange records a problem when value lies outside [min, max]
+func (v *validator) checkRange(path string, value, min, max int) {
+	if value < min || value > max {
+		v.addf(path, "must be between %d and %d, got %d", min, max, value)
+	}
+}
+
+// checkNotNegative records a problem when value is negative
+func (v *validator) checkNotNegative(path string, value int64) {
+	if value < 0 {
+		v.addf(path, "must not be negative, got %d", value)
+	}
+}
+
+// checkURL records a problem when value is not an absolute URL with one of
+// the given schemes
+func (v *validator) checkURL(path, value string, schemes ...string) {
+	u, err := url.Parse(value)
+	if err != nil {
+		v.addf(path, "invalid URL %s", v.display(path, value))
+		return
+	}
+	if !slices.Contains(schemes, u.Scheme) {
+		v.addf(path, "URL %s must use %s", v.display(path, value), strings.Join(schemes, " or "))
+		return
+	}
+	if u.Host == "" {
+		v.addf(path, "URL %s has no host", v.display(path, value))
+	}
+}
+
+// checkKnownKeys records every setting in settings that does not map to a
+// field of t, which mostly catches misspelled keys
+func (v *validator) checkKnownKeys(path string, settings any, t reflect.Type) {
+	switch t.Kind() {
+	case reflect.Struct:
+		values, ok := settings.(map[string]any)
+		if !ok {
+			return
+		}
+		for _, key := range slices.Sorted(maps.Keys(values)) {
+			field, ok := fieldByKey(t, key)
+			if !ok {
+				v.addf(joinPath(path, key), "unknown setting")
+				continue
+			}
+			v.checkKnownKeys(joinPath(path, yamlKey(field.Name)), values[key], field.Type)
+		}
+
+	case reflect.Map:
+		values, ok := settings.(map[string]any)
+		if !ok {
+			return
+		}
+		for _, key := range slices.Sorted(maps.Keys(values)) {
+			v.checkKnownKeys(joinPath(path, key), values[key], t.Elem())
+		}
+
+	case reflect.Slice:
+		values, ok := settings.([]any)
+		if !ok {
+			return
+		}
+		for i, value := range values {
+			v.checkKnownKeys(fmt.Sprintf("%s[%d]", path, i), value, t.Elem())
+		}
+	}
+}
+
+// fieldByKey finds the exported field of t a YAML key decodes into. Keys
+// match field names regardless of case, like the decoder does.
+func fieldByKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.IsExported() && strings.EqualFold(field.Name, key) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// secretEntropyBits estimates the entropy of secret from the frequency of
+// its characters. Repetitive or short secrets score low.
+func secretEntropyBits(secret string) float64 {
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range secret {
+		counts[r]++
+		total++
+	}
+
+	var bitsPerChar float64
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		bitsPerChar -= p * math.Log2(p)
+	}
+	return bitsPerChar * float64(total)
+}
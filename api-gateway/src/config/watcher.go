@@ -0,0 +1,109 @@
+// config/watcher.go
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// watchDebounce coalesces the burst of events a single save produces
+const watchDebounce = 250 * time.Millisecond
+
+// WatchFiles reports changes of the files at paths on the returned channel
+// until ctx is done. The parent directories are watched so that files
+// replaced on save or swapped through symlinks (e.g. Kubernetes ConfigMaps
+// and secret mounts) are followed, and events are only reported when the
+// content of a file changed.
+func WatchFiles(ctx context.Context, paths []string, logger *zap.Logger) (<-chan struct{}, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	dirs := make(map[string]bool)
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		if dirs[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+		dirs[dir] = true
+	}
+
+	// Take the initial digests before returning so writes made afterwards
+	// are never mistaken for the starting content
+	digests := make(map[string][]byte, len(paths))
+	for _, path := range paths {
+		digests[path] = fileDigest(path)
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer watcher.Close()
+
+		debounce := time.NewTimer(watchDebounce)
+		debounce.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				debounce.Reset(watchDebounce)
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Warn("config file watch error", zap.Error(err))
+
+			case <-debounce.C:
+				changed := false
+				for _, path := range paths {
+					current := fileDigest(path)
+					if current == nil || bytes.Equal(current, digests[path]) {
+						continue
+					}
+					digests[path] = current
+					changed = true
+				}
+				if !changed {
+					continue
+				}
+
+				select {
+				case changes <- struct{}{}:
+				default: // A reload is already pending
+				}
+			}
+		}
+	}()
+
+	return changes, nil
+}
+
+// fileDigest returns the SHA-256 of the file at path, nil if it cannot be
+// read, e.g. while it is being replaced
+func fileDigest(path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestWatchFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("server:\n  port: 8080\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := WatchFiles(ctx, []string{path}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewriting the same content is not a change
+	if err := os.WriteFile(path, []byte("server:\n  port: 8080\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+		t.Fatal("unchanged content reported as a change")
+	case <-time.After(2 * watchDebounce):
+	}
+
+	// Replace the file the way editors save it
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte("server:\n  port: 9090\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("replaced file not reported")
+	}
+}
+
+func TestWatchFilesReportsReferencedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	secret := filepath.Join(t.TempDir(), "jwt-secret")
+	for _, name := range []string{path, secret} {
+		if err := os.WriteFile(name, []byte("v1\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := WatchFiles(ctx, []string{path, secret}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A rotated secret in another directory is a change of the configuration
+	if err := os.WriteFile(secret, []byte("v2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("rotated secret not reported")
+	}
+}
@@ -1,9 +1,18 @@
-package src
+package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/api/handlers"
 	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/middlewares/auth"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/middlewares/httpcache"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/middlewares/ratelimit"
 	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/metrics"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/tracing"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/routes"
 	"github.com/Mir00r/api-gateway/src/api-gateway/src/services"
 	"go.uber.org/zap"
 	"net/http"
@@ -14,6 +23,13 @@ import (
 )
 
 func main() {
+	validateOnly := flag.Bool("validate-config", false, "validate the configuration file and exit")
+	flag.Parse()
+
+	if *validateOnly {
+		os.Exit(validateConfig())
+	}
+
 	// Initialize logger
 	logger, err := initLogger()
 	if err != nil {
@@ -29,25 +45,84 @@ func main() {
 	}
 
 	// Initialize metrics collector
-	metrics.GetCollector()
+	collector := metrics.NewCollector(metrics.NewRegistry())
 
-	// Initialize service registry
-	registry, err := services.NewRegistry(cfg)
+	// Initialize tracing before anything that creates spans
+	shutdownTracing, err := tracing.Setup(context.Background(), &cfg.Tracing)
 	if err != nil {
-		logger.Fatal("Failed to initialize service registry", zap.Error(err))
+		logger.Fatal("Failed to initialize tracing", zap.Error(err))
+	}
+
+	// Background tasks (health checks, key refresh) stop when main returns
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	// Initialize service discovery
+	discovery := services.NewServiceDiscovery(&cfg.Services, collector, logger)
+	if err := discovery.Start(backgroundCtx); err != nil {
+		logger.Fatal("Failed to initialize service discovery", zap.Error(err))
+	}
+
+	// Redis is shared by token revocation and rate limiting
+	redisClient := services.NewRedisClient(&cfg.Redis)
+
+	// Initialize token revocation
+	var revocations *services.RevocationStore
+	if cfg.Auth.Revocation.Enabled {
+		revocations = services.NewRevocationStore(redisClient, &cfg.Auth, logger)
+	}
+
+	// Initialize response cache
+	var responseCache *httpcache.ResponseCache
+	if cfg.Cache.Enabled {
+		responseCache = httpcache.NewResponseCache(&cfg.Cache, redisClient, collector, logger)
 	}
 
 	// Initialize handlers
-	handlers := handlers.NewHandlers(cfg, registry, logger)
+	h := handlers.NewHandlers(cfg, discovery, revocations, responseCache, collector, logger)
+
+	// Initialize token verification
+	jwtAuth, err := auth.NewJWTAuthMiddleware(backgroundCtx, &cfg.Auth, revocations, logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize JWT authentication", zap.Error(err))
+	}
+
+	// Initialize authorization policies
+	policies, err := auth.NewPolicyEnforcer(cfg.Policies, logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize authorization policies", zap.Error(err))
+	}
+
+	// Initialize rate limits
+	rateLimits, err := ratelimit.NewPolicyEngine(cfg, redisClient, collector, logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize rate limits", zap.Error(err))
+	}
 
 	// Initialize router
-	router := api.NewRouter(cfg, handlers)
-	router.Setup()
+	router := routes.NewRouter(cfg, h, jwtAuth, policies, rateLimits, responseCache, collector, logger)
+	if err := router.Setup(); err != nil {
+		logger.Fatal("Failed to register routes", zap.Error(err))
+	}
+
+	// Apply configuration changes without a restart
+	reloads := &reloader{
+		path:       configPath(),
+		current:    cfg,
+		discovery:  discovery,
+		handlers:   h,
+		jwtAuth:    jwtAuth,
+		policies:   policies,
+		rateLimits: rateLimits,
+		router:     router,
+		logger:     logger,
+	}
+	go reloads.run(backgroundCtx)
 
 	// Create server
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Server.Port),
-		Handler:      router.GetEngine(),
+		Handler:      router,
 		ReadTimeout:  time.Duration(cfg.Server.ReadTimeoutSecs) * time.Second,
 		WriteTimeout: time.Duration(cfg.Server.WriteTimeoutSecs) * time.Second,
 	}
@@ -77,6 +152,11 @@ func main() {
 		logger.Fatal("Server forced to shutdown", zap.Error(err))
 	}
 
+	// Flush pending spans
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Warn("Failed to flush traces", zap.Error(err))
+	}
+
 	logger.Info("Server exited gracefully")
 }
 
@@ -91,11 +171,34 @@ func initLogger() (*zap.Logger, error) {
 
 // loadConfig loads the application configuration
 func loadConfig() (*config.Config, error) {
-	configPath := config.GetDefaultConfigPath()
-	if envPath := os.Getenv("CONFIG_PATH"); envPath != "" {
-		configPath = envPath
+	loader := config.NewConfigLoader(configPath())
+	return loader.Load()
+}
+
+// validateConfig reports every problem of the configuration file and
+// returns the exit code, non-zero when the configuration is invalid
+func validateConfig() int {
+	path := configPath()
+	if _, err := config.NewConfigLoader(path).Load(); err != nil {
+		var invalid *config.ValidationError
+		if !errors.As(err, &invalid) {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return 1
+		}
+		for _, problem := range invalid.Errors {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, problem)
+		}
+		return 1
 	}
 
-	loader := config.NewConfigLoader(configPath)
-	return loader.Load()
+	fmt.Printf("%s: configuration is valid\n", path)
+	return 0
+}
+
+// configPath returns the path of the configuration file
+func configPath() string {
+	if envPath := os.Getenv("CONFIG_PATH"); envPath != "" {
+		return envPath
+	}
+	return config.GetDefaultConfigPath()
 }
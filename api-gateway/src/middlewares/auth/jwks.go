@@ -0,0 +1,320 @@
+// middleware/auth/jwks.go
+
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+// JWKS defaults applied to zero config values
+const (
+	defaultJWKSRefreshInterval    = 5 * time.Minute
+	defaultJWKSMinRefetchInterval = 10 * time.Second
+	jwksFetchTimeout              = 5 * time.Second
+)
+
+// jsonWebKey is a single entry of a JSON Web Key Set (RFC 7517)
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC and OKP
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// verificationKey is a parsed JWK
+type verificationKey struct {
+	key interface{}
+	alg string // Algorithm pinned by the JWK, if any
+}
+
+// remoteKeys verifies tokens with keys fetched from a JWKS endpoint. Keys are
+// refreshed in the background and refetched when a token references an
+// unknown key ID, at most once per minRefetch.
+type remoteKeys struct {
+	url             string
+	refreshInterval time.Duration
+	minRefetch      time.Duration
+	httpClient      *http.Client
+	logger          *zap.Logger
+
+	mu        sync.RWMutex
+	keys      map[string]verificationKey
+	fetchedAt time.Time
+
+	// fetchMu serializes fetches so concurrent misses share one request
+	fetchMu sync.Mutex
+}
+
+// newRemoteKeys creates a JWKS key provider and starts refreshing it until ctx is done
+func newRemoteKeys(ctx context.Context, url string, refreshInterval, minRefetch time.Duration, logger *zap.Logger) *remoteKeys {
+	if refreshInterval <= 0 {
+		refreshInterval = defaultJWKSRefreshInterval
+	}
+	if minRefetch <= 0 {
+		minRefetch = defaultJWKSMinRefetchInterval
+	}
+
+	rk := &remoteKeys{
+		url:             url,
+		refreshInterval: refreshInterval,
+		minRefetch:      minRefetch,
+		httpClient:      &http.Client{Timeout: jwksFetchTimeout},
+		logger:          logger,
+		keys:            make(map[string]verificationKey),
+	}
+
+	// The issuer may not be up yet; unknown key IDs trigger a refetch later
+	if err := rk.refresh(ctx); err != nil {
+		logger.Warn("initial JWKS fetch failed", zap.Error(err), zap.String("url", url))
+	}
+	go rk.run(ctx)
+
+	return rk
+}
+
+// run refreshes the key set periodically
+func (rk *remoteKeys) run(ctx context.Context) {
+	ticker := time.NewTicker(rk.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := rk.refresh(ctx); err != nil {
+				rk.logger.Warn("JWKS refresh failed, keeping previous keys",
+					zap.Error(err),
+					zap.String("url", rk.url),
+				)
+			}
+		}
+	}
+}
+
+// Key implements keyProvider
+func (rk *remoteKeys) Key(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	alg := token.Method.Alg()
+
+	if key, ok := rk.lookup(kid, alg); ok {
+		return key, nil
+	}
+
+	// The issuer may have rotated its keys
+	if rk.refetch() {
+		if key, ok := rk.lookup(kid, alg); ok {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: kid %q", ErrUnknownKey, kid)
+}
+
+// lookup finds the key for a key ID. Tokens without a key ID are accepted
+// when exactly one compatible key is published.
+func (rk *remoteKeys) lookup(kid, alg string) (interface{}, bool) {
+	rk.mu.RLock()
+	defer rk.mu.RUnlock()
+
+	if kid != "" {
+		vk, ok := rk.keys[kid]
+		if !ok || !vk.accepts(alg) {
+			return nil, false
+		}
+		return vk.key, true
+	}
+
+	var match interface{}
+	for _, vk := range rk.keys {
+		if vk.accepts(alg) {
+			if match != nil {
+				return nil, false
+			}
+			match = vk.key
+		}
+	}
+	return match, match != nil
+}
+
+// refetch fetches the key set unless it was fetched within minRefetch,
+// reporting whether the keys were updated
+func (rk *remoteKeys) refetch() bool {
+	rk.fetchMu.Lock()
+	defer rk.fetchMu.Unlock()
+
+	rk.mu.RLock()
+	recent := time.Since(rk.fetchedAt) < rk.minRefetch
+	rk.mu.RUnlock()
+	if recent {
+		return false
+	}
+
+	if err := rk.fetch(context.Background()); err != nil {
+		rk.logger.Warn("JWKS refetch failed", zap.Error(err), zap.String("url", rk.url))
+		return false
+	}
+	return true
+}
+
+// refresh fetches the key set unconditionally
+func (rk *remoteKeys) refresh(ctx context.Context) error {
+	rk.fetchMu.Lock()
+	defer rk.fetchMu.Unlock()
+
+	return rk.fetch(ctx)
+}
+
+// fetch downloads and replaces the key set. The caller holds fetchMu.
+func (rk *remoteKeys) fetch(ctx context.Context) error {
+	// Failed attempts count toward the refetch rate limit as well
+	rk.mu.Lock()
+	rk.fetchedAt = time.Now()
+	rk.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, jwksFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rk.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := rk.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("JWKS request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("JWKS endpoint responded %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]verificationKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			// One malformed entry must not take down the others
+			rk.logger.Warn("skipping invalid JWK", zap.Error(err), zap.String("kid", jwk.Kid))
+			continue
+		}
+		keys[jwk.Kid] = verificationKey{key: key, alg: jwk.Alg}
+	}
+
+	rk.mu.Lock()
+	rk.keys = keys
+	rk.mu.Unlock()
+
+	rk.logger.Debug("JWKS refreshed", zap.String("url", rk.url), zap.Int("keys", len(keys)))
+	return nil
+}
+
+// accepts reports whether the key may verify a token signed with alg
+func (vk verificationKey) accepts(alg string) bool {
+	if vk.alg != "" && vk.alg != alg {
+		return false
+	}
+	return keyMatchesAlgorithm(vk.key, alg)
+}
+
+// publicKey converts the JWK to a crypto public key
+func (jwk jsonWebKey) publicKey() (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %s", jwk.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
+
+// decodeBigInt decodes a base64url-encoded unsigned big-endian integer
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty value")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,295 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+// jwksServer publishes a key set that tests can replace
+type jwksServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	keys    []map[string]string
+	failing bool
+	fetches atomic.Int32
+}
+
+// newJWKSServer starts a JWKS endpoint publishing keys
+func newJWKSServer(t *testing.T, keys ...map[string]string) *jwksServer {
+	t.Helper()
+
+	s := &jwksServer{keys: keys}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": s.keys})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// publish replaces the published keys
+func (s *jwksServer) publish(keys ...map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+// fail makes the endpoint respond with errors
+func (s *jwksServer) fail() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing = true
+}
+
+// ecJWK encodes the public part of key as a JWK
+func ecJWK(kid string, key *ecdsa.PrivateKey) map[string]string {
+	size := (key.Curve.Params().BitSize + 7) / 8
+	return map[string]string{
+		"kty": "EC",
+		"kid": kid,
+		"crv": key.Curve.Params().Name,
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size))),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size))),
+	}
+}
+
+// newTestRemoteKeys fetches the keys of server, refetching unknown key IDs at
+// most once per minRefetch
+func newTestRemoteKeys(t *testing.T, server *jwksServer, refreshInterval, minRefetch time.Duration) *remoteKeys {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return newRemoteKeys(ctx, server.URL, refreshInterval, minRefetch, zap.NewNop())
+}
+
+// tokenFor returns the parsed header of a token signed with method and key ID
+func tokenFor(method jwt.SigningMethod, kid string) *jwt.Token {
+	token := jwt.New(method)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	return token
+}
+
+// rewind makes the last fetch of rk appear older than its refetch interval
+func rewind(rk *remoteKeys) {
+	rk.mu.Lock()
+	defer rk.mu.Unlock()
+	rk.fetchedAt = rk.fetchedAt.Add(-rk.minRefetch)
+}
+
+func TestRemoteKeysRefetchUnknownKeyIDs(t *testing.T) {
+	first := newECKey(t, elliptic.P256())
+	second := newECKey(t, elliptic.P256())
+	server := newJWKSServer(t, ecJWK("first", first))
+	rk := newTestRemoteKeys(t, server, time.Hour, time.Hour)
+
+	key, err := rk.Key(tokenFor(jwt.SigningMethodES256, "first"))
+	if err != nil || !first.PublicKey.Equal(key) {
+		t.Fatalf("Key(first) = %v, %v, want the first key", key, err)
+	}
+
+	// The issuer rotates its keys; unknown key IDs trigger at most one
+	// refetch per interval so forged key IDs cannot flood the endpoint
+	server.publish(ecJWK("first", first), ecJWK("second", second))
+	if _, err := rk.Key(tokenFor(jwt.SigningMethodES256, "second")); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Key(second) error = %v within the refetch interval, want %v", err, ErrUnknownKey)
+	}
+	if got := server.fetches.Load(); got != 1 {
+		t.Fatalf("fetches = %d within the refetch interval, want 1", got)
+	}
+
+	rewind(rk)
+	key, err = rk.Key(tokenFor(jwt.SigningMethodES256, "second"))
+	if err != nil || !second.PublicKey.Equal(key) {
+		t.Fatalf("Key(second) = %v, %v after the refetch interval, want the second key", key, err)
+	}
+
+	if _, err := rk.Key(tokenFor(jwt.SigningMethodES256, "forged")); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Key(forged) error = %v, want %v", err, ErrUnknownKey)
+	}
+	if got := server.fetches.Load(); got != 2 {
+		t.Errorf("fetches = %d, want 2", got)
+	}
+}
+
+func TestRemoteKeysRefreshInBackground(t *testing.T) {
+	key := newECKey(t, elliptic.P256())
+	server := newJWKSServer(t)
+	rk := newTestRemoteKeys(t, server, 10*time.Millisecond, time.Hour)
+
+	server.publish(ecJWK("rotated", key))
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := rk.lookup("rotated", "ES256"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("rotated key not picked up by the background refresh")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRemoteKeysKeepKeysWhenRefreshFails(t *testing.T) {
+	key := newECKey(t, elliptic.P256())
+	server := newJWKSServer(t, ecJWK("current", key))
+	rk := newTestRemoteKeys(t, server, time.Hour, time.Hour)
+
+	server.fail()
+	if err := rk.refresh(context.Background()); err == nil {
+		t.Fatal("refresh succeeded against a failing endpoint")
+	}
+	if _, ok := rk.lookup("current", "ES256"); !ok {
+		t.Error("keys were dropped after a failed refresh")
+	}
+}
+
+func TestRemoteKeysSelection(t *testing.T) {
+	p256 := newECKey(t, elliptic.P256())
+	p384 := newECKey(t, elliptic.P384())
+
+	pinned := ecJWK("pinned", p256)
+	pinned["alg"] = "ES384"
+	encryption := ecJWK("encryption", p256)
+	encryption["use"] = "enc"
+	invalid := ecJWK("invalid", p256)
+	invalid["x"] = "not base64!"
+
+	server := newJWKSServer(t, ecJWK("p256", p256), ecJWK("p384", p384), pinned, encryption, invalid)
+	rk := newTestRemoteKeys(t, server, time.Hour, time.Hour)
+
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		kid    string
+		want   *ecdsa.PrivateKey
+	}{
+		{name: "matching key ID", method: jwt.SigningMethodES256, kid: "p256", want: p256},
+		{name: "algorithm of another curve", method: jwt.SigningMethodES384, kid: "p256"},
+		{name: "algorithm pinned by the key", method: jwt.SigningMethodES256, kid: "pinned"},
+		{name: "encryption key", method: jwt.SigningMethodES256, kid: "encryption"},
+		{name: "invalid key", method: jwt.SigningMethodES256, kid: "invalid"},
+		{name: "no key ID, one compatible key", method: jwt.SigningMethodES256, want: p256},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := rk.Key(tokenFor(tt.method, tt.kid))
+			if tt.want == nil {
+				if !errors.Is(err, ErrUnknownKey) {
+					t.Errorf("Key error = %v, want %v", err, ErrUnknownKey)
+				}
+				return
+			}
+			if err != nil || !tt.want.PublicKey.Equal(key) {
+				t.Errorf("Key = %v, %v, want the %s key", key, err, tt.want.Curve.Params().Name)
+			}
+		})
+	}
+
+	// Without a key ID the key is ambiguous once a second one is published
+	server.publish(ecJWK("p256", p256), ecJWK("p256-next", newECKey(t, elliptic.P256())))
+	if err := rk.refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rk.Key(tokenFor(jwt.SigningMethodES256, "")); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Key error = %v with several compatible keys, want %v", err, ErrUnknownKey)
+	}
+}
+
+func TestAlgorithmAllowList(t *testing.T) {
+	p256 := newECKey(t, elliptic.P256())
+	p384 := newECKey(t, elliptic.P384())
+	server := newJWKSServer(t, ecJWK("p256", p256), ecJWK("p384", p384))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	m, err := NewJWTAuthMiddleware(ctx, &config.AuthConfig{
+		SigningMode: config.SigningModeAsymmetric,
+		JWKSURL:     server.URL,
+		Algorithms:  []string{"ES256"},
+	}, nil, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sign signs a token with key and method, using key ID kid
+	sign := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		token := tokenFor(method, kid)
+		token.Claims = jwt.MapClaims{"id": "42", "exp": time.Now().Add(time.Hour).Unix()}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	// The public key is known to everyone, signing HS256 with it must not work
+	publicPEM := pem.EncodeToMemory(publicKeyBlock(t, &p256.PublicKey))
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode string
+	}{
+		{name: "allowed algorithm", token: sign(jwt.SigningMethodES256, "p256", p256)},
+		{name: "algorithm not allowed", token: sign(jwt.SigningMethodES384, "p384", p384), wantCode: ErrorCodeInvalidSignature},
+		{name: "HMAC with the public key", token: sign(jwt.SigningMethodHS256, "p256", publicPEM), wantCode: ErrorCodeInvalidSignature},
+		{name: "unsigned", token: sign(jwt.SigningMethodNone, "p256", jwt.UnsafeAllowNoneSignatureType), wantCode: ErrorCodeInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := authenticate(m, tt.token); got != tt.wantCode {
+				t.Errorf("code = %q, want %q", got, tt.wantCode)
+			}
+		})
+	}
+}
+
+// authenticate runs a request with token through m and returns the error
+// code of the response, empty when the request was let through
+func authenticate(m *JWTAuthMiddleware, token string) string {
+	engine := gin.New()
+	engine.GET("/", m.Authenticate(), func(c *gin.Context) {})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, req)
+
+	if recorder.Code == http.StatusOK {
+		return ""
+	}
+	var body struct {
+		Code string `json:"code"`
+	}
+	json.NewDecoder(recorder.Body).Decode(&body)
+	return body.Code
+}
@@ -3,83 +3,329 @@
 package auth
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
-	_ "time"
+	"sync/atomic"
+	"time"
 
 	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/tracing"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/services"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
 )
 
-// JWTAuthMiddleware handles JWT authentication
+// Error codes returned in the code field of 401 responses
+const (
+	ErrorCodeMissingToken     = "missing_token"
+	ErrorCodeMalformedToken   = "malformed_token"
+	ErrorCodeInvalidSignature = "invalid_signature"
+	ErrorCodeTokenExpired     = "token_expired"
+	ErrorCodeTokenNotYetValid = "token_not_yet_valid"
+	ErrorCodeInvalidIssuer    = "invalid_issuer"
+	ErrorCodeInvalidAudience  = "invalid_audience"
+	ErrorCodeMissingClaim     = "missing_claim"
+	ErrorCodeTokenRevoked     = "token_revoked"
+	ErrorCodeInvalidToken     = "invalid_token"
+)
+
+// accessTokenParam is the query parameter carrying the token of upgrade requests
+const accessTokenParam = "access_token"
+
+// errTokenRevoked is recorded on the spans of requests with revoked tokens
+var errTokenRevoked = errors.New("token has been revoked")
+
+// JWTAuthMiddleware handles JWT authentication. Verification settings can
+// be replaced at runtime with Update.
 type JWTAuthMiddleware struct {
-	config *config.AuthConfig
+	ctx         context.Context // Bounds the background refresh of JWKS keys
+	logger      *zap.Logger
+	revocations *services.RevocationStore
+	verifier    atomic.Pointer[verifier]
+}
+
+// verifier holds the settings and keys tokens are verified with
+type verifier struct {
+	config     *config.AuthConfig
+	keys       keyProvider
+	algorithms []string
+	stop       context.CancelFunc // Stops refreshing JWKS keys, nil for other keys
 }
 
 // Claims represents JWT claims
 type Claims struct {
-	UserID string `json:"user_id"`
-	Role   string `json:"role"`
+	UserID     string   `json:"-"` // Taken from the configured user ID claim
+	Role       string   `json:"role"`
+	Privileges []string `json:"privileges"`
 	jwt.RegisteredClaims
+
+	// raw holds every claim of the token that is not null
+	raw map[string]json.RawMessage
+}
+
+// UnmarshalJSON decodes the claims and records which claims are present
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	type plain Claims
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, &c.raw); err != nil {
+		return err
+	}
+	for name, value := range c.raw {
+		if string(value) == "null" {
+			delete(c.raw, name)
+		}
+	}
+	return nil
+}
+
+// Has reports whether the token carries the named claim
+func (c *Claims) Has(name string) bool {
+	_, ok := c.raw[name]
+	return ok
+}
+
+// stringClaim returns the named claim if it is a string or a number, the
+// empty string otherwise
+func (c *Claims) stringClaim(name string) string {
+	raw, ok := c.raw[name]
+	if !ok {
+		return ""
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n.String()
+	}
+	return ""
+}
+
+// User returns the ID of the user the token was issued to
+func (c *Claims) User() string {
+	if c.UserID != "" {
+		return c.UserID
+	}
+	return c.RegisteredClaims.Subject
 }
 
-// NewJWTAuthMiddleware creates a new JWT authentication middleware
-func NewJWTAuthMiddleware(config *config.AuthConfig) *JWTAuthMiddleware {
-	return &JWTAuthMiddleware{
-		config: config,
+// IssuedAtTime returns the iat claim, the zero time if absent
+func (c *Claims) IssuedAtTime() time.Time {
+	if c.IssuedAt == nil {
+		return time.Time{}
 	}
+	return c.IssuedAt.Time
+}
+
+// NewJWTAuthMiddleware creates a new JWT authentication middleware. In
+// asymmetric mode JWKS keys are refreshed in the background until ctx is done.
+// Tokens are checked against revocations unless it is nil.
+func NewJWTAuthMiddleware(ctx context.Context, cfg *config.AuthConfig, revocations *services.RevocationStore, logger *zap.Logger) (*JWTAuthMiddleware, error) {
+	m := &JWTAuthMiddleware{
+		ctx:         ctx,
+		logger:      logger,
+		revocations: revocations,
+	}
+	if err := m.Update(cfg); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Update atomically replaces the verification settings. JWKS keys are kept
+// while their endpoint is unchanged, other keys are loaded again. The current
+// settings are kept if the new keys cannot be loaded.
+func (m *JWTAuthMiddleware) Update(cfg *config.AuthConfig) error {
+	current := m.verifier.Load()
+	v := &verifier{config: cfg, algorithms: cfg.Algorithms}
+	reused := false
+
+	switch {
+	case cfg.SigningMode == config.SigningModeHMAC:
+		v.keys = hmacKey(cfg.JWTSecret)
+		v.algorithms = hmacAlgorithms
+	case cfg.PublicKeyFile != "":
+		keys, err := loadPEMKeys(cfg.PublicKeyFile)
+		if err != nil {
+			return err
+		}
+		v.keys = keys
+	case current != nil && current.stop != nil && sameJWKS(current.config, cfg):
+		v.keys, v.stop = current.keys, current.stop
+		reused = true
+	default:
+		ctx, stop := context.WithCancel(m.ctx)
+		v.keys = newRemoteKeys(ctx, cfg.JWKSEndpoint(),
+			time.Duration(cfg.JWKSRefreshIntervalSecs)*time.Second,
+			time.Duration(cfg.JWKSMinRefetchIntervalSecs)*time.Second,
+			m.logger,
+		)
+		v.stop = stop
+	}
+
+	m.verifier.Store(v)
+	if current != nil && current.stop != nil && !reused {
+		current.stop()
+	}
+	return nil
+}
+
+// sameJWKS reports whether two configurations fetch the same JWKS keys
+func sameJWKS(a, b *config.AuthConfig) bool {
+	return b.SigningMode != config.SigningModeHMAC && b.PublicKeyFile == "" &&
+		a.JWKSEndpoint() == b.JWKSEndpoint() &&
+		a.JWKSRefreshIntervalSecs == b.JWKSRefreshIntervalSecs &&
+		a.JWKSMinRefetchIntervalSecs == b.JWKSMinRefetchIntervalSecs
 }
 
 // Authenticate is the middleware function to authenticate requests
 func (m *JWTAuthMiddleware) Authenticate() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token, err := m.extractToken(c)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		ctx, span := tracing.Start(c.Request.Context(), "auth.authenticate")
+		err := m.authenticate(ctx, c)
+		tracing.End(span, err)
+
+		if err == nil {
+			c.Next()
+		}
+	}
+}
+
+// authenticate verifies the request's token and adds its claims to the
+// context. It responds and returns the reason when the request is rejected.
+func (m *JWTAuthMiddleware) authenticate(ctx context.Context, c *gin.Context) error {
+	token, err := m.extractToken(c)
+	if err != nil {
+		m.respondUnauthorized(c, ErrorCodeMissingToken, "Authentication required")
+		return err
+	}
+
+	v := m.verifier.Load()
+	claims, err := v.validateToken(token)
+	if err != nil {
+		code, message := classifyTokenError(err)
+		m.logger.Debug("token rejected",
+			zap.Error(err),
+			zap.String("code", code),
+			zap.String("path", c.Request.URL.Path),
+		)
+		m.respondUnauthorized(c, code, message)
+		return err
+	}
+
+	tokenID := services.TokenID(claims.ID, token)
+	revoked, err := m.revocations.IsRevoked(ctx, tokenID, claims.User(), claims.IssuedAtTime())
+	if err != nil {
+		m.logger.Warn("token revocation check failed", zap.Error(err))
+		if v.config.Revocation.FailClosed {
+			utils.RespondWithError(c, http.StatusServiceUnavailable, "Unable to verify token")
 			c.Abort()
-			return
+			return err
 		}
+	}
+	if revoked {
+		m.respondUnauthorized(c, ErrorCodeTokenRevoked, "Token has been revoked")
+		return errTokenRevoked
+	}
 
-		claims, err := m.validateToken(token)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+	// Add claims to context for handlers to use
+	c.Set("authenticated", true)
+	c.Set("userID", claims.User())
+	c.Set("role", claims.Role)
+	c.Set("privileges", claims.Privileges)
+	c.Set("tokenID", tokenID)
+	if claims.ExpiresAt != nil {
+		c.Set("tokenExpiresAt", claims.ExpiresAt.Time)
+	}
+	return nil
+}
+
+// Identify is the middleware marking requests whose token verifies as
+// authenticated, for the rate limits that run before Authenticate. Requests
+// without a valid token pass unchanged; rejecting them and checking
+// revocations is left to Authenticate.
+func (m *JWTAuthMiddleware) Identify() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token, _, err := findToken(c); err == nil {
+			if _, err := m.verifier.Load().validateToken(token); err == nil {
+				c.Set("authenticated", true)
+			}
+		}
+		c.Next()
+	}
+}
+
+// RequireRoles only lets authenticated requests through whose role is one of
+// roles, ignoring case. It must run after Authenticate.
+func (m *JWTAuthMiddleware) RequireRoles(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !hasRole(c.GetString("role"), roles) {
+			utils.RespondWithForbidden(c, "Insufficient role")
 			c.Abort()
 			return
 		}
-
-		// Add claims to context for handlers to use
-		c.Set("userID", claims.UserID)
-		c.Set("role", claims.Role)
 		c.Next()
 	}
 }
 
-// extractToken extracts the JWT token from the request header
+// hasRole reports whether role is one of roles. Roles are compared ignoring
+// case, issuers differ in how they spell them.
+func hasRole(role string, roles []string) bool {
+	return slices.ContainsFunc(roles, func(r string) bool {
+		return strings.EqualFold(r, role)
+	})
+}
+
+// extractToken extracts the JWT token from the request. A token passed in
+// the URL is removed from it so it is neither proxied nor logged.
 func (m *JWTAuthMiddleware) extractToken(c *gin.Context) (string, error) {
+	token, fromQuery, err := findToken(c)
+	if fromQuery {
+		utils.RemoveQueryParam(c.Request, accessTokenParam)
+	}
+	return token, err
+}
+
+// findToken returns the request's token without modifying the request, and
+// whether it was passed in the URL
+func findToken(c *gin.Context) (string, bool, error) {
 	authHeader := c.GetHeader("Authorization")
 	if authHeader == "" {
-		return "", fmt.Errorf("no authorization header")
+		// Browsers cannot set headers on WebSocket handshakes
+		if token := c.Query(accessTokenParam); token != "" && utils.IsUpgradeRequest(c.Request) {
+			return token, true, nil
+		}
+		return "", false, fmt.Errorf("no authorization header")
 	}
 
 	parts := strings.Split(authHeader, " ")
 	if len(parts) != 2 || parts[0] != "Bearer" {
-		return "", fmt.Errorf("invalid authorization header format")
+		return "", false, fmt.Errorf("invalid authorization header format")
 	}
 
-	return parts[1], nil
+	return parts[1], false, nil
 }
 
-// validateToken validates the JWT token
-func (m *JWTAuthMiddleware) validateToken(tokenString string) (*Claims, error) {
+// validateToken validates the JWT token and its claims
+func (v *verifier) validateToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(m.config.JWTSecret), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, v.keys.Key,
+		jwt.WithValidMethods(v.algorithms),
+		jwt.WithLeeway(time.Duration(v.config.LeewaySecs)*time.Second),
+		jwt.WithIssuedAt(),
+	)
 
 	if err != nil {
 		return nil, err
@@ -89,5 +335,71 @@ func (m *JWTAuthMiddleware) validateToken(tokenString string) (*Claims, error) {
 		return nil, fmt.Errorf("invalid token")
 	}
 
+	if err := v.validateClaims(claims); err != nil {
+		return nil, err
+	}
+
+	userIDClaim := v.config.UserIDClaim
+	if userIDClaim == "" {
+		userIDClaim = config.DefaultUserIDClaim
+	}
+	claims.UserID = claims.stringClaim(userIDClaim)
+
 	return claims, nil
 }
+
+// validateClaims checks the issuer, audience and required claims
+func (v *verifier) validateClaims(claims *Claims) error {
+	if len(v.config.Issuers) > 0 && !slices.Contains(v.config.Issuers, claims.Issuer) {
+		return fmt.Errorf("%w: %q", jwt.ErrTokenInvalidIssuer, claims.Issuer)
+	}
+
+	if len(v.config.Audiences) > 0 && !slices.ContainsFunc(claims.Audience, func(aud string) bool {
+		return slices.Contains(v.config.Audiences, aud)
+	}) {
+		return fmt.Errorf("%w: %v", jwt.ErrTokenInvalidAudience, claims.Audience)
+	}
+
+	for _, name := range v.config.RequiredClaims {
+		if !claims.Has(name) {
+			return fmt.Errorf("%w: %s", jwt.ErrTokenRequiredClaimMissing, name)
+		}
+	}
+
+	return nil
+}
+
+// classifyTokenError maps a validation error to an error code and message
+func classifyTokenError(err error) (string, string) {
+	switch {
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return ErrorCodeMalformedToken, "Token is malformed"
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+		return ErrorCodeInvalidSignature, "Token signature is invalid"
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ErrorCodeTokenExpired, "Token has expired"
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return ErrorCodeTokenNotYetValid, "Token is not valid yet"
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return ErrorCodeInvalidIssuer, "Token issuer is not accepted"
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return ErrorCodeInvalidAudience, "Token audience is not accepted"
+	case errors.Is(err, jwt.ErrTokenRequiredClaimMissing):
+		return ErrorCodeMissingClaim, "Token is missing a required claim"
+	default:
+		return ErrorCodeInvalidToken, "Invalid token"
+	}
+}
+
+// respondUnauthorized aborts the request with a 401 carrying an error code,
+// also advertised in the WWW-Authenticate header (RFC 6750)
+func (m *JWTAuthMiddleware) respondUnauthorized(c *gin.Context, code, message string) {
+	challenge := `Bearer realm="api-gateway"`
+	if code != ErrorCodeMissingToken {
+		challenge += fmt.Sprintf(`, error="invalid_token", error_description=%q`, message)
+	}
+	c.Header("WWW-Authenticate", challenge)
+
+	utils.RespondWithUnauthorized(c, message, utils.WithCode(code))
+	c.Abort()
+}
@@ -0,0 +1,359 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/services"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+const testSecret = "test-secret"
+
+// newHMACMiddleware creates a middleware verifying tokens signed with
+// testSecret against the claim settings of cfg
+func newHMACMiddleware(t *testing.T, cfg config.AuthConfig) *JWTAuthMiddleware {
+	t.Helper()
+
+	cfg.SigningMode = config.SigningModeHMAC
+	cfg.JWTSecret = testSecret
+	m, err := NewJWTAuthMiddleware(context.Background(), &cfg, nil, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// signHMAC signs claims with testSecret
+func signHMAC(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	return signWith(t, claims, testSecret)
+}
+
+// signWith signs claims with secret
+func signWith(t *testing.T, claims jwt.MapClaims, secret string) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestQueryTokenIsRemovedFromUpgradeRequests(t *testing.T) {
+	m := newHMACMiddleware(t, config.AuthConfig{})
+	token := signHMAC(t, jwt.MapClaims{"id": "42"})
+
+	var forwarded *http.Request
+	engine := gin.New()
+	engine.GET("/ws", m.Authenticate(), func(c *gin.Context) {
+		forwarded = c.Request
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/ws?room=lobby&access_token="+token, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, req)
+
+	if forwarded == nil {
+		t.Fatalf("status = %d, want the upgrade request authenticated", recorder.Code)
+	}
+	if forwarded.URL.RawQuery != "room=lobby" {
+		t.Errorf("query = %q, want the token removed", forwarded.URL.RawQuery)
+	}
+	if forwarded.RequestURI != "/ws?room=lobby" {
+		t.Errorf("request URI = %q, want the token removed", forwarded.RequestURI)
+	}
+}
+
+func TestQueryTokenIsIgnoredWithoutUpgrade(t *testing.T) {
+	m := newHMACMiddleware(t, config.AuthConfig{})
+	token := signHMAC(t, jwt.MapClaims{"id": "42"})
+
+	engine := gin.New()
+	engine.GET("/users", m.Authenticate(), func(c *gin.Context) {})
+
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/users?access_token="+token, nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", recorder.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	m := newHMACMiddleware(t, config.AuthConfig{})
+
+	tests := []struct {
+		name          string
+		authorization string
+		query         string
+		upgrade       bool
+		want          bool
+	}{
+		{name: "no token"},
+		{name: "valid token", authorization: "Bearer " + signHMAC(t, jwt.MapClaims{"id": "42"}), want: true},
+		{name: "forged token", authorization: "Bearer " + signWith(t, jwt.MapClaims{"id": "42"}, "other-secret")},
+		{name: "junk", authorization: "Bearer x"},
+		{name: "query token", query: signHMAC(t, jwt.MapClaims{"id": "42"}), upgrade: true, want: true},
+	}
+
+	for _, tt := range tests {
+		var authenticated bool
+		var query string
+		engine := gin.New()
+		engine.GET("/ws", m.Identify(), func(c *gin.Context) {
+			authenticated = c.GetBool("authenticated")
+			query = c.Request.URL.RawQuery
+		})
+
+		target := "/ws"
+		if tt.query != "" {
+			target += "?access_token=" + tt.query
+		}
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		if tt.upgrade {
+			req.Header.Set("Connection", "Upgrade")
+			req.Header.Set("Upgrade", "websocket")
+		}
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, req)
+
+		if recorder.Code != http.StatusOK {
+			t.Errorf("%s: status = %d, want the request passed on", tt.name, recorder.Code)
+		}
+		if authenticated != tt.want {
+			t.Errorf("%s: authenticated = %t, want %t", tt.name, authenticated, tt.want)
+		}
+		// The token stays for Authenticate to find
+		if tt.query != "" && query == "" {
+			t.Errorf("%s: query token removed", tt.name)
+		}
+	}
+}
+
+func TestClaimValidation(t *testing.T) {
+	m := newHMACMiddleware(t, config.AuthConfig{
+		Issuers:        []string{"https://auth.example.com"},
+		Audiences:      []string{"api-gateway"},
+		LeewaySecs:     30,
+		RequiredClaims: []string{"exp", "id"},
+	})
+	now := time.Now()
+
+	// claims returns valid claims with the given changes, nil values remove a claim
+	claims := func(changes jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"id":  "42",
+			"iss": "https://auth.example.com",
+			"aud": "api-gateway",
+			"iat": now.Unix(),
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		for name, value := range changes {
+			if value == nil {
+				delete(c, name)
+			} else {
+				c[name] = value
+			}
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode string
+	}{
+		{name: "valid", token: signHMAC(t, claims(nil))},
+		{name: "expired within leeway", token: signHMAC(t, claims(jwt.MapClaims{"exp": now.Add(-20 * time.Second).Unix()}))},
+		{name: "expired", token: signHMAC(t, claims(jwt.MapClaims{"exp": now.Add(-time.Minute).Unix()})), wantCode: ErrorCodeTokenExpired},
+		{name: "not before within leeway", token: signHMAC(t, claims(jwt.MapClaims{"nbf": now.Add(20 * time.Second).Unix()}))},
+		{name: "not yet valid", token: signHMAC(t, claims(jwt.MapClaims{"nbf": now.Add(time.Minute).Unix()})), wantCode: ErrorCodeTokenNotYetValid},
+		{name: "issued in the future", token: signHMAC(t, claims(jwt.MapClaims{"iat": now.Add(time.Minute).Unix()})), wantCode: ErrorCodeTokenNotYetValid},
+		{name: "other issuer", token: signHMAC(t, claims(jwt.MapClaims{"iss": "https://evil.example.com"})), wantCode: ErrorCodeInvalidIssuer},
+		{name: "no issuer", token: signHMAC(t, claims(jwt.MapClaims{"iss": nil})), wantCode: ErrorCodeInvalidIssuer},
+		{name: "one of several audiences", token: signHMAC(t, claims(jwt.MapClaims{"aud": []string{"billing", "api-gateway"}}))},
+		{name: "other audience", token: signHMAC(t, claims(jwt.MapClaims{"aud": "billing"})), wantCode: ErrorCodeInvalidAudience},
+		{name: "no audience", token: signHMAC(t, claims(jwt.MapClaims{"aud": nil})), wantCode: ErrorCodeInvalidAudience},
+		{name: "missing required claim", token: signHMAC(t, claims(jwt.MapClaims{"id": nil})), wantCode: ErrorCodeMissingClaim},
+		{name: "no expiry", token: signHMAC(t, claims(jwt.MapClaims{"exp": nil})), wantCode: ErrorCodeMissingClaim},
+		{name: "malformed", token: "not-a-token", wantCode: ErrorCodeMalformedToken},
+		{name: "other secret", token: signWith(t, claims(nil), "other-secret"), wantCode: ErrorCodeInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := authenticate(m, tt.token); got != tt.wantCode {
+				t.Errorf("code = %q, want %q", got, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestUnauthorizedChallenge(t *testing.T) {
+	m := newHMACMiddleware(t, config.AuthConfig{})
+	engine := gin.New()
+	engine.GET("/", m.Authenticate(), func(c *gin.Context) {})
+
+	tests := []struct {
+		authorization string
+		want          string
+	}{
+		{want: `Bearer realm="api-gateway"`},
+		{authorization: "Bearer not-a-token", want: `Bearer realm="api-gateway", error="invalid_token", error_description="Token is malformed"`},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, req)
+
+		if got := recorder.Header().Get("WWW-Authenticate"); got != tt.want {
+			t.Errorf("WWW-Authenticate = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestRequireRolesWithAuthServiceToken(t *testing.T) {
+	m := newHMACMiddleware(t, config.AuthConfig{})
+	engine := gin.New()
+	engine.GET("/admin", m.Authenticate(), m.RequireRoles("ADMIN"), func(c *gin.Context) {})
+	engine.GET("/lowercase", m.Authenticate(), m.RequireRoles("admin"), func(c *gin.Context) {})
+
+	// The authentication service signs {id, email, role} with uppercase roles
+	token := func(role string) string {
+		return signHMAC(t, jwt.MapClaims{
+			"id":    42,
+			"email": "jane@example.com",
+			"role":  role,
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(24 * time.Hour).Unix(),
+		})
+	}
+
+	tests := []struct {
+		path   string
+		role   string
+		status int
+	}{
+		{path: "/admin", role: "ADMIN", status: http.StatusOK},
+		{path: "/lowercase", role: "ADMIN", status: http.StatusOK},
+		{path: "/admin", role: "USER", status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set("Authorization", "Bearer "+token(tt.role))
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.status {
+			t.Errorf("%s with role %s: status = %d, want %d", tt.path, tt.role, recorder.Code, tt.status)
+		}
+	}
+}
+
+func TestUserIDClaim(t *testing.T) {
+	tests := []struct {
+		name   string
+		claim  string
+		claims jwt.MapClaims
+		want   string
+	}{
+		{name: "numeric id", claims: jwt.MapClaims{"id": 42, "sub": "ignored"}, want: "42"},
+		{name: "string id", claims: jwt.MapClaims{"id": "u-42"}, want: "u-42"},
+		{name: "subject fallback", claims: jwt.MapClaims{"sub": "u-42"}, want: "u-42"},
+		{name: "configured claim", claim: "uid", claims: jwt.MapClaims{"id": 1, "uid": "u-42"}, want: "u-42"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newHMACMiddleware(t, config.AuthConfig{UserIDClaim: tt.claim})
+
+			var userID string
+			engine := gin.New()
+			engine.GET("/", m.Authenticate(), func(c *gin.Context) {
+				userID = c.GetString("userID")
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+signHMAC(t, tt.claims))
+			engine.ServeHTTP(httptest.NewRecorder(), req)
+
+			if userID != tt.want {
+				t.Errorf("userID = %q, want %q", userID, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevokedTokens(t *testing.T) {
+	tests := []struct {
+		name       string
+		failClosed bool
+		redisDown  bool
+		jti        string
+		wantStatus int
+	}{
+		{name: "valid token", jti: "valid", wantStatus: http.StatusOK},
+		{name: "revoked token", jti: "revoked", wantStatus: http.StatusUnauthorized},
+		{name: "redis down, fail open", redisDown: true, jti: "revoked", wantStatus: http.StatusOK},
+		{name: "redis down, fail closed", failClosed: true, redisDown: true, jti: "valid", wantStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.AuthConfig{
+				SigningMode: config.SigningModeHMAC,
+				JWTSecret:   testSecret,
+				Revocation:  config.RevocationConfig{Enabled: true, FailClosed: tt.failClosed},
+			}
+			mr := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+			t.Cleanup(func() { client.Close() })
+			revocations := services.NewRevocationStore(client, cfg, zap.NewNop())
+			if err := revocations.RevokeToken(context.Background(), "revoked", time.Now().Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+
+			m, err := NewJWTAuthMiddleware(context.Background(), cfg, services.NewRevocationStore(client, cfg, zap.NewNop()), zap.NewNop())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.redisDown {
+				mr.Close()
+			}
+
+			engine := gin.New()
+			engine.GET("/", m.Authenticate(), func(c *gin.Context) {})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+signHMAC(t, jwt.MapClaims{"id": 42, "jti": tt.jti}))
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newECKey generates an ECDSA key on curve
+func newECKey(t *testing.T, curve elliptic.Curve) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// writePEM writes blocks to a PEM file and returns its path
+func writePEM(t *testing.T, blocks ...*pem.Block) string {
+	t.Helper()
+
+	var data []byte
+	for _, block := range blocks {
+		data = append(data, pem.EncodeToMemory(block)...)
+	}
+	path := filepath.Join(t.TempDir(), "keys.pem")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// publicKeyBlock encodes key as a PKIX PUBLIC KEY block
+func publicKeyBlock(t *testing.T, key interface{}) *pem.Block {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+}
+
+func TestLoadPEMKeys(t *testing.T) {
+	ecKey := newECKey(t, elliptic.P256())
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1)}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, edPublic, edPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := writePEM(t,
+		publicKeyBlock(t, &ecKey.PublicKey),
+		&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)},
+		&pem.Block{Type: "CERTIFICATE", Bytes: cert},
+	)
+	keys, err := loadPEMKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 3 {
+		t.Fatalf("loaded %d keys, want 3", len(keys))
+	}
+	if !ecKey.PublicKey.Equal(keys[0]) {
+		t.Error("PUBLIC KEY block not loaded")
+	}
+	if !rsaKey.PublicKey.Equal(keys[1]) {
+		t.Error("RSA PUBLIC KEY block not loaded")
+	}
+	if !edPublic.Equal(keys[2]) {
+		t.Error("public key of the CERTIFICATE block not loaded")
+	}
+}
+
+func TestLoadPEMKeysErrors(t *testing.T) {
+	private, err := x509.MarshalECPrivateKey(newECKey(t, elliptic.P256()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr string
+	}{
+		{name: "missing file", path: filepath.Join(t.TempDir(), "missing.pem"), wantErr: "failed to read public key file"},
+		{name: "no keys", path: writePEM(t), wantErr: "no public keys found"},
+		{name: "private key", path: writePEM(t, &pem.Block{Type: "EC PRIVATE KEY", Bytes: private}), wantErr: `unsupported PEM block "EC PRIVATE KEY"`},
+		{name: "corrupt key", path: writePEM(t, &pem.Block{Type: "PUBLIC KEY", Bytes: []byte("junk")}), wantErr: "asn1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadPEMKeys(tt.path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("loadPEMKeys error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStaticKeysMatchAlgorithm(t *testing.T) {
+	p256 := newECKey(t, elliptic.P256())
+	p384 := newECKey(t, elliptic.P384())
+	keys := staticKeys{&p256.PublicKey, &p384.PublicKey}
+
+	key, err := keys.Key(&jwt.Token{Method: jwt.SigningMethodES384})
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, ok := key.(jwt.VerificationKeySet)
+	if !ok || len(set.Keys) != 1 || !p384.PublicKey.Equal(set.Keys[0]) {
+		t.Errorf("Key(ES384) = %v, want only the P-384 key", key)
+	}
+
+	if _, err := keys.Key(&jwt.Token{Method: jwt.SigningMethodRS256}); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Key(RS256) error = %v, want %v", err, ErrUnknownKey)
+	}
+}
+
+func TestKeyMatchesAlgorithm(t *testing.T) {
+	rsaKey := &rsa.PublicKey{N: big.NewInt(1), E: 65537}
+	p256 := &newECKey(t, elliptic.P256()).PublicKey
+	p521 := &newECKey(t, elliptic.P521()).PublicKey
+	edKey := make(ed25519.PublicKey, ed25519.PublicKeySize)
+
+	tests := []struct {
+		key  interface{}
+		alg  string
+		want bool
+	}{
+		{key: rsaKey, alg: "RS256", want: true},
+		{key: rsaKey, alg: "PS512", want: true},
+		{key: rsaKey, alg: "ES256"},
+		{key: rsaKey, alg: "HS256"},
+		{key: p256, alg: "ES256", want: true},
+		{key: p256, alg: "ES384"},
+		{key: p521, alg: "ES512", want: true},
+		{key: edKey, alg: "EdDSA", want: true},
+		{key: edKey, alg: "ES256"},
+		{key: []byte("secret"), alg: "HS256"},
+	}
+
+	for _, tt := range tests {
+		if got := keyMatchesAlgorithm(tt.key, tt.alg); got != tt.want {
+			t.Errorf("keyMatchesAlgorithm(%T, %s) = %t, want %t", tt.key, tt.alg, got, tt.want)
+		}
+	}
+}
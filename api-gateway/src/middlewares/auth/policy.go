@@ -0,0 +1,152 @@
+// middleware/auth/policy.go
+
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// PolicyEnforcer authorizes authenticated requests against the role and
+// privilege policies declared in configuration. Policies can be replaced at
+// runtime with Update.
+type PolicyEnforcer struct {
+	logger   *zap.Logger
+	policies atomic.Pointer[[]policy]
+}
+
+// policy is a compiled PolicyConfig
+type policy struct {
+	pattern    string
+	segments   []string
+	methods    []string
+	roles      []string
+	privileges []string
+}
+
+// NewPolicyEnforcer creates an enforcer for the given policies
+func NewPolicyEnforcer(policies []config.PolicyConfig, logger *zap.Logger) (*PolicyEnforcer, error) {
+	pe := &PolicyEnforcer{logger: logger}
+	if err := pe.Update(policies); err != nil {
+		return nil, err
+	}
+	return pe, nil
+}
+
+// Update atomically replaces the enforced policies. The current policies
+// are kept if any of the new ones is invalid.
+func (pe *PolicyEnforcer) Update(policies []config.PolicyConfig) error {
+	compiled := make([]policy, 0, len(policies))
+	for _, cfg := range policies {
+		p, err := compilePolicy(cfg)
+		if err != nil {
+			return err
+		}
+		compiled = append(compiled, p)
+	}
+
+	pe.policies.Store(&compiled)
+	return nil
+}
+
+// Authorize is the middleware function enforcing the policies. It must run
+// after JWTAuthMiddleware.Authenticate.
+func (pe *PolicyEnforcer) Authorize() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := c.Request.Method
+		path := c.Request.URL.Path
+		role := c.GetString("role")
+		privileges := c.GetStringSlice("privileges")
+
+		for _, p := range *pe.policies.Load() {
+			if !p.matches(method, path) {
+				continue
+			}
+
+			if !p.allows(role, privileges) {
+				pe.logger.Debug("request denied by policy",
+					zap.String("policy", p.pattern),
+					zap.String("method", method),
+					zap.String("path", path),
+					zap.String("user_id", c.GetString("userID")),
+					zap.String("role", role),
+				)
+				utils.RespondWithForbidden(c, "Insufficient permissions")
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// compilePolicy splits the path pattern of a policy into segments
+func compilePolicy(cfg config.PolicyConfig) (policy, error) {
+	if !strings.HasPrefix(cfg.Path, "/") {
+		return policy{}, fmt.Errorf("policy %s: path must start with '/'", cfg.Path)
+	}
+
+	segments := strings.Split(strings.Trim(cfg.Path, "/"), "/")
+	for i, segment := range segments {
+		if segment == "**" && i != len(segments)-1 {
+			return policy{}, fmt.Errorf("policy %s: '**' is only allowed at the end of the path", cfg.Path)
+		}
+	}
+
+	methods := make([]string, len(cfg.Methods))
+	for i, method := range cfg.Methods {
+		methods[i] = strings.ToUpper(method)
+	}
+
+	return policy{
+		pattern:    cfg.Path,
+		segments:   segments,
+		methods:    methods,
+		roles:      cfg.Roles,
+		privileges: cfg.Privileges,
+	}, nil
+}
+
+// matches reports whether the policy applies to a request
+func (p policy) matches(method, path string) bool {
+	if len(p.methods) > 0 && !slices.Contains(p.methods, method) {
+		return false
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range p.segments {
+		if segment == "**" {
+			return true
+		}
+		if i >= len(parts) {
+			return false
+		}
+		if segment != "*" && !strings.HasPrefix(segment, ":") && segment != parts[i] {
+			return false
+		}
+	}
+	return len(parts) == len(p.segments)
+}
+
+// allows reports whether a caller with the given role and privileges
+// satisfies the policy. Roles are compared ignoring case.
+func (p policy) allows(role string, privileges []string) bool {
+	if len(p.roles) > 0 && !hasRole(role, p.roles) {
+		return false
+	}
+
+	for _, required := range p.privileges {
+		if !slices.Contains(privileges, required) {
+			return false
+		}
+	}
+	return true
+}
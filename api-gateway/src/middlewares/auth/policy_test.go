@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func TestPolicyMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		methods []string
+		method  string
+		path    string
+		want    bool
+	}{
+		{pattern: "/api/v1/users", method: "GET", path: "/api/v1/users", want: true},
+		{pattern: "/api/v1/users", method: "GET", path: "/api/v1/users/", want: true},
+		{pattern: "/api/v1/users", method: "GET", path: "/api/v1/users/42"},
+		{pattern: "/api/v1/users", method: "GET", path: "/api/v1/user"},
+		{pattern: "/api/v1/users/*", method: "GET", path: "/api/v1/users/42", want: true},
+		{pattern: "/api/v1/users/*", method: "GET", path: "/api/v1/users/42/orders"},
+		{pattern: "/api/v1/users/*", method: "GET", path: "/api/v1/users"},
+		{pattern: "/api/v1/users/:id/orders", method: "GET", path: "/api/v1/users/42/orders", want: true},
+		{pattern: "/api/v1/users/:id/orders", method: "GET", path: "/api/v1/users/42/payments"},
+		{pattern: "/api/v1/users/**", method: "GET", path: "/api/v1/users/42/orders/7", want: true},
+		{pattern: "/api/v1/users/**", method: "GET", path: "/api/v1/users", want: true},
+		{pattern: "/api/v1/users/**", method: "GET", path: "/api/v1/usersettings"},
+		{pattern: "/api/v1/users/**", methods: []string{"delete"}, method: "DELETE", path: "/api/v1/users/42", want: true},
+		{pattern: "/api/v1/users/**", methods: []string{"DELETE"}, method: "GET", path: "/api/v1/users/42"},
+	}
+
+	for _, tt := range tests {
+		p, err := compilePolicy(config.PolicyConfig{Path: tt.pattern, Methods: tt.methods})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.matches(tt.method, tt.path); got != tt.want {
+			t.Errorf("%s %v matches %s %s = %t, want %t", tt.pattern, tt.methods, tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCompilePolicyErrors(t *testing.T) {
+	for _, path := range []string{"api/v1/users", "/api/**/users"} {
+		if _, err := compilePolicy(config.PolicyConfig{Path: path}); err == nil {
+			t.Errorf("compilePolicy(%q) succeeded, want an error", path)
+		}
+	}
+}
+
+func TestPolicyAllows(t *testing.T) {
+	p, err := compilePolicy(config.PolicyConfig{
+		Path:       "/api/v1/appointments/**",
+		Roles:      []string{"ADMIN", "DOCTOR"},
+		Privileges: []string{"appointments:read", "appointments:write"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		role       string
+		privileges []string
+		want       bool
+	}{
+		{name: "role and all privileges", role: "DOCTOR", privileges: []string{"appointments:read", "appointments:write", "users:read"}, want: true},
+		{name: "role in another case", role: "doctor", privileges: []string{"appointments:read", "appointments:write"}, want: true},
+		{name: "other role", role: "PATIENT", privileges: []string{"appointments:read", "appointments:write"}},
+		{name: "no role", privileges: []string{"appointments:read", "appointments:write"}},
+		{name: "missing privilege", role: "ADMIN", privileges: []string{"appointments:read"}},
+	}
+
+	for _, tt := range tests {
+		if got := p.allows(tt.role, tt.privileges); got != tt.want {
+			t.Errorf("%s: allows = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	pe, err := NewPolicyEnforcer([]config.PolicyConfig{
+		{Path: "/api/v1/users/**", Methods: []string{"DELETE"}, Roles: []string{"ADMIN"}},
+		{Path: "/api/v1/users/:id", Privileges: []string{"users:write"}},
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine := gin.New()
+	engine.Use(func(c *gin.Context) {
+		c.Set("role", c.GetHeader("X-Test-Role"))
+		c.Set("privileges", c.Request.Header.Values("X-Test-Privilege"))
+	}, pe.Authorize())
+	engine.Any("/*path", func(c *gin.Context) {})
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		role      string
+		privilege string
+		want      int
+	}{
+		{name: "no matching policy", method: "GET", path: "/api/v1/appointments", want: http.StatusOK},
+		{name: "other method", method: "GET", path: "/api/v1/users", role: "USER", want: http.StatusOK},
+		{name: "every matching policy allows", method: "DELETE", path: "/api/v1/users/42", role: "ADMIN", privilege: "users:write", want: http.StatusOK},
+		{name: "role denied", method: "DELETE", path: "/api/v1/users/42", role: "USER", privilege: "users:write", want: http.StatusForbidden},
+		{name: "privilege denied", method: "DELETE", path: "/api/v1/users/42", role: "ADMIN", want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("X-Test-Role", tt.role)
+		if tt.privilege != "" {
+			req.Header.Set("X-Test-Privilege", tt.privilege)
+		}
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, recorder.Code, tt.want)
+		}
+	}
+}
+
+func TestPolicyEnforcerUpdateKeepsPoliciesOnError(t *testing.T) {
+	pe, err := NewPolicyEnforcer([]config.PolicyConfig{{Path: "/admin/**", Roles: []string{"ADMIN"}}}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pe.Update([]config.PolicyConfig{{Path: "admin"}}); err == nil {
+		t.Fatal("Update accepted an invalid policy")
+	}
+	if policies := *pe.policies.Load(); len(policies) != 1 || policies[0].pattern != "/admin/**" {
+		t.Errorf("policies = %v, want the previous policies", policies)
+	}
+}
@@ -0,0 +1,407 @@
+// middlewares/httpcache/cache.go
+
+package httpcache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/metrics"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// ErrCacheDisabled is returned when purging without a response cache
+var ErrCacheDisabled = errors.New("response cache is disabled")
+
+// Values of the X-Cache response header
+const (
+	cacheHit         = "HIT"
+	cacheStale       = "STALE"
+	cacheRevalidated = "REVALIDATED"
+	cacheMiss        = "MISS"
+)
+
+// defaultMaxBodyBytes bounds cached bodies when no limit is configured
+const defaultMaxBodyBytes = 1 << 20
+
+// ResponseCache is an HTTP cache for GET requests to proxied routes. It
+// honors the Cache-Control, Expires, ETag and Vary headers of backends, serves
+// stale responses while revalidating them and can be purged by key (the
+// request URI) or by the tags of the Surrogate-Key response header.
+type ResponseCache struct {
+	tiers        []store // Fastest first
+	maxBodyBytes int
+	defaults     routePolicy
+	collector    *metrics.Collector
+	logger       *zap.Logger
+
+	revalidating sync.Map       // Keys being refreshed in the background
+	refreshes    sync.WaitGroup // Background refreshes, waited for in tests
+}
+
+// routePolicy holds the cache settings in effect for a route
+type routePolicy struct {
+	ttl                  time.Duration // Replaces the backend's freshness when set
+	defaultTTL           time.Duration
+	staleWhileRevalidate time.Duration
+}
+
+// NewResponseCache creates a response cache. client is only used by the
+// redis and tiered stores.
+func NewResponseCache(cfg *config.CacheConfig, client redis.Cmdable, collector *metrics.Collector, logger *zap.Logger) *ResponseCache {
+	maxBodyBytes := cfg.MaxBodyBytes
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = defaultMaxBodyBytes
+	}
+
+	return &ResponseCache{
+		tiers:        newStores(cfg, client),
+		maxBodyBytes: maxBodyBytes,
+		defaults: routePolicy{
+			defaultTTL:           time.Duration(cfg.DefaultTTLSecs) * time.Second,
+			staleWhileRevalidate: time.Duration(cfg.StaleWhileRevalidateSecs) * time.Second,
+		},
+		collector: collector,
+		logger:    logger,
+	}
+}
+
+// Handler returns the middleware caching the responses of a route. It must
+// run after authentication, right in front of the proxy handler: background
+// refreshes call that last handler directly.
+func (rc *ResponseCache) Handler(route config.RouteConfig) gin.HandlerFunc {
+	if rc == nil || route.Cache.Disabled {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	policy := rc.defaults
+	policy.ttl = time.Duration(route.Cache.TTLSecs) * time.Second
+	if route.Cache.StaleWhileRevalidateSecs > 0 {
+		policy.staleWhileRevalidate = time.Duration(route.Cache.StaleWhileRevalidateSecs) * time.Second
+	}
+
+	return func(c *gin.Context) {
+		if !isCacheableRequest(c.Request) {
+			c.Next()
+			return
+		}
+
+		key := c.Request.URL.RequestURI()
+		cached, tier := rc.lookup(c.Request.Context(), key, c.Request)
+		now := time.Now()
+
+		if cached != nil && !mustRevalidate(c.Request) {
+			if now.Before(cached.FreshUntil) {
+				rc.collector.RecordCacheHit(tier)
+				rc.serve(c, cached, cacheHit)
+				c.Abort()
+				return
+			}
+			if now.Before(cached.StaleUntil) {
+				rc.collector.RecordCacheHit(tier)
+				rc.serve(c, cached, cacheStale)
+				rc.refresh(c, key, cached, policy)
+				c.Abort()
+				return
+			}
+		}
+
+		rc.collector.RecordCacheMiss(rc.tiers[len(rc.tiers)-1].name())
+		rc.fetch(c, key, cached, policy)
+	}
+}
+
+// Purge removes the responses cached under the given keys (request URIs,
+// including all their variants) and those tagged with any of the tags
+func (rc *ResponseCache) Purge(ctx context.Context, keys, tags []string) error {
+	if rc == nil {
+		return ErrCacheDisabled
+	}
+
+	// Variants are purged through the tag they are stored with
+	purgedTags := slices.Clone(tags)
+	for _, key := range keys {
+		purgedTags = append(purgedTags, variantTag(key))
+	}
+
+	var errs []error
+	for _, tier := range rc.tiers {
+		errs = append(errs, tier.purgeKeys(ctx, keys), tier.purgeTags(ctx, purgedTags))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	rc.logger.Info("response cache purged", zap.Strings("keys", keys), zap.Strings("tags", tags))
+	return nil
+}
+
+// lookup finds the response cached for a request, resolving variants, and
+// returns it with the name of the tier it came from. Responses found in a
+// slower tier are copied to the faster ones.
+func (rc *ResponseCache) lookup(ctx context.Context, key string, req *http.Request) (*entry, string) {
+	for i, tier := range rc.tiers {
+		e, err := tier.get(ctx, key)
+		if err == nil && e != nil && e.isMarker() {
+			e, err = tier.get(ctx, variantKey(key, e.Vary, req))
+		}
+		if err != nil {
+			rc.logger.Warn("response cache lookup failed", zap.String("store", tier.name()), zap.Error(err))
+			continue
+		}
+		if e == nil {
+			continue
+		}
+
+		if i > 0 {
+			ttl := time.Until(e.StaleUntil)
+			for _, faster := range rc.tiers[:i] {
+				rc.write(ctx, faster, key, e, req, ttl)
+			}
+		}
+		return e, tier.name()
+	}
+	return nil, ""
+}
+
+// fetch forwards a request the cache cannot answer and stores the response.
+// A stale response with validators is revalidated with a conditional
+// request, unless the client sent its own.
+func (rc *ResponseCache) fetch(c *gin.Context, key string, stale *entry, policy routePolicy) {
+	conditional := c.GetHeader("If-None-Match") != "" || c.GetHeader("If-Modified-Since") != ""
+	if stale == nil || !stale.hasValidators() || conditional {
+		// Headers set by earlier middleware are not part of the response
+		own := c.Writer.Header().Clone()
+		rec := newRecorder(c.Writer, recordTee, rc.maxBodyBytes)
+		c.Writer.Header().Set("X-Cache", cacheMiss)
+		c.Writer = rec
+		c.Next()
+		c.Writer = rec.ResponseWriter
+
+		if !conditional && rec.complete() {
+			header := rec.Header().Clone()
+			for name := range own {
+				header.Del(name)
+			}
+			header.Del("X-Cache")
+			rc.store(c.Request.Context(), key, c.Request, rec.status, header, rec.body.Bytes(), policy)
+		}
+		return
+	}
+
+	setValidators(c.Request, stale)
+	rec := newRecorder(c.Writer, recordHold, rc.maxBodyBytes)
+	c.Writer = rec
+	c.Next()
+	c.Writer = rec.ResponseWriter
+
+	if rec.status == http.StatusNotModified {
+		refreshed := rc.revalidated(c.Request.Context(), key, c.Request, stale, rec.header, policy)
+		rc.serve(c, refreshed, cacheRevalidated)
+		return
+	}
+
+	if !rec.complete() {
+		// Already streamed to the client
+		return
+	}
+	rc.store(c.Request.Context(), key, c.Request, rec.status, rec.header, rec.body.Bytes(), policy)
+	rc.replay(c, rec, cacheMiss)
+}
+
+// refresh revalidates a stale response that was just served. The client
+// already has its response, so the request's final handler runs in the
+// background on a copy of the context, detached from the client, and its
+// result is only stored. Only one refresh per key runs at a time.
+func (rc *ResponseCache) refresh(c *gin.Context, key string, stale *entry, policy routePolicy) {
+	if _, busy := rc.revalidating.LoadOrStore(key, struct{}{}); busy {
+		return
+	}
+
+	// The gin context is reused once the request completes, keep only copies
+	handler := c.Handler()
+	bg := c.Copy()
+	ctx := context.WithoutCancel(c.Request.Context())
+	bg.Request = c.Request.Clone(ctx)
+	bg.Request.Body = http.NoBody
+	if stale.hasValidators() {
+		setValidators(bg.Request, stale)
+	} else {
+		// A 304 to the client's own validators would not refresh the entry
+		bg.Request.Header.Del("If-None-Match")
+		bg.Request.Header.Del("If-Modified-Since")
+	}
+	rec := newRecorder(bg.Writer, recordDiscard, rc.maxBodyBytes)
+	bg.Writer = rec
+
+	rc.refreshes.Add(1)
+	go func() {
+		defer rc.refreshes.Done()
+		defer rc.revalidating.Delete(key)
+
+		handler(bg)
+
+		if rec.status == http.StatusNotModified {
+			rc.revalidated(ctx, key, bg.Request, stale, rec.header, policy)
+			return
+		}
+		if rec.complete() {
+			rc.store(ctx, key, bg.Request, rec.status, rec.header, rec.body.Bytes(), policy)
+		}
+	}()
+}
+
+// revalidated updates a stored response with the headers of a 304 answer
+// to a conditional request and stores it again
+func (rc *ResponseCache) revalidated(ctx context.Context, key string, req *http.Request, stale *entry, header http.Header, policy routePolicy) *entry {
+	merged := stale.Header.Clone()
+	for name, values := range header {
+		if name == "Content-Length" || utils.IsHopByHopHeader(name) {
+			continue
+		}
+		merged[name] = values
+	}
+
+	if refreshed := rc.store(ctx, key, req, stale.Status, merged, stale.Body, policy); refreshed != nil {
+		return refreshed
+	}
+	return stale
+}
+
+// store caches a response if it is cacheable and returns the stored entry
+func (rc *ResponseCache) store(ctx context.Context, key string, req *http.Request, status int, header http.Header, body []byte, policy routePolicy) *entry {
+	if !cacheableStatus[status] || header.Get("Set-Cookie") != "" {
+		return nil
+	}
+
+	vary := varyHeaders(header)
+	if len(vary) == 1 && vary[0] == "*" {
+		return nil
+	}
+
+	lifetime, staleWindow, ok := freshness(header, req.Header.Get("Authorization") != "", policy)
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	e := &entry{
+		Status:   status,
+		Header:   header,
+		Body:     body,
+		Vary:     vary,
+		Tags:     surrogateKeys(header),
+		StoredAt: now.Add(-initialAge(header)),
+	}
+	e.FreshUntil = e.StoredAt.Add(lifetime)
+	e.StaleUntil = e.FreshUntil.Add(staleWindow)
+
+	// Keep entries with validators a while longer to revalidate them cheaply
+	ttl := time.Until(e.StaleUntil)
+	if e.hasValidators() {
+		ttl += lifetime
+	}
+	if ttl <= 0 {
+		return nil
+	}
+
+	for _, tier := range rc.tiers {
+		rc.write(ctx, tier, key, e, req, ttl)
+	}
+	return e
+}
+
+// write stores an entry in a tier, under its variant key when it varies
+func (rc *ResponseCache) write(ctx context.Context, tier store, key string, e *entry, req *http.Request, ttl time.Duration) {
+	var err error
+	if len(e.Vary) > 0 {
+		marker := &entry{Vary: e.Vary, StoredAt: e.StoredAt, FreshUntil: e.FreshUntil, StaleUntil: e.StaleUntil}
+		if err = tier.set(ctx, key, marker, ttl); err == nil {
+			err = tier.set(ctx, variantKey(key, e.Vary, req), withTag(e, variantTag(key)), ttl)
+		}
+	} else {
+		err = tier.set(ctx, key, e, ttl)
+	}
+
+	if err != nil {
+		rc.logger.Warn("failed to cache response",
+			zap.String("store", tier.name()),
+			zap.String("key", key),
+			zap.Error(err),
+		)
+	}
+}
+
+// serve answers a request with a cached response, or with 304 Not Modified
+// when it matches the client's validators
+func (rc *ResponseCache) serve(c *gin.Context, e *entry, state string) {
+	header := c.Writer.Header()
+	for name, values := range e.Header {
+		header[name] = values
+	}
+	header.Set("Age", strconv.Itoa(int(e.age(time.Now()).Seconds())))
+	header.Set("X-Cache", state)
+
+	// After a revalidation the request carries the cache's validators, not the client's
+	if state != cacheRevalidated && e.Status == http.StatusOK && utils.IsNotModified(c.Request, e.Header) {
+		header.Del("Content-Length")
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Status(e.Status)
+	if _, err := c.Writer.Write(e.Body); err != nil {
+		rc.logger.Debug("failed to write cached response", zap.Error(err))
+	}
+}
+
+// replay writes a held response to the client
+func (rc *ResponseCache) replay(c *gin.Context, rec *recorder, state string) {
+	header := c.Writer.Header()
+	for name, values := range rec.header {
+		header[name] = values
+	}
+	header.Set("X-Cache", state)
+
+	c.Status(rec.status)
+	if _, err := c.Writer.Write(rec.body.Bytes()); err != nil {
+		rc.logger.Debug("failed to write response", zap.Error(err))
+	}
+}
+
+// isCacheableRequest reports whether the cache may answer a request
+func isCacheableRequest(req *http.Request) bool {
+	if req.Method != http.MethodGet || utils.IsUpgradeRequest(req) {
+		return false
+	}
+	return !parseCacheControl(req.Header.Values("Cache-Control")).has("no-store")
+}
+
+// mustRevalidate reports whether the client refuses cached responses that
+// have not been revalidated
+func mustRevalidate(req *http.Request) bool {
+	cc := parseCacheControl(req.Header.Values("Cache-Control"))
+	if maxAge, ok := cc.seconds("max-age"); ok && maxAge == 0 {
+		return true
+	}
+	return cc.has("no-cache") || req.Header.Get("Pragma") == "no-cache"
+}
+
+// setValidators turns a request into a conditional request for a stored response
+func setValidators(req *http.Request, e *entry) {
+	if etag := e.Header.Get("ETag"); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := e.Header.Get("Last-Modified"); lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+}
@@ -0,0 +1,378 @@
+package httpcache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/metrics"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// backend is a fake upstream answering with fixed headers and counting calls
+type backend struct {
+	header http.Header
+	calls  int
+	last   *http.Request
+	hold   chan struct{} // Delays answers until closed when set
+}
+
+func (b *backend) handle(c *gin.Context) {
+	if b.hold != nil {
+		<-b.hold
+	}
+	b.calls++
+	b.last = c.Request.Clone(context.Background())
+
+	etag := b.header.Get("ETag")
+	if etag != "" && c.GetHeader("If-None-Match") == etag {
+		c.Header("Cache-Control", b.header.Get("Cache-Control"))
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	for name, values := range b.header {
+		for _, value := range values {
+			c.Writer.Header().Add(name, value)
+		}
+	}
+	c.String(http.StatusOK, "body %d for %s", b.calls, c.GetHeader("Accept-Language"))
+}
+
+// newTestCache serves a route through a cache backed by cfg. A Redis
+// stand-in is started for the redis and tiered stores.
+func newTestCache(t *testing.T, cfg config.CacheConfig, route config.RouteConfig, b *backend) (*ResponseCache, *gin.Engine) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	var client redis.Cmdable
+	if cfg.Store != config.CacheStoreLocal {
+		mr := miniredis.RunT(t)
+		rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { rdb.Close() })
+		client = rdb
+	}
+
+	if cfg.LocalEntries == 0 {
+		cfg.LocalEntries = 100
+	}
+	rc := NewResponseCache(&cfg, client, metrics.NewCollector(prometheus.NewRegistry()), zap.NewNop())
+
+	engine := gin.New()
+	engine.GET("/*path", rc.Handler(route), b.handle)
+	return rc, engine
+}
+
+// get sends a GET request with optional headers as name, value pairs
+func get(engine *gin.Engine, path string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestCacheServesFreshResponses(t *testing.T) {
+	for _, store := range []string{config.CacheStoreLocal, config.CacheStoreRedis, config.CacheStoreTiered} {
+		t.Run(store, func(t *testing.T) {
+			b := &backend{header: headers("Cache-Control", "max-age=60")}
+			_, engine := newTestCache(t, config.CacheConfig{Store: store}, config.RouteConfig{}, b)
+
+			first := get(engine, "/items?page=1")
+			if got := first.Header().Get("X-Cache"); got != cacheMiss {
+				t.Errorf("first X-Cache = %q, want %s", got, cacheMiss)
+			}
+
+			second := get(engine, "/items?page=1")
+			if got := second.Header().Get("X-Cache"); got != cacheHit {
+				t.Errorf("second X-Cache = %q, want %s", got, cacheHit)
+			}
+			if second.Body.String() != first.Body.String() {
+				t.Errorf("cached body = %q, want %q", second.Body, first.Body)
+			}
+			if second.Header().Get("Age") == "" {
+				t.Error("cached response has no Age header")
+			}
+
+			// The query is part of the key
+			get(engine, "/items?page=2")
+			if b.calls != 2 {
+				t.Errorf("backend called %d times, want 2", b.calls)
+			}
+		})
+	}
+}
+
+func TestCacheSkipsUncacheableResponses(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  http.Header
+		request []string
+	}{
+		{name: "no-store", header: headers("Cache-Control", "no-store, max-age=60")},
+		{name: "private", header: headers("Cache-Control", "private, max-age=60")},
+		{name: "no freshness", header: headers()},
+		{name: "set-cookie", header: headers("Cache-Control", "max-age=60", "Set-Cookie", "a=b")},
+		{name: "vary *", header: headers("Cache-Control", "max-age=60", "Vary", "*")},
+		{name: "authorized", header: headers("Cache-Control", "max-age=60"), request: []string{"Authorization", "Bearer x"}},
+		{name: "request no-store", header: headers("Cache-Control", "max-age=60"), request: []string{"Cache-Control", "no-store"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &backend{header: tt.header}
+			_, engine := newTestCache(t, config.CacheConfig{Store: config.CacheStoreLocal}, config.RouteConfig{}, b)
+
+			get(engine, "/items", tt.request...)
+			get(engine, "/items", tt.request...)
+			if b.calls != 2 {
+				t.Errorf("backend called %d times, want 2", b.calls)
+			}
+		})
+	}
+}
+
+func TestCacheSharesPublicAuthorizedResponses(t *testing.T) {
+	b := &backend{header: headers("Cache-Control", "public, max-age=60")}
+	_, engine := newTestCache(t, config.CacheConfig{Store: config.CacheStoreLocal}, config.RouteConfig{}, b)
+
+	get(engine, "/items", "Authorization", "Bearer x")
+	if got := get(engine, "/items", "Authorization", "Bearer y").Header().Get("X-Cache"); got != cacheHit {
+		t.Errorf("X-Cache = %q, want %s", got, cacheHit)
+	}
+}
+
+func TestCacheRouteOverrides(t *testing.T) {
+	b := &backend{header: headers()}
+	route := config.RouteConfig{Cache: config.RouteCacheConfig{TTLSecs: 60}}
+	_, engine := newTestCache(t, config.CacheConfig{Store: config.CacheStoreLocal}, route, b)
+
+	get(engine, "/items")
+	if got := get(engine, "/items").Header().Get("X-Cache"); got != cacheHit {
+		t.Errorf("X-Cache = %q, want %s with a route TTL", got, cacheHit)
+	}
+
+	disabled := config.RouteConfig{Cache: config.RouteCacheConfig{Disabled: true, TTLSecs: 60}}
+	_, engine = newTestCache(t, config.CacheConfig{Store: config.CacheStoreLocal}, disabled, b)
+	if got := get(engine, "/items").Header().Get("X-Cache"); got != "" {
+		t.Errorf("X-Cache = %q on a route without caching", got)
+	}
+}
+
+func TestCacheVary(t *testing.T) {
+	b := &backend{header: headers("Cache-Control", "max-age=60", "Vary", "Accept-Language")}
+	_, engine := newTestCache(t, config.CacheConfig{Store: config.CacheStoreTiered}, config.RouteConfig{}, b)
+
+	en := get(engine, "/items", "Accept-Language", "en")
+	de := get(engine, "/items", "Accept-Language", "de")
+	if en.Body.String() == de.Body.String() {
+		t.Fatalf("variants share the body %q", en.Body)
+	}
+
+	if got := get(engine, "/items", "Accept-Language", "de"); got.Body.String() != de.Body.String() {
+		t.Errorf("de variant = %q, want %q", got.Body, de.Body)
+	}
+	if got := get(engine, "/items", "Accept-Language", "en"); got.Body.String() != en.Body.String() {
+		t.Errorf("en variant = %q, want %q", got.Body, en.Body)
+	}
+	if b.calls != 2 {
+		t.Errorf("backend called %d times, want 2", b.calls)
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	// The backend's responses arrive stale but within stale-while-revalidate
+	b := &backend{header: headers("Cache-Control", "max-age=10, stale-while-revalidate=30", "Age", "10", "ETag", `"v1"`)}
+	rc, engine := newTestCache(t, config.CacheConfig{Store: config.CacheStoreLocal}, config.RouteConfig{}, b)
+
+	first := get(engine, "/items")
+
+	// The stale response is served without waiting for the backend
+	b.hold = make(chan struct{})
+	stale := get(engine, "/items")
+	if got := stale.Header().Get("X-Cache"); got != cacheStale {
+		t.Errorf("X-Cache = %q, want %s", got, cacheStale)
+	}
+	if stale.Body.String() != first.Body.String() {
+		t.Errorf("stale body = %q, want %q", stale.Body, first.Body)
+	}
+	close(b.hold)
+	rc.refreshes.Wait()
+
+	// The stale response was refreshed in the background with a conditional request
+	if b.calls != 2 {
+		t.Fatalf("backend called %d times, want 2", b.calls)
+	}
+	if got := b.last.Header.Get("If-None-Match"); got != `"v1"` {
+		t.Errorf("refresh If-None-Match = %q, want the stored ETag", got)
+	}
+}
+
+func TestCacheRevalidatesExpiredResponses(t *testing.T) {
+	b := &backend{header: headers("Cache-Control", "max-age=10", "Age", "10", "ETag", `"v1"`)}
+	_, engine := newTestCache(t, config.CacheConfig{Store: config.CacheStoreLocal}, config.RouteConfig{}, b)
+
+	first := get(engine, "/items")
+
+	// The backend answers 304 and the stored body is served
+	w := get(engine, "/items")
+	if got := w.Header().Get("X-Cache"); got != cacheRevalidated {
+		t.Errorf("X-Cache = %q, want %s", got, cacheRevalidated)
+	}
+	if w.Code != http.StatusOK || w.Body.String() != first.Body.String() {
+		t.Errorf("response = %d %q, want 200 %q", w.Code, w.Body, first.Body)
+	}
+
+	// A changed response replaces the stored one
+	b.header.Set("ETag", `"v2"`)
+	w = get(engine, "/items")
+	if got := w.Header().Get("X-Cache"); got != cacheMiss {
+		t.Errorf("X-Cache = %q, want %s", got, cacheMiss)
+	}
+	if w.Body.String() != "body 3 for " {
+		t.Errorf("body = %q, want the new response", w.Body)
+	}
+}
+
+func TestCacheAnswersConditionalRequests(t *testing.T) {
+	b := &backend{header: headers("Cache-Control", "max-age=60", "ETag", `"v1"`)}
+	_, engine := newTestCache(t, config.CacheConfig{Store: config.CacheStoreLocal}, config.RouteConfig{}, b)
+
+	get(engine, "/items")
+	w := get(engine, "/items", "If-None-Match", `"v1"`)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("response = %d %q, want 304 without body", w.Code, w.Body)
+	}
+	if got := w.Header().Get("X-Cache"); got != cacheHit {
+		t.Errorf("X-Cache = %q, want %s", got, cacheHit)
+	}
+	if w := get(engine, "/items", "If-None-Match", `"v0"`); w.Code != http.StatusOK {
+		t.Errorf("status = %d for a changed response, want 200", w.Code)
+	}
+	if b.calls != 1 {
+		t.Errorf("backend called %d times, want 1", b.calls)
+	}
+}
+
+func TestCacheSkipsLargeResponses(t *testing.T) {
+	b := &backend{header: headers("Cache-Control", "max-age=60")}
+	_, engine := newTestCache(t, config.CacheConfig{Store: config.CacheStoreLocal, MaxBodyBytes: 4}, config.RouteConfig{}, b)
+
+	w := get(engine, "/items")
+	if w.Body.String() != "body 1 for " {
+		t.Errorf("body = %q, want it complete", w.Body)
+	}
+	get(engine, "/items")
+	if b.calls != 2 {
+		t.Errorf("backend called %d times, want 2", b.calls)
+	}
+}
+
+func TestCachePurge(t *testing.T) {
+	for _, store := range []string{config.CacheStoreLocal, config.CacheStoreTiered} {
+		t.Run(store, func(t *testing.T) {
+			b := &backend{header: headers("Cache-Control", "max-age=60", "Surrogate-Key", "items all")}
+			rc, engine := newTestCache(t, config.CacheConfig{Store: store}, config.RouteConfig{}, b)
+
+			for _, path := range []string{"/items/1", "/items/2", "/items/3"} {
+				get(engine, path)
+			}
+
+			if err := rc.Purge(context.Background(), []string{"/items/1"}, nil); err != nil {
+				t.Fatal(err)
+			}
+			assertCached(t, engine, "/items/1", false)
+			assertCached(t, engine, "/items/2", true)
+
+			if err := rc.Purge(context.Background(), nil, []string{"items"}); err != nil {
+				t.Fatal(err)
+			}
+			assertCached(t, engine, "/items/2", false)
+			assertCached(t, engine, "/items/3", false)
+
+			// Responses stored after the purge are cached again
+			assertCached(t, engine, "/items/3", true)
+		})
+	}
+}
+
+func TestCachePurgeVariants(t *testing.T) {
+	for _, store := range []string{config.CacheStoreLocal, config.CacheStoreRedis, config.CacheStoreTiered} {
+		t.Run(store, func(t *testing.T) {
+			b := &backend{header: headers("Cache-Control", "max-age=60", "Vary", "Accept-Language")}
+			rc, engine := newTestCache(t, config.CacheConfig{Store: store}, config.RouteConfig{}, b)
+
+			get(engine, "/items", "Accept-Language", "en")
+			get(engine, "/items", "Accept-Language", "de")
+			if err := rc.Purge(context.Background(), []string{"/items"}, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			// Caching a variant again must not bring back the others
+			get(engine, "/items", "Accept-Language", "en")
+			if got := get(engine, "/items", "Accept-Language", "de"); got.Header().Get("X-Cache") != cacheMiss {
+				t.Errorf("X-Cache = %q for a purged variant, want %s", got.Header().Get("X-Cache"), cacheMiss)
+			}
+			if b.calls != 4 {
+				t.Errorf("backend called %d times, want 4", b.calls)
+			}
+		})
+	}
+}
+
+func TestLocalStoreForgetsOldPurges(t *testing.T) {
+	s := newLocalStore(10, time.Millisecond)
+	ctx := context.Background()
+	if err := s.set(ctx, "/items", &entry{Status: http.StatusOK, Tags: []string{"items"}}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.purgeTags(ctx, []string{"items"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every entry the first purge applied to has expired by now
+	time.Sleep(5 * time.Millisecond)
+	if err := s.purgeTags(ctx, []string{"orders"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.purged["items"]; ok || len(s.purged) != 1 {
+		t.Errorf("purged = %v, want only the latest purge", s.purged)
+	}
+}
+
+func TestPurgeDisabledCache(t *testing.T) {
+	var rc *ResponseCache
+	if err := rc.Purge(context.Background(), []string{"/items"}, nil); err != ErrCacheDisabled {
+		t.Errorf("Purge error = %v, want ErrCacheDisabled", err)
+	}
+}
+
+// assertCached checks whether a path is answered from the cache
+func assertCached(t *testing.T, engine *gin.Engine, path string, want bool) {
+	t.Helper()
+
+	w := get(engine, path)
+	if got := w.Header().Get("X-Cache") == cacheHit; got != want {
+		t.Errorf("%s cached = %v, want %v (X-Cache %s, Age %s)", path, got, want,
+			w.Header().Get("X-Cache"), strconv.Quote(w.Header().Get("Age")))
+	}
+}
+
+// headers builds a header from name, value pairs
+func headers(pairs ...string) http.Header {
+	header := make(http.Header)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		header.Add(pairs[i], pairs[i+1])
+	}
+	return header
+}
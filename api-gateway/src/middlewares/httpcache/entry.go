@@ -0,0 +1,202 @@
+// middlewares/httpcache/entry.go
+
+package httpcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheableStatus lists the response statuses that may be cached
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+// entry is a cached response. An entry with Vary and no status is a marker
+// pointing lookups to the variant selected by the request headers.
+type entry struct {
+	Status     int         `json:"status,omitempty"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       []byte      `json:"body,omitempty"`
+	Vary       []string    `json:"vary,omitempty"` // Request headers selecting the variant
+	Tags       []string    `json:"tags,omitempty"` // Surrogate keys for purging
+	StoredAt   time.Time   `json:"stored_at"`      // When the response was generated
+	FreshUntil time.Time   `json:"fresh_until"`
+	StaleUntil time.Time   `json:"stale_until"` // End of stale-while-revalidate
+}
+
+// isMarker reports whether the entry only points to its variants
+func (e *entry) isMarker() bool {
+	return e.Status == 0 && len(e.Vary) > 0
+}
+
+// hasValidators reports whether the entry can be revalidated with a
+// conditional request
+func (e *entry) hasValidators() bool {
+	return e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != ""
+}
+
+// age returns the time since the response was generated
+func (e *entry) age(now time.Time) time.Duration {
+	return max(0, now.Sub(e.StoredAt))
+}
+
+// cacheControl holds the directives of a Cache-Control header
+type cacheControl map[string]string
+
+// parseCacheControl parses the directives of Cache-Control header values
+func parseCacheControl(values []string) cacheControl {
+	cc := cacheControl{}
+	for _, value := range values {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name == "" {
+				continue
+			}
+			cc[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return cc
+}
+
+// has reports whether a directive is present
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+// seconds returns the delta-seconds argument of a directive
+func (cc cacheControl) seconds(name string) (time.Duration, bool) {
+	arg, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	secs, err := strconv.Atoi(arg)
+	if err != nil || secs < 0 {
+		return 0, false
+	}
+	return time.Duration(secs) * time.Second, true
+}
+
+// freshness derives how long a response stays fresh and how long after that
+// it may be served stale while revalidating. ok is false when the response
+// must not be stored by a shared cache.
+func freshness(header http.Header, authorized bool, p routePolicy) (lifetime, staleWindow time.Duration, ok bool) {
+	cc := parseCacheControl(header.Values("Cache-Control"))
+	if cc.has("no-store") || cc.has("private") || cc.has("no-cache") {
+		return 0, 0, false
+	}
+
+	// Responses to authorized requests are only shared when marked so
+	if authorized && !cc.has("public") && !cc.has("s-maxage") && !cc.has("must-revalidate") {
+		return 0, 0, false
+	}
+
+	switch {
+	case p.ttl > 0:
+		lifetime = p.ttl
+	case cc.has("s-maxage"):
+		lifetime, _ = cc.seconds("s-maxage")
+	case cc.has("max-age"):
+		lifetime, _ = cc.seconds("max-age")
+	case header.Get("Expires") != "":
+		// Invalid dates, such as 0, mean already expired
+		expires, err := http.ParseTime(header.Get("Expires"))
+		if err == nil {
+			date, err := http.ParseTime(header.Get("Date"))
+			if err != nil {
+				date = time.Now()
+			}
+			lifetime = expires.Sub(date)
+		}
+	default:
+		lifetime = p.defaultTTL
+	}
+
+	if lifetime <= 0 {
+		return 0, 0, false
+	}
+
+	if !cc.has("must-revalidate") && !cc.has("proxy-revalidate") {
+		staleWindow, ok = cc.seconds("stale-while-revalidate")
+		if !ok {
+			staleWindow = p.staleWhileRevalidate
+		}
+	}
+	return lifetime, staleWindow, true
+}
+
+// initialAge returns the age of a response when it was received
+func initialAge(header http.Header) time.Duration {
+	secs, err := strconv.Atoi(header.Get("Age"))
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// varyHeaders returns the request headers named by the Vary header of a
+// response, in canonical form. "*" is returned as is.
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return []string{"*"}
+			}
+			if name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// surrogateKeys returns the tags a response is purgeable by
+func surrogateKeys(header http.Header) []string {
+	return strings.Fields(strings.Join(header.Values("Surrogate-Key"), " "))
+}
+
+// variantTag returns the tag the variants of the response cached under key
+// are stored with. Surrogate keys cannot contain spaces, so it never clashes
+// with a backend's tags.
+func variantTag(key string) string {
+	return "variants " + key
+}
+
+// withTag returns a copy of the entry carrying tag
+func withTag(e *entry, tag string) *entry {
+	if slices.Contains(e.Tags, tag) {
+		return e
+	}
+	tagged := *e
+	tagged.Tags = append(slices.Clone(e.Tags), tag)
+	return &tagged
+}
+
+// variantKey returns the key of the variant of a response selected by the
+// request headers named in vary
+func variantKey(key string, vary []string, req *http.Request) string {
+	h := sha256.New()
+	for _, name := range vary {
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+		h.Write([]byte(strings.Join(req.Header.Values(name), ",")))
+		h.Write([]byte{0})
+	}
+	return key + "#" + hex.EncodeToString(h.Sum(nil)[:16])
+}
@@ -0,0 +1,128 @@
+// middlewares/httpcache/recorder.go
+
+package httpcache
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Recording modes
+const (
+	recordTee     = iota // Write through to the client while capturing
+	recordHold           // Hold the response back, writing through once it outgrows the limit
+	recordDiscard        // Hold the response back, never writing to the client
+)
+
+// recorder captures the response of the handlers behind the cache, up to
+// limit bytes of body
+type recorder struct {
+	gin.ResponseWriter
+	mode     int
+	limit    int
+	header   http.Header // Headers of held responses
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+// newRecorder wraps w
+func newRecorder(w gin.ResponseWriter, mode, limit int) *recorder {
+	r := &recorder{ResponseWriter: w, mode: mode, limit: limit, status: http.StatusOK}
+	if mode != recordTee {
+		r.header = make(http.Header)
+	}
+	return r
+}
+
+func (r *recorder) Header() http.Header {
+	if r.header != nil {
+		return r.header
+	}
+	return r.ResponseWriter.Header()
+}
+
+func (r *recorder) WriteHeader(code int) {
+	r.status = code
+	if r.mode == recordTee {
+		r.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (r *recorder) WriteHeaderNow() {
+	if r.mode == recordTee {
+		r.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	if r.mode != recordTee && !r.overflow && r.body.Len()+len(p) > r.limit {
+		r.overflow = true
+		if r.mode == recordHold {
+			// Too large to cache, stream the rest to the client
+			if err := r.release(); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	switch {
+	case r.mode == recordTee:
+		r.capture(p)
+		return r.ResponseWriter.Write(p)
+	case r.overflow:
+		return len(p), nil
+	default:
+		return r.body.Write(p)
+	}
+}
+
+func (r *recorder) WriteString(s string) (int, error) {
+	return r.Write([]byte(s))
+}
+
+func (r *recorder) Status() int {
+	return r.status
+}
+
+func (r *recorder) Flush() {
+	if r.mode == recordTee {
+		r.ResponseWriter.Flush()
+	}
+}
+
+// capture keeps a copy of body bytes written through
+func (r *recorder) capture(p []byte) {
+	if r.overflow {
+		return
+	}
+	if r.body.Len()+len(p) > r.limit {
+		r.overflow = true
+		r.body.Reset()
+		return
+	}
+	r.body.Write(p)
+}
+
+// release writes a held response to the client and switches to tee mode
+func (r *recorder) release() error {
+	header := r.ResponseWriter.Header()
+	for key, values := range r.header {
+		header[key] = values
+	}
+	r.ResponseWriter.WriteHeader(r.status)
+
+	_, err := r.ResponseWriter.Write(r.body.Bytes())
+	r.mode = recordTee
+	r.header = nil
+	r.overflow = true
+	r.body.Reset()
+	return err
+}
+
+// complete reports whether the whole body was captured
+func (r *recorder) complete() bool {
+	return !r.overflow
+}
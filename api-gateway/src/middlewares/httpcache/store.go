@@ -0,0 +1,203 @@
+// middlewares/httpcache/store.go
+
+package httpcache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/cache"
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis key prefixes of the response cache
+const (
+	responseKeyPrefix = "cache:resp:"
+	tagKeyPrefix      = "cache:tag:"
+)
+
+// store is a tier of the response cache
+type store interface {
+	name() string
+	get(ctx context.Context, key string) (*entry, error) // nil when absent
+	set(ctx context.Context, key string, e *entry, ttl time.Duration) error
+	purgeKeys(ctx context.Context, keys []string) error
+	purgeTags(ctx context.Context, tags []string) error
+}
+
+// localStore keeps responses in an in-memory LRU. Purging a tag records
+// when it happened; entries stored earlier with that tag are dropped on
+// their next lookup. A record is forgotten once every entry it can apply to
+// has expired.
+type localStore struct {
+	entries *cache.LRU[string, localEntry]
+	maxTTL  time.Duration // Zero for no limit
+
+	mu      sync.Mutex
+	purged  map[string]time.Time
+	longest time.Duration // Longest lifetime of the entries added so far
+}
+
+// localEntry is an entry with the time it was added to the local store
+type localEntry struct {
+	entry   *entry
+	addedAt time.Time
+}
+
+// newLocalStore creates a local store. maxTTL bounds how long entries are
+// kept, zero keeps them as long as requested.
+func newLocalStore(capacity int, maxTTL time.Duration) *localStore {
+	return &localStore{
+		entries: cache.NewLRU[string, localEntry](capacity),
+		maxTTL:  maxTTL,
+		purged:  make(map[string]time.Time),
+	}
+}
+
+func (s *localStore) name() string { return config.CacheStoreLocal }
+
+func (s *localStore) get(_ context.Context, key string) (*entry, error) {
+	item, ok := s.entries.Get(key)
+	if !ok {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tag := range item.entry.Tags {
+		if purgedAt, ok := s.purged[tag]; ok && !item.addedAt.After(purgedAt) {
+			s.entries.Remove(key)
+			return nil, nil
+		}
+	}
+	return item.entry, nil
+}
+
+func (s *localStore) set(_ context.Context, key string, e *entry, ttl time.Duration) error {
+	if s.maxTTL > 0 {
+		ttl = min(ttl, s.maxTTL)
+	}
+
+	s.mu.Lock()
+	s.longest = max(s.longest, ttl)
+	s.mu.Unlock()
+
+	s.entries.Add(key, localEntry{entry: e, addedAt: time.Now()}, ttl)
+	return nil
+}
+
+func (s *localStore) purgeKeys(_ context.Context, keys []string) error {
+	for _, key := range keys {
+		s.entries.Remove(key)
+	}
+	return nil
+}
+
+func (s *localStore) purgeTags(_ context.Context, tags []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for tag, purgedAt := range s.purged {
+		if now.Sub(purgedAt) > s.longest {
+			delete(s.purged, tag)
+		}
+	}
+	for _, tag := range tags {
+		s.purged[tag] = now
+	}
+	return nil
+}
+
+// redisStore keeps responses in Redis, shared by all gateway instances.
+// Every tag is a set of the keys stored with it.
+type redisStore struct {
+	client redis.Cmdable
+}
+
+func (s *redisStore) name() string { return config.CacheStoreRedis }
+
+func (s *redisStore) get(ctx context.Context, key string) (*entry, error) {
+	data, err := s.client.Get(ctx, responseKeyPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached response: %w", err)
+	}
+
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("failed to decode cached response: %w", err)
+	}
+	return &e, nil
+}
+
+func (s *redisStore) set(ctx context.Context, key string, e *entry, ttl time.Duration) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode response: %w", err)
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, responseKeyPrefix+key, data, ttl)
+	for _, tag := range e.Tags {
+		// A tag lives as long as its longest-lived entry
+		pipe.SAdd(ctx, tagKeyPrefix+tag, key)
+		pipe.ExpireNX(ctx, tagKeyPrefix+tag, ttl)
+		pipe.ExpireGT(ctx, tagKeyPrefix+tag, ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to store response: %w", err)
+	}
+	return nil
+}
+
+func (s *redisStore) purgeKeys(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	redisKeys := make([]string, len(keys))
+	for i, key := range keys {
+		redisKeys[i] = responseKeyPrefix + key
+	}
+	if err := s.client.Del(ctx, redisKeys...).Err(); err != nil {
+		return fmt.Errorf("failed to purge keys: %w", err)
+	}
+	return nil
+}
+
+func (s *redisStore) purgeTags(ctx context.Context, tags []string) error {
+	for _, tag := range tags {
+		keys, err := s.client.SMembers(ctx, tagKeyPrefix+tag).Result()
+		if err != nil {
+			return fmt.Errorf("failed to read tag %s: %w", tag, err)
+		}
+		if err := s.purgeKeys(ctx, keys); err != nil {
+			return err
+		}
+		if err := s.client.Del(ctx, tagKeyPrefix+tag).Err(); err != nil {
+			return fmt.Errorf("failed to purge tag %s: %w", tag, err)
+		}
+	}
+	return nil
+}
+
+// newStores creates the tiers of the configured store, fastest first
+func newStores(cfg *config.CacheConfig, client redis.Cmdable) []store {
+	switch cfg.Store {
+	case config.CacheStoreLocal:
+		return []store{newLocalStore(cfg.LocalEntries, 0)}
+	case config.CacheStoreRedis:
+		return []store{&redisStore{client: client}}
+	default:
+		localTTL := time.Duration(cfg.LocalTTLSecs) * time.Second
+		return []store{newLocalStore(cfg.LocalEntries, localTTL), &redisStore{client: client}}
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/tracing"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/utils"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
@@ -27,7 +29,6 @@ func (rl *RequestLogger) LogRequest() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
 		path := c.Request.URL.Path
-		query := c.Request.URL.RawQuery
 
 		// Process request
 		c.Next()
@@ -35,6 +36,9 @@ func (rl *RequestLogger) LogRequest() gin.HandlerFunc {
 		// Log request details after processing
 		latency := time.Since(start)
 
+		// Read the query only now, authentication strips credentials from it
+		query := c.Request.URL.RawQuery
+
 		// Get error if one occurred
 		var errorMessage string
 		if len(c.Errors) > 0 {
@@ -43,6 +47,8 @@ func (rl *RequestLogger) LogRequest() gin.HandlerFunc {
 
 		// Log request details
 		rl.logger.Info("request completed",
+			zap.String("request_id", c.GetString(utils.RequestIDKey)),
+			zap.String("trace_id", tracing.TraceID(c.Request.Context())),
 			zap.String("method", c.Request.Method),
 			zap.String("path", path),
 			zap.String("query", query),
@@ -64,6 +70,7 @@ func (rl *RequestLogger) LogError() gin.HandlerFunc {
 		// Log detailed error information if any occurred
 		for _, err := range c.Errors {
 			fields := []zap.Field{
+				zap.String("request_id", c.GetString(utils.RequestIDKey)),
 				zap.String("method", c.Request.Method),
 				zap.String("path", c.Request.URL.Path),
 				zap.Error(err.Err),
@@ -82,6 +89,20 @@ func (rl *RequestLogger) LogError() gin.HandlerFunc {
 	}
 }
 
+// Recovery recovers from panics in handlers and logs them
+func (rl *RequestLogger) Recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
+		rl.logger.Error("panic recovered",
+			zap.String("request_id", c.GetString(utils.RequestIDKey)),
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.Request.URL.Path),
+			zap.Any("panic", recovered),
+		)
+		utils.RespondWithInternalError(c, "")
+		c.Abort()
+	})
+}
+
 // CustomError represents a structured error with metadata
 type CustomError struct {
 	Code    int
@@ -0,0 +1,27 @@
+// middlewares/logging/request_id.go
+
+package logging
+
+import (
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestID assigns every request an ID, taken from a valid X-Request-ID
+// header or generated, so it can be correlated across the gateway logs and
+// the backends. The ID is stored in the gin and request contexts and echoed
+// in the response. It must run before any middleware that logs or responds.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(utils.RequestIDHeader)
+		if !utils.IsValidRequestID(id) {
+			id = utils.NewRequestID()
+		}
+
+		c.Set(utils.RequestIDKey, id)
+		c.Request = c.Request.WithContext(utils.ContextWithRequestID(c.Request.Context(), id))
+		c.Header(utils.RequestIDHeader, id)
+
+		c.Next()
+	}
+}
@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/utils"
+	"github.com/gin-gonic/gin"
+)
+
+var uuidV7 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		header   string
+		generate bool
+	}{
+		{name: "missing", generate: true},
+		{name: "client supplied", header: "client-id-1"},
+		{name: "invalid", header: "bad id\n", generate: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inContext, inRequest string
+			engine := gin.New()
+			engine.Use(RequestID())
+			engine.GET("/", func(c *gin.Context) {
+				inContext = c.GetString(utils.RequestIDKey)
+				inRequest = utils.RequestIDFromContext(c.Request.Context())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(utils.RequestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+
+			id := w.Header().Get(utils.RequestIDHeader)
+			if tt.generate && !uuidV7.MatchString(id) {
+				t.Errorf("generated ID %q is not a UUIDv7", id)
+			}
+			if !tt.generate && id != tt.header {
+				t.Errorf("ID = %q, want the client's %q", id, tt.header)
+			}
+			if inContext != id || inRequest != id {
+				t.Errorf("context IDs = %q, %q, want %q", inContext, inRequest, id)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+// middlewares/ratelimit/algorithm.go
+
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Rate limiting algorithms
+const (
+	AlgorithmTokenBucket   = "token-bucket"
+	AlgorithmSlidingWindow = "sliding-window"
+)
+
+// Rate allows Requests per Period. The token bucket additionally lets
+// bursts of up to Burst requests through, defaulting to Requests.
+type Rate struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+// capacity returns the maximum number of requests admitted at once
+func (r Rate) capacity() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+	return r.Requests
+}
+
+// Result describes the outcome of a rate limit check and the state of the
+// limit afterwards
+type Result struct {
+	Allowed    bool
+	Limit      int           // Requests admitted at once when the limit is fully replenished
+	Remaining  int           // Requests still admitted right now
+	RetryAfter time.Duration // Time until the next request is admitted, zero when allowed
+	ResetAfter time.Duration // Time until the limit is fully replenished
+}
+
+// algorithm checks requests against a rate, atomically in Redis or against
+// a bucket of the in-memory fallback
+type algorithm interface {
+	allow(ctx context.Context, client redis.Scripter, key string, rate Rate) (Result, error)
+	allowLocal(b *localBucket, now time.Time, rate Rate) Result
+}
+
+// newAlgorithm returns the algorithm with the given name, the token bucket
+// by default
+func newAlgorithm(name string) (algorithm, error) {
+	switch name {
+	case "", AlgorithmTokenBucket:
+		return tokenBucket{}, nil
+	case AlgorithmSlidingWindow:
+		return slidingWindow{}, nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", name)
+	}
+}
+
+// tokenBucketScript refills the bucket for the time elapsed since the last
+// request and takes one token if available. Time comes from the Redis
+// server so all gateway instances share one clock. Timestamps are formatted
+// with %.0f as tostring would round them to 14 digits.
+//
+// KEYS[1] bucket key
+// ARGV[1] tokens added per period, ARGV[2] period in microseconds,
+// ARGV[3] bucket capacity
+//
+// Returns {allowed, remaining, retry after µs, reset after µs}
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1]) / tonumber(ARGV[2])
+local capacity = tonumber(ARGV[3])
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) / rate)
+end
+
+local reset = math.ceil((capacity - tokens) / rate)
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', string.format('%.0f', now))
+redis.call('PEXPIRE', KEYS[1], math.max(1, math.ceil(reset / 1000)))
+
+return {allowed, math.floor(tokens), retry, reset}
+`)
+
+// tokenBucket refills Requests tokens per Period into a bucket holding up to
+// Burst tokens; every request takes one token
+type tokenBucket struct{}
+
+func (tokenBucket) allow(ctx context.Context, client redis.Scripter, key string, rate Rate) (Result, error) {
+	values, err := tokenBucketScript.Run(ctx, client, []string{key},
+		rate.Requests, rate.Period.Microseconds(), rate.capacity(),
+	).Int64Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("token bucket script failed: %w", err)
+	}
+
+	return newResult(values, rate.capacity()), nil
+}
+
+// allowLocal is the in-memory equivalent of tokenBucketScript. The caller
+// holds the lock of the bucket.
+func (tokenBucket) allowLocal(b *localBucket, now time.Time, rate Rate) Result {
+	perMicro := float64(rate.Requests) / float64(rate.Period.Microseconds())
+	capacity := float64(rate.capacity())
+
+	if b.updated.IsZero() {
+		b.tokens = capacity
+		b.updated = now
+	}
+	elapsed := math.Max(0, float64(now.Sub(b.updated).Microseconds()))
+	tokens := math.Min(capacity, b.tokens+elapsed*perMicro)
+
+	result := Result{Limit: rate.capacity()}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = microseconds(math.Ceil((1 - tokens) / perMicro))
+	}
+	result.Remaining = int(tokens)
+	result.ResetAfter = microseconds(math.Ceil((capacity - tokens) / perMicro))
+
+	b.tokens = tokens
+	b.updated = now
+	return result
+}
+
+// slidingWindowScript approximates a sliding window log with the counts of
+// the current and previous fixed windows, weighting the previous one by how
+// much of it still overlaps the sliding window.
+//
+// KEYS[1] counter key
+// ARGV[1] requests per window, ARGV[2] window in microseconds
+//
+// Returns {allowed, remaining, retry after µs, reset after µs}
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+local current = math.floor(now / window)
+local elapsed = now - current * window
+
+local state = redis.call('HMGET', KEYS[1], 'window', 'curr', 'prev')
+local stored = tonumber(state[1])
+local curr = tonumber(state[2]) or 0
+local prev = tonumber(state[3]) or 0
+if stored == nil or stored < current - 1 then
+	prev = 0
+	curr = 0
+elseif stored == current - 1 then
+	prev = curr
+	curr = 0
+end
+
+local weight = (window - elapsed) / window
+local count = prev * weight + curr
+
+local allowed = 0
+local retry = 0
+if count + 1 <= limit then
+	curr = curr + 1
+	count = count + 1
+	allowed = 1
+elseif curr + 1 <= limit then
+	-- Wait for the previous window to slide out far enough
+	retry = math.ceil(window * (1 - (limit - curr - 1) / prev) - elapsed)
+else
+	-- Wait for the current window to become the previous one and slide out
+	retry = window - elapsed + math.ceil(window * (1 - (limit - 1) / curr))
+end
+
+local reset = 0
+if curr > 0 then
+	reset = 2 * window - elapsed
+elseif prev > 0 then
+	reset = window - elapsed
+end
+
+redis.call('HSET', KEYS[1], 'window', string.format('%.0f', current), 'curr', curr, 'prev', prev)
+redis.call('PEXPIRE', KEYS[1], math.ceil(2 * window / 1000))
+
+return {allowed, math.max(0, math.floor(limit - count)), retry, reset}
+`)
+
+// slidingWindow admits up to Requests requests within any window of Period
+type slidingWindow struct{}
+
+func (slidingWindow) allow(ctx context.Context, client redis.Scripter, key string, rate Rate) (Result, error) {
+	values, err := slidingWindowScript.Run(ctx, client, []string{key},
+		rate.Requests, rate.Period.Microseconds(),
+	).Int64Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("sliding window script failed: %w", err)
+	}
+
+	return newResult(values, rate.Requests), nil
+}
+
+// allowLocal is the in-memory equivalent of slidingWindowScript. The caller
+// holds the lock of the bucket.
+func (slidingWindow) allowLocal(b *localBucket, now time.Time, rate Rate) Result {
+	limit := float64(rate.Requests)
+	window := rate.Period.Microseconds()
+	micros := now.UnixMicro()
+	current := micros / window
+	elapsed := float64(micros - current*window)
+
+	if b.updated.IsZero() || b.window < current-1 {
+		b.prev = 0
+		b.curr = 0
+	} else if b.window == current-1 {
+		b.prev = b.curr
+		b.curr = 0
+	}
+	b.window = current
+	b.updated = now
+
+	w := float64(window)
+	count := b.prev*(w-elapsed)/w + b.curr
+
+	result := Result{Limit: rate.Requests}
+	switch {
+	case count+1 <= limit:
+		b.curr++
+		count++
+		result.Allowed = true
+	case b.curr+1 <= limit:
+		// Wait for the previous window to slide out far enough
+		result.RetryAfter = microseconds(math.Ceil(w*(1-(limit-b.curr-1)/b.prev) - elapsed))
+	default:
+		// Wait for the current window to become the previous one and slide out
+		result.RetryAfter = microseconds(w - elapsed + math.Ceil(w*(1-(limit-1)/b.curr)))
+	}
+
+	if b.curr > 0 {
+		result.ResetAfter = microseconds(2*w - elapsed)
+	} else if b.prev > 0 {
+		result.ResetAfter = microseconds(w - elapsed)
+	}
+	result.Remaining = int(math.Max(0, math.Floor(limit-count)))
+	return result
+}
+
+// microseconds converts a number of microseconds to a duration
+func microseconds(us float64) time.Duration {
+	return time.Duration(us) * time.Microsecond
+}
+
+// newResult converts the reply of a rate limit script
+func newResult(values []int64, limit int) Result {
+	return Result{
+		Allowed:    values[0] == 1,
+		Limit:      limit,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Microsecond,
+		ResetAfter: time.Duration(values[3]) * time.Microsecond,
+	}
+}
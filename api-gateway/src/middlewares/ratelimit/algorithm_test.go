@@ -0,0 +1,178 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRedis starts a Redis stand-in whose clock is controlled by the test
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	mr.SetTime(time.Unix(1700000000, 0))
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return mr, client
+}
+
+// advance moves the clock of the Redis stand-in forward
+func advance(mr *miniredis.Miniredis, d time.Duration) {
+	mr.SetTime(time.Unix(1700000000, 0).Add(d))
+}
+
+// allowN runs n checks and returns how many were allowed
+func allowN(t *testing.T, algo algorithm, client *redis.Client, rate Rate, n int) int {
+	t.Helper()
+
+	allowed := 0
+	for i := 0; i < n; i++ {
+		result, err := algo.allow(context.Background(), client, "test", rate)
+		if err != nil {
+			t.Fatalf("allow: %v", err)
+		}
+		if result.Allowed {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestTokenBucketHonorsBurst(t *testing.T) {
+	mr, client := newTestRedis(t)
+	rate := Rate{Requests: 10, Period: time.Second, Burst: 5}
+
+	if got := allowN(t, tokenBucket{}, client, rate, 8); got != 5 {
+		t.Fatalf("allowed %d requests of an initial burst, want 5", got)
+	}
+
+	result, err := tokenBucket{}.allow(context.Background(), client, "test", rate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowed || result.Remaining != 0 {
+		t.Errorf("result = %+v, want denied with nothing remaining", result)
+	}
+	if result.RetryAfter != 100*time.Millisecond {
+		t.Errorf("RetryAfter = %s, want 100ms", result.RetryAfter)
+	}
+	if result.ResetAfter != 500*time.Millisecond {
+		t.Errorf("ResetAfter = %s, want 500ms", result.ResetAfter)
+	}
+
+	// One token is refilled every 100ms
+	advance(mr, 250*time.Millisecond)
+	if got := allowN(t, tokenBucket{}, client, rate, 5); got != 2 {
+		t.Errorf("allowed %d requests after 250ms, want 2", got)
+	}
+
+	// The bucket never holds more than the burst size
+	advance(mr, time.Hour)
+	if got := allowN(t, tokenBucket{}, client, rate, 10); got != 5 {
+		t.Errorf("allowed %d requests after a long pause, want 5", got)
+	}
+}
+
+func TestTokenBucketDefaultsBurstToRate(t *testing.T) {
+	_, client := newTestRedis(t)
+	rate := Rate{Requests: 3, Period: time.Second}
+
+	if got := allowN(t, tokenBucket{}, client, rate, 5); got != 3 {
+		t.Errorf("allowed %d requests, want 3", got)
+	}
+}
+
+func TestTokenBucketSustainedRate(t *testing.T) {
+	mr, client := newTestRedis(t)
+	rate := Rate{Requests: 10, Period: time.Second, Burst: 1}
+
+	// At most one request per 100ms gets through, regardless of window boundaries
+	allowed := 0
+	for ms := 0; ms < 1000; ms += 25 {
+		advance(mr, time.Duration(ms)*time.Millisecond)
+		allowed += allowN(t, tokenBucket{}, client, rate, 1)
+	}
+	if allowed != 10 {
+		t.Errorf("allowed %d requests within one second, want 10", allowed)
+	}
+}
+
+func TestSlidingWindowSmoothsBoundaries(t *testing.T) {
+	mr, client := newTestRedis(t)
+	rate := Rate{Requests: 10, Period: time.Second}
+
+	// Use up the limit late in the first window
+	advance(mr, 900*time.Millisecond)
+	if got := allowN(t, slidingWindow{}, client, rate, 12); got != 10 {
+		t.Fatalf("allowed %d requests in the first window, want 10", got)
+	}
+
+	// A fixed window would admit another 10 right after the boundary; 90%
+	// of the previous window still overlaps, so only one more fits
+	advance(mr, 1100*time.Millisecond)
+	if got := allowN(t, slidingWindow{}, client, rate, 10); got != 1 {
+		t.Errorf("allowed %d requests after the boundary, want 1", got)
+	}
+
+	// Two windows later everything has slid out
+	advance(mr, 3100*time.Millisecond)
+	if got := allowN(t, slidingWindow{}, client, rate, 12); got != 10 {
+		t.Errorf("allowed %d requests after the window slid out, want 10", got)
+	}
+}
+
+func TestSlidingWindowRetryAfter(t *testing.T) {
+	mr, client := newTestRedis(t)
+	rate := Rate{Requests: 4, Period: time.Second}
+
+	if got := allowN(t, slidingWindow{}, client, rate, 4); got != 4 {
+		t.Fatalf("allowed %d requests, want 4", got)
+	}
+
+	result, err := slidingWindow{}.allow(context.Background(), client, "test", rate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowed || result.Remaining != 0 || result.Limit != 4 {
+		t.Fatalf("result = %+v, want denied with nothing remaining", result)
+	}
+
+	// The current window must end and a quarter of it slide out
+	if result.RetryAfter != 1250*time.Millisecond {
+		t.Errorf("RetryAfter = %s, want 1.25s", result.RetryAfter)
+	}
+
+	advance(mr, result.RetryAfter)
+	if got := allowN(t, slidingWindow{}, client, rate, 2); got != 1 {
+		t.Errorf("allowed %d requests after RetryAfter, want 1", got)
+	}
+}
+
+func TestNewAlgorithm(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    algorithm
+		wantErr bool
+	}{
+		{name: "", want: tokenBucket{}},
+		{name: AlgorithmTokenBucket, want: tokenBucket{}},
+		{name: AlgorithmSlidingWindow, want: slidingWindow{}},
+		{name: "leaky-bucket", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := newAlgorithm(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("newAlgorithm(%q) error = %v, want error: %v", tt.name, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("newAlgorithm(%q) = %T, want %T", tt.name, got, tt.want)
+		}
+	}
+}
@@ -3,107 +3,111 @@ package ratelimit
 import (
 	"context"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/utils"
 	"github.com/gin-gonic/gin"
-	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
 
-// RateLimiter implements rate limiting using Redis
+// RateLimiter counts the requests of clients against a rate in Redis. The
+// PolicyEngine decides which limiters apply to a request and which client
+// it is counted for.
 type RateLimiter struct {
-	redisClient *redis.Client
-	logger      *zap.Logger
-	// Configurable limits
-	requestsPerSecond int
-	burstSize         int
+	name      string
+	store     *Store
+	logger    *zap.Logger
+	algorithm algorithm
+	rate      Rate
 }
 
 // Config holds rate limiter configuration
 type Config struct {
-	RequestsPerSecond int
-	BurstSize         int
-	RedisClient       *redis.Client
-	Logger            *zap.Logger
+	Name      string // Limit name, used in Redis keys and metrics
+	Rate      Rate
+	Algorithm string // token-bucket (default) or sliding-window
+	Store     *Store
+	Logger    *zap.Logger
 }
 
 // NewRateLimiter creates a new rate limiter
-func NewRateLimiter(config Config) *RateLimiter {
-	return &RateLimiter{
-		redisClient:       config.RedisClient,
-		logger:            config.Logger,
-		requestsPerSecond: config.RequestsPerSecond,
-		burstSize:         config.BurstSize,
+func NewRateLimiter(config Config) (*RateLimiter, error) {
+	if config.Rate.Requests <= 0 {
+		return nil, fmt.Errorf("rate limit %s: requests must be positive", config.Name)
 	}
-}
-
-// Limit is the middleware function to limit requests
-func (rl *RateLimiter) Limit() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Get client identifier (IP or user ID)
-		identifier := rl.getClientIdentifier(c)
-
-		allowed, remaining, err := rl.isAllowed(c.Request.Context(), identifier)
-		if err != nil {
-			rl.logger.Error("rate limiter error", zap.Error(err))
-			c.Next() // Allow request on error
-			return
-		}
-
-		if !allowed {
-			c.Header("X-RateLimit-Remaining", "0")
-			c.Header("X-RateLimit-Reset", fmt.Sprintf("%d", time.Now().Unix()+1))
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "rate limit exceeded",
-			})
-			c.Abort()
-			return
-		}
-
-		c.Header("X-RateLimit-Remaining", fmt.Sprintf("%d", remaining))
-		c.Next()
+	if config.Store == nil {
+		return nil, fmt.Errorf("rate limit %s: store is required", config.Name)
+	}
+	if config.Rate.Period <= 0 {
+		config.Rate.Period = time.Second
 	}
-}
 
-// getClientIdentifier returns a unique identifier for the client
-func (rl *RateLimiter) getClientIdentifier(c *gin.Context) string {
-	// Try to get user ID from context first
-	if userID, exists := c.Get("userID"); exists {
-		return fmt.Sprintf("user:%s", userID)
+	algorithm, err := newAlgorithm(config.Algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("rate limit %s: %w", config.Name, err)
 	}
 
-	// Fall back to IP address
-	return fmt.Sprintf("ip:%s", c.ClientIP())
+	return &RateLimiter{
+		name:      config.Name,
+		store:     config.Store,
+		logger:    config.Logger,
+		algorithm: algorithm,
+		rate:      config.Rate,
+	}, nil
 }
 
-// isAllowed checks if the request is allowed based on rate limits
-func (rl *RateLimiter) isAllowed(ctx context.Context, identifier string) (bool, int, error) {
-	key := fmt.Sprintf("ratelimit:%s", identifier)
-
-	pipe := rl.redisClient.Pipeline()
+// check counts a request of the identified client against the limit
+func (rl *RateLimiter) check(ctx context.Context, identifier string) (Result, error) {
+	key := fmt.Sprintf("ratelimit:%s:%s", rl.name, identifier)
+	return rl.store.allow(ctx, rl.algorithm, key, rl.rate)
+}
 
-	// Get current count
-	//currentCount := pipe.Get(ctx, key)
-	// Increment count
-	increment := pipe.Incr(ctx, key)
-	// Set expiry if key is new
-	pipe.Expire(ctx, key, time.Second)
+// ErrorCodeRateLimited is the error code of requests rejected by a limit
+const ErrorCodeRateLimited = "rate_limit_exceeded"
 
-	_, err := pipe.Exec(ctx)
-	if err != nil && err != redis.Nil {
-		return false, 0, fmt.Errorf("redis pipeline error: %w", err)
+// policy describes the limit in the RateLimit-Policy header format, e.g.
+// "10;w=1;burst=20"
+func (rl *RateLimiter) policy() string {
+	policy := fmt.Sprintf("%d;w=%d", rl.rate.Requests, int64(math.Ceil(rl.rate.Period.Seconds())))
+	if rl.rate.Burst > 0 && rl.rate.Burst != rl.rate.Requests {
+		policy += fmt.Sprintf(";burst=%d", rl.rate.Burst)
 	}
+	return policy
+}
 
-	count, err := increment.Result()
-	if err != nil {
-		return false, 0, fmt.Errorf("increment error: %w", err)
-	}
+// setRateLimitHeaders reports the state of the most exhausted limit and
+// every policy applied to the request, following the IETF RateLimit header
+// fields draft
+func setRateLimitHeaders(c *gin.Context, result Result, policies []string) {
+	c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", strconv.FormatInt(ceilSeconds(result.ResetAfter), 10))
+	c.Header("RateLimit-Policy", strings.Join(policies, ", "))
+}
 
-	remaining := rl.requestsPerSecond - int(count)
-	if remaining < 0 {
-		remaining = 0
-	}
+// rejectRequest aborts a request exceeding a limit
+func rejectRequest(c *gin.Context, result Result, policies []string) {
+	setRateLimitHeaders(c, result, policies)
+	c.Header("Retry-After", strconv.FormatInt(max(1, ceilSeconds(result.RetryAfter)), 10))
+
+	utils.RespondWithError(c, http.StatusTooManyRequests, "Rate limit exceeded",
+		utils.WithCode(ErrorCodeRateLimited),
+	)
+	c.Abort()
+}
+
+// ceilSeconds rounds a duration up to whole seconds
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
 
-	return count <= int64(rl.requestsPerSecond), remaining, nil
+// rejectUnavailable aborts a request that cannot be checked against its
+// limits in fail-closed mode
+func rejectUnavailable(c *gin.Context) {
+	utils.RespondWithError(c, http.StatusServiceUnavailable, "Rate limiting is unavailable")
+	c.Abort()
 }
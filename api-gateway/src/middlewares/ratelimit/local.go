@@ -0,0 +1,106 @@
+// middlewares/ratelimit/local.go
+
+package ratelimit
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const (
+	// localShards is the number of independently locked bucket maps
+	localShards = 64
+
+	// localSweepInterval is how often a shard drops its expired buckets
+	localSweepInterval = time.Minute
+)
+
+// localStore keeps rate limit state in memory. It is the fallback used while
+// Redis is unavailable, so its counts are per gateway instance. Buckets are
+// spread over shards to reduce lock contention and are dropped once they
+// have fully replenished.
+type localStore struct {
+	shards [localShards]localShard
+}
+
+// localShard is a locked subset of the buckets
+type localShard struct {
+	mu      sync.Mutex
+	buckets map[string]*localBucket
+	swept   time.Time
+}
+
+// localBucket is the in-memory state of one limit for one client, shared by
+// both algorithms
+type localBucket struct {
+	updated time.Time
+	expires time.Time // Fully replenished, equivalent to a new bucket
+
+	// Token bucket
+	tokens float64
+
+	// Sliding window
+	window int64
+	curr   float64
+	prev   float64
+}
+
+// newLocalStore creates an empty in-memory store
+func newLocalStore() *localStore {
+	s := &localStore{}
+	for i := range s.shards {
+		s.shards[i].buckets = make(map[string]*localBucket)
+	}
+	return s
+}
+
+// allow checks a request against the bucket stored under key
+func (s *localStore) allow(algo algorithm, key string, rate Rate, now time.Time) Result {
+	shard := &s.shards[shardOf(key)]
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if now.Sub(shard.swept) >= localSweepInterval {
+		shard.sweep(now)
+	}
+
+	b, ok := shard.buckets[key]
+	if !ok || !now.Before(b.expires) {
+		b = &localBucket{}
+		shard.buckets[key] = b
+	}
+
+	result := algo.allowLocal(b, now, rate)
+	b.expires = now.Add(result.ResetAfter)
+	return result
+}
+
+// len returns the number of buckets held
+func (s *localStore) len() int {
+	n := 0
+	for i := range s.shards {
+		s.shards[i].mu.Lock()
+		n += len(s.shards[i].buckets)
+		s.shards[i].mu.Unlock()
+	}
+	return n
+}
+
+// sweep drops the expired buckets of the shard. The caller holds its lock.
+func (sh *localShard) sweep(now time.Time) {
+	for key, b := range sh.buckets {
+		if !now.Before(b.expires) {
+			delete(sh.buckets, key)
+		}
+	}
+	sh.swept = now
+}
+
+// shardOf returns the shard a key is stored in
+func shardOf(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32() % localShards
+}
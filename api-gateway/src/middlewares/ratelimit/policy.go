@@ -0,0 +1,289 @@
+// middlewares/ratelimit/policy.go
+
+package ratelimit
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/metrics"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/tracing"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Client tiers a rate limit applies to
+const (
+	TierAll       = "all"       // Every request, keyed by client IP
+	TierAnonymous = "anonymous" // Requests without a verified token, keyed by client IP
+	TierUser      = "user"      // Authenticated requests, keyed by user ID
+	TierRole      = "role:"     // Prefix of tiers selecting users by token role
+)
+
+// gatewayService labels limits on requests handled by the gateway itself
+const gatewayService = "gateway"
+
+// checkedLimitsKey is the context key of the limits a request was counted
+// against by an earlier middleware of the engine
+const checkedLimitsKey = "rateLimitChecked"
+
+// checkedLimits is the most exhausted result and the policies applied to a
+// request so far. The Global and Authenticated middlewares share it so the
+// headers describe every limit, not only those of the last pass.
+type checkedLimits struct {
+	tightest *Result
+	applied  []string
+}
+
+// defaultPolicy applies when no rate limits are configured
+var defaultPolicy = config.RateLimitConfig{
+	Name:     "global",
+	Tier:     TierAll,
+	Requests: 100,
+	Burst:    200,
+}
+
+// PolicyEngine enforces the rate limits declared in configuration. A
+// request counts against every limit whose path prefix, service and client
+// tier match it, and is rejected as soon as one of them is exhausted. Limits
+// can be replaced at runtime with Update.
+type PolicyEngine struct {
+	collector *metrics.Collector
+	logger    *zap.Logger
+	store     *Store
+	limits    atomic.Pointer[limitSet]
+}
+
+// limitSet holds the rate limits of a configuration
+type limitSet struct {
+	routes []config.RouteConfig // Sorted by descending prefix length
+
+	// Limits checked before and after authentication
+	global        []limitPolicy
+	authenticated []limitPolicy
+}
+
+// limitPolicy is a rate limiter with the scope it applies to
+type limitPolicy struct {
+	limiter    *RateLimiter
+	pathPrefix string
+	service    string
+	tier       string
+}
+
+// NewPolicyEngine creates the rate limits of the configuration
+func NewPolicyEngine(cfg *config.Config, client *redis.Client, collector *metrics.Collector, logger *zap.Logger) (*PolicyEngine, error) {
+	pe := &PolicyEngine{
+		collector: collector,
+		logger:    logger,
+		store:     NewStore(client, cfg.RateLimitFallback, collector, logger),
+	}
+	if err := pe.Update(cfg); err != nil {
+		return nil, err
+	}
+	return pe, nil
+}
+
+// Update atomically replaces the enforced rate limits and the routes used to
+// match their services. Counts are kept for limits whose name is unchanged.
+// The current limits are kept if any of the new ones is invalid.
+func (pe *PolicyEngine) Update(cfg *config.Config) error {
+	routes := append([]config.RouteConfig(nil), cfg.Routes...)
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].PathPrefix) > len(routes[j].PathPrefix)
+	})
+	set := &limitSet{routes: routes}
+
+	limits := cfg.RateLimits
+	if len(limits) == 0 {
+		limits = []config.RateLimitConfig{defaultPolicy}
+	}
+
+	for _, limit := range limits {
+		limiter, err := NewRateLimiter(Config{
+			Name: limit.Name,
+			Rate: Rate{
+				Requests: limit.Requests,
+				Period:   time.Duration(limit.PeriodSecs) * time.Second,
+				Burst:    limit.Burst,
+			},
+			Algorithm: limit.Algorithm,
+			Store:     pe.store,
+			Logger:    pe.logger,
+		})
+		if err != nil {
+			return err
+		}
+
+		p := limitPolicy{
+			limiter:    limiter,
+			pathPrefix: limit.PathPrefix,
+			service:    limit.Service,
+			tier:       limit.Tier,
+		}
+		if p.tier == "" {
+			p.tier = TierAll
+		}
+
+		if p.requiresAuthentication() {
+			set.authenticated = append(set.authenticated, p)
+		} else {
+			set.global = append(set.global, p)
+		}
+	}
+
+	pe.limits.Store(set)
+	return nil
+}
+
+// Global is the middleware enforcing the limits that do not depend on the
+// authenticated user. It runs for every request, after the auth middleware's
+// Identify so that anonymous limits skip requests with a verified token.
+func (pe *PolicyEngine) Global() gin.HandlerFunc {
+	return pe.enforce(func(set *limitSet) []limitPolicy { return set.global })
+}
+
+// Authenticated is the middleware enforcing the user and role limits. It
+// must run after JWTAuthMiddleware.Authenticate.
+func (pe *PolicyEngine) Authenticated() gin.HandlerFunc {
+	return pe.enforce(func(set *limitSet) []limitPolicy { return set.authenticated })
+}
+
+// enforce checks a request against the matching policies of the current limits
+func (pe *PolicyEngine) enforce(selectPolicies func(*limitSet) []limitPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		set := pe.limits.Load()
+		policies := selectPolicies(set)
+		if len(policies) == 0 {
+			c.Next()
+			return
+		}
+
+		ctx, span := tracing.Start(c.Request.Context(), "ratelimit.check")
+		allowed := pe.check(ctx, c, set.serviceFor(c.Request.URL.Path), policies)
+		span.SetAttributes(attribute.Bool("ratelimit.allowed", allowed))
+		span.End()
+
+		if allowed {
+			c.Next()
+		}
+	}
+}
+
+// check counts a request to service against the matching policies and sets
+// the rate limit headers, merged with those of earlier passes. It responds
+// and returns false when the request is rejected.
+func (pe *PolicyEngine) check(ctx context.Context, c *gin.Context, service string, policies []limitPolicy) bool {
+	path := c.Request.URL.Path
+
+	var checked checkedLimits
+	if previous, ok := c.Get(checkedLimitsKey); ok {
+		checked = previous.(checkedLimits)
+	}
+	// Copy so the earlier pass's slice is never appended to in place
+	checked.applied = append([]string(nil), checked.applied...)
+
+	for _, p := range policies {
+		if !p.matches(c, path, service) {
+			continue
+		}
+		checked.applied = append(checked.applied, p.limiter.policy())
+
+		result, err := p.limiter.check(ctx, p.identifier(c))
+		if err != nil {
+			trace.SpanFromContext(ctx).RecordError(err)
+			rejectUnavailable(c)
+			return false
+		}
+
+		if !result.Allowed {
+			label := service
+			if label == "" {
+				label = gatewayService
+			}
+			pe.collector.RecordRateLimit(label, p.limiter.name)
+
+			pe.logger.Debug("rate limit exceeded",
+				zap.String("limit", p.limiter.name),
+				zap.String("path", path),
+				zap.String("client_ip", c.ClientIP()),
+			)
+			trace.SpanFromContext(ctx).SetAttributes(attribute.String("ratelimit.limit", p.limiter.name))
+			rejectRequest(c, result, checked.applied)
+			return false
+		}
+
+		if checked.tightest == nil || result.Remaining < checked.tightest.Remaining {
+			checked.tightest = &result
+		}
+	}
+
+	if checked.tightest != nil {
+		c.Set(checkedLimitsKey, checked)
+		setRateLimitHeaders(c, *checked.tightest, checked.applied)
+	}
+	return true
+}
+
+// serviceFor returns the service the longest matching route forwards a path
+// to, or an empty string for requests handled by the gateway
+func (set *limitSet) serviceFor(path string) string {
+	for _, route := range set.routes {
+		if hasPathPrefix(path, route.PathPrefix) {
+			return route.Service
+		}
+	}
+	return ""
+}
+
+// requiresAuthentication reports whether the policy selects clients by the
+// authenticated user
+func (p limitPolicy) requiresAuthentication() bool {
+	return p.tier == TierUser || strings.HasPrefix(p.tier, TierRole)
+}
+
+// matches reports whether the policy applies to a request
+func (p limitPolicy) matches(c *gin.Context, path, service string) bool {
+	if p.pathPrefix != "" && !hasPathPrefix(path, p.pathPrefix) {
+		return false
+	}
+	if p.service != "" && p.service != service {
+		return false
+	}
+
+	switch {
+	case p.tier == TierAll:
+		return true
+	case p.tier == TierAnonymous:
+		// Set by the auth middleware once a token has been verified
+		return !c.GetBool("authenticated")
+	case p.tier == TierUser:
+		return c.GetString("userID") != ""
+	default:
+		// Issuers differ in how they spell roles
+		return c.GetString("userID") != "" && strings.EqualFold(c.GetString("role"), strings.TrimPrefix(p.tier, TierRole))
+	}
+}
+
+// identifier returns the client a request is counted for
+func (p limitPolicy) identifier(c *gin.Context) string {
+	switch {
+	case p.requiresAuthentication():
+		return "user:" + c.GetString("userID")
+	default:
+		return "ip:" + c.ClientIP()
+	}
+}
+
+// hasPathPrefix reports whether path is prefix or lies below it
+func hasPathPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
@@ -0,0 +1,258 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/metrics"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// newTestEngine serves the policies of cfg, authenticating requests from
+// their X-User and X-Role headers. Requests with an X-User header count as
+// carrying a verified token.
+func newTestEngine(t *testing.T, cfg *config.Config) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	_, client := newTestRedis(t)
+	policies, err := NewPolicyEngine(cfg, client, metrics.NewCollector(prometheus.NewRegistry()), zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewPolicyEngine: %v", err)
+	}
+
+	engine := gin.New()
+	engine.Use(func(c *gin.Context) {
+		c.Set("authenticated", c.GetHeader("X-User") != "")
+	}, policies.Global(), func(c *gin.Context) {
+		if user := c.GetHeader("X-User"); user != "" {
+			c.Set("userID", user)
+			c.Set("role", c.GetHeader("X-Role"))
+		}
+	}, policies.Authenticated())
+	engine.Any("/*path", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return engine
+}
+
+// sendN sends n requests and returns how many were admitted
+func sendN(engine *gin.Engine, path string, header http.Header, n int) int {
+	admitted := 0
+	for i := 0; i < n; i++ {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		if w.Code == http.StatusOK {
+			admitted++
+		}
+	}
+	return admitted
+}
+
+func TestPolicyEngineAppliesEveryMatchingLimit(t *testing.T) {
+	engine := newTestEngine(t, &config.Config{
+		RateLimits: []config.RateLimitConfig{
+			{Name: "per-second", Tier: TierUser, Requests: 5},
+			{Name: "per-day", Tier: TierUser, Requests: 3, PeriodSecs: 86400, Algorithm: AlgorithmSlidingWindow},
+		},
+	})
+
+	alice := http.Header{"X-User": {"alice"}}
+	if got := sendN(engine, "/api", alice, 5); got != 3 {
+		t.Errorf("admitted %d requests, want 3 from the tighter limit", got)
+	}
+
+	// Users are counted separately; anonymous requests are not limited
+	if got := sendN(engine, "/api", http.Header{"X-User": {"bob"}}, 5); got != 3 {
+		t.Errorf("admitted %d requests of another user, want 3", got)
+	}
+	if got := sendN(engine, "/api", nil, 10); got != 10 {
+		t.Errorf("admitted %d anonymous requests, want 10", got)
+	}
+}
+
+func TestPolicyEngineScopes(t *testing.T) {
+	engine := newTestEngine(t, &config.Config{
+		Routes: []config.RouteConfig{
+			{PathPrefix: "/api/v1/appointments", Service: "appointment-service"},
+			{PathPrefix: "/api/v1", Service: "user-service"},
+		},
+		RateLimits: []config.RateLimitConfig{
+			{Name: "login", PathPrefix: "/login", Tier: TierAnonymous, Requests: 2},
+			{Name: "patients", Service: "appointment-service", Tier: TierRole + "patient", Requests: 1},
+		},
+	})
+
+	if got := sendN(engine, "/login", nil, 5); got != 2 {
+		t.Errorf("admitted %d anonymous logins, want 2", got)
+	}
+	// Credentials that were not verified do not leave the anonymous tier
+	if got := sendN(engine, "/login/", http.Header{"Authorization": {"Bearer x"}, "X-Api-Key": {"k"}}, 5); got != 0 {
+		t.Errorf("admitted %d logins with unverified credentials, want 0", got)
+	}
+	if got := sendN(engine, "/login/", http.Header{"X-User": {"alice"}}, 5); got != 5 {
+		t.Errorf("admitted %d logins with a verified token, want 5", got)
+	}
+	if got := sendN(engine, "/loginx", nil, 5); got != 5 {
+		t.Errorf("admitted %d requests outside the prefix, want 5", got)
+	}
+
+	patient := http.Header{"X-User": {"p1"}, "X-Role": {"patient"}}
+	if got := sendN(engine, "/api/v1/appointments/7", patient, 3); got != 1 {
+		t.Errorf("admitted %d patient requests to the service, want 1", got)
+	}
+	uppercase := http.Header{"X-User": {"p2"}, "X-Role": {"PATIENT"}}
+	if got := sendN(engine, "/api/v1/appointments/7", uppercase, 3); got != 1 {
+		t.Errorf("admitted %d requests of the role in uppercase, want 1", got)
+	}
+	if got := sendN(engine, "/api/v1/users/7", patient, 3); got != 3 {
+		t.Errorf("admitted %d patient requests to another service, want 3", got)
+	}
+	doctor := http.Header{"X-User": {"d1"}, "X-Role": {"doctor"}}
+	if got := sendN(engine, "/api/v1/appointments/7", doctor, 3); got != 3 {
+		t.Errorf("admitted %d requests of another role, want 3", got)
+	}
+}
+
+func TestPolicyEngineDefaultLimit(t *testing.T) {
+	engine := newTestEngine(t, &config.Config{})
+
+	if got := sendN(engine, "/", nil, 250); got != defaultPolicy.Burst {
+		t.Errorf("admitted %d requests, want the default burst of %d", got, defaultPolicy.Burst)
+	}
+}
+
+func TestPolicyEngineHeaders(t *testing.T) {
+	engine := newTestEngine(t, &config.Config{
+		RateLimits: []config.RateLimitConfig{
+			{Name: "per-second", Requests: 10, Burst: 20},
+			{Name: "per-minute", Requests: 2, PeriodSecs: 60, Algorithm: AlgorithmSlidingWindow},
+		},
+	})
+
+	send := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w
+	}
+
+	// The most exhausted limit is reported. The test clock starts 20s into
+	// a minute window.
+	w := send()
+	want := map[string]string{
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "1",
+		"RateLimit-Reset":     "100",
+		"RateLimit-Policy":    "10;w=1;burst=20, 2;w=60",
+	}
+	for name, value := range want {
+		if got := w.Header().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+
+	send()
+	w = send()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("RateLimit-Remaining = %q, want 0", got)
+	}
+	// The window ends after 40s, then half of it has to slide out
+	if got := w.Header().Get("Retry-After"); got != "70" {
+		t.Errorf("Retry-After = %q, want 70", got)
+	}
+
+	var body struct {
+		Status int    `json:"status"`
+		Code   string `json:"code"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Status != http.StatusTooManyRequests || body.Code != ErrorCodeRateLimited {
+		t.Errorf("body = %s, want a rate_limit_exceeded error", w.Body)
+	}
+}
+
+func TestPolicyEngineHeadersAcrossPasses(t *testing.T) {
+	engine := newTestEngine(t, &config.Config{
+		RateLimits: []config.RateLimitConfig{
+			{Name: "global", Requests: 2, PeriodSecs: 3600},
+			{Name: "user", Tier: TierUser, Requests: 100, PeriodSecs: 3600},
+		},
+	})
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-User", "alice")
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w
+	}
+
+	// The tighter global limit is still reported after the user limit is
+	// checked, and both policies are listed
+	w := send()
+	want := map[string]string{
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "1",
+		"RateLimit-Policy":    "2;w=3600, 100;w=3600",
+	}
+	for name, value := range want {
+		if got := w.Header().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	if got := w.Header().Values("RateLimit-Remaining"); len(got) != 1 {
+		t.Errorf("RateLimit-Remaining = %q, want a single value", got)
+	}
+}
+
+func TestPolicyEngineUpdate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, client := newTestRedis(t)
+	policies, err := NewPolicyEngine(&config.Config{
+		RateLimits: []config.RateLimitConfig{{Name: "global", Requests: 2, PeriodSecs: 3600}},
+	}, client, metrics.NewCollector(prometheus.NewRegistry()), zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewPolicyEngine: %v", err)
+	}
+
+	// Middleware created before the update enforces the new limits
+	engine := gin.New()
+	engine.Use(policies.Global())
+	engine.Any("/*path", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	if got := sendN(engine, "/api", nil, 1); got != 1 {
+		t.Fatalf("admitted %d requests, want 1", got)
+	}
+
+	// The bucket of a limit keeps its level across updates
+	if err := policies.Update(&config.Config{
+		RateLimits: []config.RateLimitConfig{{Name: "global", Requests: 3, PeriodSecs: 3600}},
+	}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if got := sendN(engine, "/api", nil, 5); got != 1 {
+		t.Errorf("admitted %d requests after raising the limit, want the 1 token left", got)
+	}
+
+	// An invalid limit keeps the current ones
+	if err := policies.Update(&config.Config{
+		RateLimits: []config.RateLimitConfig{{Name: "broken", Requests: 0}},
+	}); err == nil {
+		t.Error("Update accepted a limit without requests")
+	}
+	if got := sendN(engine, "/api", nil, 1); got != 0 {
+		t.Errorf("admitted %d requests after a failed update, want 0", got)
+	}
+}
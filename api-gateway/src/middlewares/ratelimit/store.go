@@ -0,0 +1,148 @@
+// middlewares/ratelimit/store.go
+
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/metrics"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// ErrUnavailable is returned in fail-closed mode while Redis is unavailable
+var ErrUnavailable = errors.New("rate limiting is unavailable")
+
+// modeRedis is the rate limiting mode while Redis is healthy
+const modeRedis = "redis"
+
+// Store holds the state of the rate limits in Redis. When Redis errors or
+// times out, the store switches to its failure mode until a periodic probe
+// succeeds again: it admits every request (fail-open), rejects every
+// request (fail-closed) or counts requests in memory (local-fallback).
+type Store struct {
+	client        redis.Scripter
+	local         *localStore
+	collector     *metrics.Collector
+	logger        *zap.Logger
+	failureMode   string
+	timeout       time.Duration
+	retryInterval time.Duration
+
+	degraded atomic.Bool
+	mu       sync.Mutex // Guards retryAt and mode switches
+	retryAt  time.Time
+}
+
+// NewStore creates a rate limit store backed by client
+func NewStore(client redis.Scripter, cfg config.RateLimitFallbackConfig, collector *metrics.Collector, logger *zap.Logger) *Store {
+	mode := cfg.Mode
+	if mode == "" {
+		mode = config.RateLimitLocalFallback
+	}
+
+	return &Store{
+		client:        client,
+		local:         newLocalStore(),
+		collector:     collector,
+		logger:        logger,
+		failureMode:   mode,
+		timeout:       time.Duration(cfg.RedisTimeoutMillis) * time.Millisecond,
+		retryInterval: time.Duration(cfg.RetryIntervalSecs) * time.Second,
+	}
+}
+
+// allow counts a request against the limit stored under key
+func (s *Store) allow(ctx context.Context, algo algorithm, key string, rate Rate) (Result, error) {
+	if s.shouldUseRedis() {
+		result, err := s.allowRedis(ctx, algo, key, rate)
+		if err == nil {
+			s.recovered()
+			return result, nil
+		}
+
+		// A cancelled request says nothing about Redis
+		if ctx.Err() == nil {
+			s.failed(err)
+		}
+	}
+
+	switch s.failureMode {
+	case config.RateLimitFailOpen:
+		return Result{Allowed: true, Limit: rate.capacity(), Remaining: rate.capacity()}, nil
+	case config.RateLimitFailClosed:
+		return Result{}, ErrUnavailable
+	default:
+		return s.local.allow(algo, key, rate, time.Now()), nil
+	}
+}
+
+// allowRedis runs the check in Redis within the configured timeout
+func (s *Store) allowRedis(ctx context.Context, algo algorithm, key string, rate Rate) (Result, error) {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	return algo.allow(ctx, s.client, key, rate)
+}
+
+// shouldUseRedis reports whether a request should be checked in Redis.
+// While Redis is failing, only one request per retry interval probes it.
+func (s *Store) shouldUseRedis() bool {
+	if !s.degraded.Load() {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(s.retryAt) {
+		return false
+	}
+	s.retryAt = now.Add(s.retryInterval)
+	return true
+}
+
+// failed switches to the failure mode after a Redis error
+func (s *Store) failed(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.retryAt = time.Now().Add(s.retryInterval)
+	if !s.degraded.CompareAndSwap(false, true) {
+		return
+	}
+
+	s.collector.RecordRateLimitModeSwitch(modeRedis, s.failureMode)
+	s.logger.Warn("rate limiting switched to failure mode, Redis is unavailable",
+		zap.String("mode", s.failureMode),
+		zap.Duration("retry_interval", s.retryInterval),
+		zap.Error(err),
+	)
+}
+
+// recovered switches back to Redis after a successful check
+func (s *Store) recovered() {
+	if !s.degraded.Load() {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.degraded.CompareAndSwap(true, false) {
+		return
+	}
+
+	s.collector.RecordRateLimitModeSwitch(s.failureMode, modeRedis)
+	s.logger.Info("rate limiting switched back to Redis",
+		zap.String("previous_mode", s.failureMode),
+	)
+}
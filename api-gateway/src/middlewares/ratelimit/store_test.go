@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+func TestStoreFailureModes(t *testing.T) {
+	rate := Rate{Requests: 2, Period: time.Minute}
+
+	tests := []struct {
+		mode        string
+		wantAllowed int
+		wantErr     error
+	}{
+		{mode: config.RateLimitFailOpen, wantAllowed: 5},
+		{mode: config.RateLimitFailClosed, wantErr: ErrUnavailable},
+		{mode: config.RateLimitLocalFallback, wantAllowed: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			mr, client := newTestRedis(t)
+			store := NewStore(client, config.RateLimitFallbackConfig{
+				Mode:              tt.mode,
+				RetryIntervalSecs: 60,
+			}, metrics.NewCollector(prometheus.NewRegistry()), zap.NewNop())
+			mr.Close()
+
+			allowed := 0
+			for i := 0; i < 5; i++ {
+				result, err := store.allow(context.Background(), tokenBucket{}, "test", rate)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("allow error = %v, want %v", err, tt.wantErr)
+				}
+				if result.Allowed {
+					allowed++
+				}
+			}
+			if allowed != tt.wantAllowed {
+				t.Errorf("allowed %d requests, want %d", allowed, tt.wantAllowed)
+			}
+			if !store.degraded.Load() {
+				t.Error("store did not switch to its failure mode")
+			}
+		})
+	}
+}
+
+func TestStoreSwitchesBackToRedis(t *testing.T) {
+	mr, client := newTestRedis(t)
+	store := NewStore(client, config.RateLimitFallbackConfig{}, metrics.NewCollector(prometheus.NewRegistry()), zap.NewNop())
+	rate := Rate{Requests: 10, Period: time.Second}
+
+	mr.Close()
+	if _, err := store.allow(context.Background(), tokenBucket{}, "test", rate); err != nil {
+		t.Fatal(err)
+	}
+	if !store.degraded.Load() {
+		t.Fatal("store did not fall back while Redis is down")
+	}
+
+	// With no retry interval the next request probes Redis again
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.allow(context.Background(), tokenBucket{}, "test", rate); err != nil {
+		t.Fatal(err)
+	}
+	if store.degraded.Load() {
+		t.Error("store did not switch back once Redis recovered")
+	}
+}
+
+func TestLocalStoreMatchesRedis(t *testing.T) {
+	mr, client := newTestRedis(t)
+	local := newLocalStore()
+	start := time.Unix(1700000000, 0)
+
+	rates := map[algorithm]Rate{
+		tokenBucket{}:   {Requests: 10, Period: time.Second, Burst: 5},
+		slidingWindow{}: {Requests: 4, Period: time.Second},
+	}
+
+	for algo, rate := range rates {
+		key := "match"
+		for ms := 0; ms < 3000; ms += 70 {
+			now := start.Add(time.Duration(ms) * time.Millisecond)
+			mr.SetTime(now)
+
+			want, err := algo.allow(context.Background(), client, key, rate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := local.allow(algo, key, rate, now)
+			if got != want {
+				t.Fatalf("%T at %dms: local = %+v, Redis = %+v", algo, ms, got, want)
+			}
+		}
+		mr.FlushAll()
+		local = newLocalStore()
+	}
+}
+
+func TestLocalStoreDropsExpiredBuckets(t *testing.T) {
+	local := newLocalStore()
+	rate := Rate{Requests: 1, Period: time.Second}
+	now := time.Unix(1700000000, 0)
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		local.allow(tokenBucket{}, key, rate, now)
+	}
+	if n := local.len(); n != 4 {
+		t.Fatalf("holding %d buckets, want 4", n)
+	}
+
+	// Every shard is swept on its next use once the interval has passed
+	later := now.Add(localSweepInterval)
+	for i := range local.shards {
+		local.shards[i].mu.Lock()
+		local.shards[i].sweep(later)
+		local.shards[i].mu.Unlock()
+	}
+	if n := local.len(); n != 0 {
+		t.Errorf("holding %d buckets after the sweep, want 0", n)
+	}
+
+	// A bucket that has replenished starts over
+	if result := local.allow(tokenBucket{}, "a", rate, later); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("result = %+v, want a fresh bucket", result)
+	}
+}
@@ -3,128 +3,210 @@
 package metrics
 
 import (
+	"net/http"
+	"strconv"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promauto"
-	"sync"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 )
 
-// Collector handles all metrics collection for the API Gateway
+// Collector handles all metrics collection for the API Gateway. Its metrics
+// are registered with its own registry, not the Prometheus default one.
 type Collector struct {
+	registry *prometheus.Registry
+
 	// HTTP request metrics
 	requestsTotal    *prometheus.CounterVec
 	requestDuration  *prometheus.HistogramVec
+	responseSize     *prometheus.HistogramVec
 	requestsInFlight *prometheus.GaugeVec
 
-	// Circuit breaker metrics
+	// Backend metrics
+	serviceHealth       *prometheus.GaugeVec
 	circuitBreakerState *prometheus.GaugeVec
 
 	// Rate limiting metrics
-	rateLimitHits *prometheus.CounterVec
+	rateLimitHits         *prometheus.CounterVec
+	rateLimitMode         *prometheus.GaugeVec
+	rateLimitModeSwitches *prometheus.CounterVec
 
 	// Cache metrics
 	cacheHits   *prometheus.CounterVec
 	cacheMisses *prometheus.CounterVec
 
-	once sync.Once
+	// Upgraded connection metrics
+	upgradedConnections      *prometheus.GaugeVec
+	upgradedConnectionsTotal *prometheus.CounterVec
 }
 
-var (
-	instance *Collector
-	mu       sync.Mutex
-)
+// NewRegistry creates a registry exporting the Go runtime and process
+// metrics, for the collector of the gateway
+func NewRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return registry
+}
 
-// GetCollector returns the singleton instance of the metrics collector
-func GetCollector() *Collector {
-	mu.Lock()
-	defer mu.Unlock()
+// NewCollector creates a collector registering its metrics with registry
+func NewCollector(registry *prometheus.Registry) *Collector {
+	c := &Collector{registry: registry}
+	c.initialize()
+	return c
+}
 
-	if instance == nil {
-		instance = &Collector{}
-		instance.initialize()
-	}
-	return instance
+// Handler returns the HTTP handler exposing the collector's registry
+func (c *Collector) Handler() http.Handler {
+	return promhttp.HandlerFor(c.registry, promhttp.HandlerOpts{Registry: c.registry})
 }
 
 // initialize sets up all prometheus metrics
 func (c *Collector) initialize() {
-	c.once.Do(func() {
-		// HTTP request metrics
-		c.requestsTotal = promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "api_gateway_requests_total",
-				Help: "Total number of requests processed by the API Gateway",
-			},
-			[]string{"method", "path", "status", "service"},
-		)
-
-		c.requestDuration = promauto.NewHistogramVec(
-			prometheus.HistogramOpts{
-				Name:    "api_gateway_request_duration_seconds",
-				Help:    "Duration of requests processed by the API Gateway",
-				Buckets: prometheus.DefBuckets,
-			},
-			[]string{"method", "path", "service"},
-		)
-
-		c.requestsInFlight = promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "api_gateway_requests_in_flight",
-				Help: "Current number of requests being processed",
-			},
-			[]string{"method", "service"},
-		)
-
-		// Circuit breaker metrics
-		c.circuitBreakerState = promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "api_gateway_circuit_breaker_state",
-				Help: "Current state of circuit breakers (0=open, 1=half-open, 2=closed)",
-			},
-			[]string{"service"},
-		)
-
-		// Rate limiting metrics
-		c.rateLimitHits = promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "api_gateway_rate_limit_hits_total",
-				Help: "Total number of rate limit hits",
-			},
-			[]string{"service", "limit_type"},
-		)
-
-		// Cache metrics
-		c.cacheHits = promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "api_gateway_cache_hits_total",
-				Help: "Total number of cache hits",
-			},
-			[]string{"cache_type"},
-		)
-
-		c.cacheMisses = promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "api_gateway_cache_misses_total",
-				Help: "Total number of cache misses",
-			},
-			[]string{"cache_type"},
-		)
-	})
+	factory := promauto.With(c.registry)
+
+	// HTTP request metrics, by route template rather than raw path to bound
+	// their cardinality
+	c.requestsTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_requests_total",
+			Help: "Total number of requests processed by the API Gateway",
+		},
+		[]string{"method", "route", "service", "status"},
+	)
+
+	c.requestDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "api_gateway_request_duration_seconds",
+			Help:    "Duration of requests processed by the API Gateway",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"method", "route", "service"},
+	)
+
+	c.responseSize = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "api_gateway_response_size_bytes",
+			Help:    "Size of response bodies in bytes",
+			Buckets: prometheus.ExponentialBuckets(100, 10, 8), // 100B to 1GB
+		},
+		[]string{"method", "route", "service"},
+	)
+
+	c.requestsInFlight = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "api_gateway_requests_in_flight",
+			Help: "Current number of requests being processed",
+		},
+		[]string{"method"},
+	)
+
+	// Backend metrics
+	c.serviceHealth = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "api_gateway_service_health",
+			Help: "Health of backend service instances (0=unhealthy, 1=healthy)",
+		},
+		[]string{"service", "instance"},
+	)
+
+	c.circuitBreakerState = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "api_gateway_circuit_breaker_state",
+			Help: "Current state of circuit breakers (0=open, 1=half-open, 2=closed)",
+		},
+		[]string{"service"},
+	)
+
+	// Rate limiting metrics
+	c.rateLimitHits = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_rate_limit_hits_total",
+			Help: "Total number of rate limit hits",
+		},
+		[]string{"service", "limit_type"},
+	)
+
+	c.rateLimitMode = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "api_gateway_rate_limit_mode",
+			Help: "Current rate limiting mode (1 for the active mode)",
+		},
+		[]string{"mode"},
+	)
+
+	c.rateLimitModeSwitches = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_rate_limit_mode_switches_total",
+			Help: "Total number of rate limiting mode switches",
+		},
+		[]string{"from", "to"},
+	)
+
+	// Cache metrics
+	c.cacheHits = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_cache_hits_total",
+			Help: "Total number of cache hits",
+		},
+		[]string{"cache_type"},
+	)
+
+	c.cacheMisses = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_cache_misses_total",
+			Help: "Total number of cache misses",
+		},
+		[]string{"cache_type"},
+	)
+
+	// Upgraded connection metrics
+	c.upgradedConnections = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "api_gateway_upgraded_connections",
+			Help: "Current number of upgraded (e.g. WebSocket) connections",
+		},
+		[]string{"service", "protocol"},
+	)
+
+	c.upgradedConnectionsTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_upgraded_connections_total",
+			Help: "Total number of upgraded (e.g. WebSocket) connections",
+		},
+		[]string{"service", "protocol"},
+	)
 }
 
 // RecordRequest records metrics for an HTTP request
-func (c *Collector) RecordRequest(method, path, status, service string, duration float64) {
-	c.requestsTotal.WithLabelValues(method, path, status, service).Inc()
-	c.requestDuration.WithLabelValues(method, path, service).Observe(duration)
+func (c *Collector) RecordRequest(method, route, service string, status int, duration time.Duration, size int) {
+	c.requestsTotal.WithLabelValues(method, route, service, strconv.Itoa(status)).Inc()
+	c.requestDuration.WithLabelValues(method, route, service).Observe(duration.Seconds())
+	c.responseSize.WithLabelValues(method, route, service).Observe(float64(max(size, 0)))
 }
 
 // IncRequestsInFlight increments the number of requests in flight
-func (c *Collector) IncRequestsInFlight(method, service string) {
-	c.requestsInFlight.WithLabelValues(method, service).Inc()
+func (c *Collector) IncRequestsInFlight(method string) {
+	c.requestsInFlight.WithLabelValues(method).Inc()
 }
 
 // DecRequestsInFlight decrements the number of requests in flight
-func (c *Collector) DecRequestsInFlight(method, service string) {
-	c.requestsInFlight.WithLabelValues(method, service).Dec()
+func (c *Collector) DecRequestsInFlight(method string) {
+	c.requestsInFlight.WithLabelValues(method).Dec()
+}
+
+// SetServiceHealth records the result of a health check of a service instance
+func (c *Collector) SetServiceHealth(service, instance string, healthy bool) {
+	value := 0.0
+	if healthy {
+		value = 1.0
+	}
+	c.serviceHealth.WithLabelValues(service, instance).Set(value)
 }
 
 // SetCircuitBreakerState sets the current state of a circuit breaker
@@ -137,6 +219,14 @@ func (c *Collector) RecordRateLimit(service, limitType string) {
 	c.rateLimitHits.WithLabelValues(service, limitType).Inc()
 }
 
+// RecordRateLimitModeSwitch records a switch of the rate limiting mode, e.g.
+// from Redis to the local fallback
+func (c *Collector) RecordRateLimitModeSwitch(from, to string) {
+	c.rateLimitModeSwitches.WithLabelValues(from, to).Inc()
+	c.rateLimitMode.WithLabelValues(from).Set(0)
+	c.rateLimitMode.WithLabelValues(to).Set(1)
+}
+
 // RecordCacheHit records a cache hit
 func (c *Collector) RecordCacheHit(cacheType string) {
 	c.cacheHits.WithLabelValues(cacheType).Inc()
@@ -146,3 +236,71 @@ func (c *Collector) RecordCacheHit(cacheType string) {
 func (c *Collector) RecordCacheMiss(cacheType string) {
 	c.cacheMisses.WithLabelValues(cacheType).Inc()
 }
+
+// IncUpgradedConnections records a newly opened upgraded connection
+func (c *Collector) IncUpgradedConnections(service, protocol string) {
+	c.upgradedConnections.WithLabelValues(service, protocol).Inc()
+	c.upgradedConnectionsTotal.WithLabelValues(service, protocol).Inc()
+}
+
+// DecUpgradedConnections records a closed upgraded connection
+func (c *Collector) DecUpgradedConnections(service, protocol string) {
+	c.upgradedConnections.WithLabelValues(service, protocol).Dec()
+}
+
+// ServiceStats summarizes the requests the gateway forwarded to a service
+type ServiceStats struct {
+	Requests     float64
+	ClientErrors float64 // 4xx responses
+	ServerErrors float64 // 5xx responses
+}
+
+// SuccessRate returns the fraction of requests without a server error, 1
+// when there were none
+func (s ServiceStats) SuccessRate() float64 {
+	if s.Requests == 0 {
+		return 1
+	}
+	return 1 - s.ServerErrors/s.Requests
+}
+
+// ServiceStats returns the request counts of a service since startup
+func (c *Collector) ServiceStats(service string) ServiceStats {
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		c.requestsTotal.Collect(metrics)
+		close(metrics)
+	}()
+
+	var stats ServiceStats
+	for metric := range metrics {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			continue
+		}
+
+		var status int
+		matches := false
+		for _, label := range m.GetLabel() {
+			switch label.GetName() {
+			case "service":
+				matches = label.GetValue() == service
+			case "status":
+				status, _ = strconv.Atoi(label.GetValue())
+			}
+		}
+		if !matches {
+			continue
+		}
+
+		count := m.GetCounter().GetValue()
+		stats.Requests += count
+		switch {
+		case status >= http.StatusInternalServerError:
+			stats.ServerErrors += count
+		case status >= http.StatusBadRequest:
+			stats.ClientErrors += count
+		}
+	}
+	return stats
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newTestEngine serves a few routes through the middleware of collector
+func newTestEngine(collector *Collector) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	engine := gin.New()
+	engine.Use(collector.Middleware())
+	engine.GET("/health", func(c *gin.Context) { c.String(http.StatusOK, "UP") })
+	engine.GET("/api/v1/users/*proxyPath", func(c *gin.Context) {
+		c.Set(ServiceKey, "user-service")
+		if c.Param("proxyPath") == "/broken" {
+			c.Status(http.StatusBadGateway)
+			return
+		}
+		c.String(http.StatusOK, "user")
+	})
+	return engine
+}
+
+func get(engine *gin.Engine, path string) {
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+}
+
+func TestCollectorsAreIndependent(t *testing.T) {
+	// Registering the same metrics twice on one registry would panic
+	first := NewCollector(prometheus.NewRegistry())
+	second := NewCollector(prometheus.NewRegistry())
+
+	get(newTestEngine(first), "/health")
+	if got := testutil.ToFloat64(second.requestsTotal.WithLabelValues("GET", "/health", GatewayService, "200")); got != 0 {
+		t.Errorf("second collector counted %v requests, want 0", got)
+	}
+}
+
+func TestMiddlewareRecordsRouteTemplates(t *testing.T) {
+	collector := NewCollector(prometheus.NewRegistry())
+	engine := newTestEngine(collector)
+
+	get(engine, "/health")
+	get(engine, "/api/v1/users/1")
+	get(engine, "/api/v1/users/2")
+	get(engine, "/api/v1/users/broken")
+	get(engine, "/missing/42")
+
+	expected := `
+# HELP api_gateway_requests_total Total number of requests processed by the API Gateway
+# TYPE api_gateway_requests_total counter
+api_gateway_requests_total{method="GET",route="/api/v1/users/*proxyPath",service="user-service",status="200"} 2
+api_gateway_requests_total{method="GET",route="/api/v1/users/*proxyPath",service="user-service",status="502"} 1
+api_gateway_requests_total{method="GET",route="/health",service="gateway",status="200"} 1
+api_gateway_requests_total{method="GET",route="unmatched",service="gateway",status="404"} 1
+`
+	if err := testutil.CollectAndCompare(collector.requestsTotal, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+	if got := testutil.CollectAndCount(collector.requestDuration); got != 3 {
+		t.Errorf("duration series = %d, want 3", got)
+	}
+
+	stats := collector.ServiceStats("user-service")
+	if stats.Requests != 3 || stats.ServerErrors != 1 || stats.ClientErrors != 0 {
+		t.Errorf("stats = %+v, want 3 requests with 1 server error", stats)
+	}
+	if rate := stats.SuccessRate(); rate < 0.66 || rate > 0.67 {
+		t.Errorf("success rate = %v, want 2/3", rate)
+	}
+}
+
+func TestHandlerExposesRegistry(t *testing.T) {
+	collector := NewCollector(prometheus.NewRegistry())
+	get(newTestEngine(collector), "/health")
+
+	w := httptest.NewRecorder()
+	collector.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `api_gateway_requests_total{method="GET",route="/health"`) {
+		t.Errorf("metrics output lacks the request counter:\n%s", w.Body)
+	}
+}
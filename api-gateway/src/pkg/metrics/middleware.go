@@ -0,0 +1,57 @@
+// pkg/metrics/middleware.go
+
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServiceKey is the gin context key the proxy stores the backend service
+// of a request under
+const ServiceKey = "metricsService"
+
+// Label values of requests not tied to a backend or a route
+const (
+	GatewayService = "gateway"   // Requests answered by the gateway itself
+	UnmatchedRoute = "unmatched" // Requests matching no route, e.g. 404s
+	otherMethod    = "OTHER"     // Non-standard request methods
+)
+
+// knownMethods are the request methods used as label values as is
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true,
+	http.MethodPut: true, http.MethodPatch: true, http.MethodDelete: true,
+	http.MethodConnect: true, http.MethodOptions: true, http.MethodTrace: true,
+}
+
+// Middleware records the count, duration and response size of every
+// request. It must run before the recovery middleware so that requests
+// failing with a panic are counted as 500s.
+func (c *Collector) Middleware() gin.HandlerFunc {
+	return func(gc *gin.Context) {
+		method := gc.Request.Method
+		if !knownMethods[method] {
+			method = otherMethod
+		}
+
+		start := time.Now()
+		c.IncRequestsInFlight(method)
+		defer c.DecRequestsInFlight(method)
+
+		gc.Next()
+
+		route := gc.FullPath()
+		if route == "" {
+			route = UnmatchedRoute
+		}
+		service := gc.GetString(ServiceKey)
+		if service == "" {
+			service = GatewayService
+		}
+
+		c.RecordRequest(method, route, service, gc.Writer.Status(), time.Since(start), gc.Writer.Size())
+	}
+}
@@ -0,0 +1,117 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	callerTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	traceparent   = "00-" + callerTraceID + "-00f067aa0ba902b7-01"
+)
+
+// newTestGateway routes /items/:id through the tracing middleware to a
+// handler calling backend in a client span
+func newTestGateway(t *testing.T, backend http.HandlerFunc) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	server := httptest.NewServer(backend)
+	t.Cleanup(server.Close)
+
+	engine := gin.New()
+	engine.Use(Middleware())
+	engine.GET("/items/:id", func(c *gin.Context) {
+		req, _ := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, server.URL, nil)
+		req, span := StartClient(req, "backend")
+		defer span.End()
+
+		resp, err := http.DefaultClient.Do(req)
+		RecordResponse(span, resp, err)
+		if err != nil {
+			c.Status(http.StatusBadGateway)
+			return
+		}
+		resp.Body.Close()
+		c.Status(resp.StatusCode)
+	})
+	return engine
+}
+
+// send sends a GET request continuing the caller's trace
+func send(engine *gin.Engine) {
+	req := httptest.NewRequest(http.MethodGet, "/items/42", nil)
+	req.Header.Set("traceparent", traceparent)
+	req.Header.Set("baggage", "tenant=clinic-7")
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestSpansAndPropagation(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	if _, err := Setup(context.Background(), &config.TracingConfig{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var forwarded http.Header
+	send(newTestGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Clone()
+	}))
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want 2", len(spans))
+	}
+	client, server := spans[0], spans[1]
+
+	if server.Name() != "GET /items/:id" || server.SpanKind() != trace.SpanKindServer {
+		t.Errorf("server span = %q (%v), want GET /items/:id", server.Name(), server.SpanKind())
+	}
+	if got := server.Parent().TraceID().String(); got != callerTraceID {
+		t.Errorf("server span trace = %s, want the caller's %s", got, callerTraceID)
+	}
+	if client.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Error("client span is not a child of the server span")
+	}
+
+	want := "00-" + callerTraceID + "-" + client.SpanContext().SpanID().String() + "-01"
+	if got := forwarded.Get("traceparent"); got != want {
+		t.Errorf("forwarded traceparent = %q, want %q", got, want)
+	}
+	if got := forwarded.Get("baggage"); got != "tenant=clinic-7" {
+		t.Errorf("forwarded baggage = %q, want the caller's", got)
+	}
+}
+
+func TestPropagationWhileDisabled(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(noop.NewTracerProvider())
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	if _, err := Setup(context.Background(), &config.TracingConfig{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var forwarded string
+	send(newTestGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get("traceparent")
+	}))
+
+	if forwarded != traceparent {
+		t.Errorf("forwarded traceparent = %q, want the caller's %q", forwarded, traceparent)
+	}
+}
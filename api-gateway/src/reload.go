@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/api/handlers"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/middlewares/auth"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/middlewares/ratelimit"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/routes"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/services"
+	"go.uber.org/zap"
+)
+
+// restartSettings are read once at startup. Changes to them are reported
+// and take effect after a restart.
+var restartSettings = []string{
+	"server",
+	"redis",
+	"cache",
+	"tracing",
+	"rateLimitFallback",
+	"auth.revocation",
+	"services.healthCheckInterval",
+}
+
+// reloader applies configuration changes to the running gateway: routes,
+// service endpoints, rate limits and authentication settings
+type reloader struct {
+	path       string
+	current    *config.Config
+	discovery  *services.ServiceDiscovery
+	handlers   *handlers.Handlers
+	jwtAuth    *auth.JWTAuthMiddleware
+	policies   *auth.PolicyEnforcer
+	rateLimits *ratelimit.PolicyEngine
+	router     *routes.Router
+	logger     *zap.Logger
+}
+
+// run reloads the configuration whenever its file or a file it references
+// changes, or the process receives SIGHUP, until ctx is done
+func (r *reloader) run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for ctx.Err() == nil {
+		r.watchFiles(ctx, hup)
+	}
+}
+
+// watchFiles reloads the configuration on SIGHUP and changes of the watched
+// files until ctx is done or a reload adds or drops file references
+func (r *reloader) watchFiles(ctx context.Context, hup <-chan os.Signal) {
+	watched := r.watchedFiles()
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	changes := r.watch(watchCtx, watched)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.reload("signal")
+		case <-changes:
+			r.reload("file change")
+		}
+
+		if !slices.Equal(r.watchedFiles(), watched) {
+			return
+		}
+	}
+}
+
+// watchedFiles returns the configuration file and the files its current
+// settings reference
+func (r *reloader) watchedFiles() []string {
+	return append([]string{r.path}, r.current.ReferencedFiles()...)
+}
+
+// watch reports changes of files. Without a watcher the returned channel is
+// nil and only SIGHUP reloads.
+func (r *reloader) watch(ctx context.Context, files []string) <-chan struct{} {
+	changes, err := config.WatchFiles(ctx, files, r.logger)
+	if err != nil {
+		r.logger.Warn("Failed to watch configuration files, reloading on SIGHUP only", zap.Error(err))
+	}
+	return changes
+}
+
+// reload loads, validates and applies the configuration. The current
+// configuration stays in place if the new one is invalid or fails to apply.
+func (r *reloader) reload(trigger string) {
+	cfg, err := config.NewConfigLoader(r.path).Load()
+	if err != nil {
+		r.logger.Error("Failed to reload configuration, keeping current configuration",
+			zap.String("trigger", trigger),
+			zap.Error(err),
+		)
+		return
+	}
+
+	changes := config.Diff(r.current, cfg)
+	if len(changes) == 0 {
+		r.logger.Info("Configuration unchanged", zap.String("trigger", trigger))
+		return
+	}
+
+	if err := r.apply(cfg); err != nil {
+		r.logger.Error("Failed to apply configuration, keeping current configuration",
+			zap.String("trigger", trigger),
+			zap.Error(err),
+		)
+		// Restore the settings replaced before the failure
+		if err := r.apply(r.current); err != nil {
+			r.logger.Error("Failed to restore configuration", zap.Error(err))
+		}
+		return
+	}
+	r.current = cfg
+
+	applied := make([]string, 0, len(changes))
+	var pending []string
+	for _, change := range changes {
+		applied = append(applied, change.String())
+		if requiresRestart(change.Path) {
+			pending = append(pending, change.Path)
+		}
+	}
+
+	r.logger.Info("Configuration reloaded",
+		zap.String("trigger", trigger),
+		zap.Strings("changes", applied),
+	)
+	if len(pending) > 0 {
+		r.logger.Warn("Some configuration changes take effect after a restart", zap.Strings("settings", pending))
+	}
+}
+
+// apply replaces the reloadable settings with those of cfg. The routes are
+// built first and put in place last, once every other setting is applied;
+// nothing changes when they cannot be registered. Settings that may fail to
+// load, such as key files, are applied before the others.
+func (r *reloader) apply(cfg *config.Config) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+
+	engine, err := r.router.Build(cfg)
+	if err != nil {
+		return fmt.Errorf("routes: %w", err)
+	}
+
+	if err := r.jwtAuth.Update(&cfg.Auth); err != nil {
+		return fmt.Errorf("auth: %w", err)
+	}
+	if err := r.policies.Update(cfg.Policies); err != nil {
+		return fmt.Errorf("policies: %w", err)
+	}
+	if err := r.rateLimits.Update(cfg); err != nil {
+		return fmt.Errorf("rate limits: %w", err)
+	}
+	if err := r.discovery.Update(&cfg.Services); err != nil {
+		return fmt.Errorf("services: %w", err)
+	}
+
+	// Swap the routes last so they find their services registered
+	r.handlers.Update(cfg)
+	r.router.Swap(cfg, engine)
+	return nil
+}
+
+// requiresRestart reports whether the setting at path is only read at startup
+func requiresRestart(path string) bool {
+	for _, prefix := range restartSettings {
+		if path == prefix || strings.HasPrefix(path, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
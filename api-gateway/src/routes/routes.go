@@ -1,92 +1,205 @@
 package routes
 
 import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
 	"github.com/Mir00r/api-gateway/src/api-gateway/src/api/handlers"
 	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
-	_ "github.com/Mir00r/api-gateway/src/api-gateway/src/middlewares/auth"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/middlewares/auth"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/middlewares/httpcache"
 	"github.com/Mir00r/api-gateway/src/api-gateway/src/middlewares/logging"
 	"github.com/Mir00r/api-gateway/src/api-gateway/src/middlewares/ratelimit"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/metrics"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/tracing"
 	"github.com/gin-gonic/gin"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
 )
 
-// Router handles all routing logic for the API Gateway
+// adminRole is the token role allowed to use the admin endpoints, as signed
+// by the authentication service
+const adminRole = "ADMIN"
+
+// Router handles all routing logic for the API Gateway. Routes can be
+// replaced at runtime with Update.
 type Router struct {
-	config   *config.Config
-	engine   *gin.Engine
-	handlers *handlers.Handlers
+	config     *config.Config
+	engine     atomic.Pointer[gin.Engine]
+	handlers   *handlers.Handlers
+	logger     *zap.Logger
+	jwtAuth    *auth.JWTAuthMiddleware
+	policies   *auth.PolicyEnforcer
+	rateLimits *ratelimit.PolicyEngine
+	cache      *httpcache.ResponseCache
+	metrics    *metrics.Collector
 }
 
 // NewRouter creates a new router instance
-func NewRouter(cfg *config.Config, handlers *handlers.Handlers) *Router {
+func NewRouter(cfg *config.Config, handlers *handlers.Handlers, jwtAuth *auth.JWTAuthMiddleware, policies *auth.PolicyEnforcer, rateLimits *ratelimit.PolicyEngine, cache *httpcache.ResponseCache, collector *metrics.Collector, logger *zap.Logger) *Router {
 	return &Router{
-		config:   cfg,
-		engine:   gin.New(),
-		handlers: handlers,
+		config:     cfg,
+		handlers:   handlers,
+		logger:     logger,
+		jwtAuth:    jwtAuth,
+		policies:   policies,
+		rateLimits: rateLimits,
+		cache:      cache,
+		metrics:    collector,
 	}
 }
 
 // Setup configures all routes and middleware
-func (r *Router) Setup() {
+func (r *Router) Setup() error {
+	engine, err := r.newEngine(r.config.Routes)
+	if err != nil {
+		return err
+	}
+	r.engine.Store(engine)
+	return nil
+}
+
+// Update atomically replaces the proxied routes with those of cfg. Requests
+// in flight complete on the previous routes. The current routes are kept if
+// the new ones cannot be registered.
+func (r *Router) Update(cfg *config.Config) error {
+	engine, err := r.Build(cfg)
+	if err != nil {
+		return err
+	}
+	r.Swap(cfg, engine)
+	return nil
+}
+
+// Build creates the engine serving the routes of cfg without putting it in
+// place, so a reload can check the routes before changing anything else
+func (r *Router) Build(cfg *config.Config) (*gin.Engine, error) {
+	return r.newEngine(cfg.Routes)
+}
+
+// Swap atomically puts an engine created by Build in place
+func (r *Router) Swap(cfg *config.Config, engine *gin.Engine) {
+	r.config = cfg
+	r.engine.Store(engine)
+}
+
+// ServeHTTP dispatches a request to the current routes
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.engine.Load().ServeHTTP(w, req)
+}
+
+// newEngine creates an engine serving the gateway's own endpoints and routes.
+// Routes conflicting with config.GatewayPaths or with each other are
+// reported instead of registered, gin panics on them.
+func (r *Router) newEngine(routes []config.RouteConfig) (engine *gin.Engine, err error) {
+	for i, route := range routes {
+		if conflict, ok := config.RouteConflict(routes, i); ok {
+			return nil, fmt.Errorf("route %s %s", route.PathPrefix, conflict)
+		}
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			engine, err = nil, fmt.Errorf("failed to register routes: %v", p)
+		}
+	}()
+
+	engine = gin.New()
+	requestLogger := logging.NewRequestLogger(r.logger)
+
+	// Assign request IDs first so every log line and response carries one,
+	// then start the request's span so all later middleware is traced
+	engine.Use(logging.RequestID())
+	engine.Use(tracing.Middleware())
+
+	// Record metrics outside recovery so panics count as 500s
+	engine.Use(r.metrics.Middleware())
+
 	// Use custom recovery middleware
-	r.engine.Use(logging.Recovery())
+	engine.Use(requestLogger.Recovery())
 
 	// Setup global middleware
-	r.engine.Use(logging.RequestLogger())
-	r.engine.Use(ratelimit.GlobalRateLimit(r.config))
+	engine.Use(requestLogger.LogRequest())
+	engine.Use(r.jwtAuth.Identify(), r.rateLimits.Global())
+
+	// The gateway's own endpoints are listed in config.GatewayPaths
 
 	// Health check endpoint
-	r.engine.GET("/health", r.handlers.HealthCheck)
+	engine.GET("/health", r.handlers.HealthCheck)
 
 	// Metrics endpoint
-	r.engine.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	engine.GET("/metrics", gin.WrapH(r.metrics.Handler()))
 
-	// API v1 routes
-	v1 := r.engine.Group("/api/v1")
+	// API v1 routes handled by the gateway itself
+	v1 := engine.Group("/api/v1")
 	{
 		// Public routes
 		public := v1.Group("/public")
 		{
-			public.POST("/login", r.handlers.Auth.Login)
-			public.POST("/register", r.handlers.Auth.Register)
+			public.POST("/login", r.handlers.Auth.HandleLogin)
+		}
+
+		// Authenticated routes
+		protected := v1.Group("/protected")
+		protected.Use(r.jwtAuth.Authenticate(), r.policies.Authorize(), r.rateLimits.Authenticated())
+		{
+			protected.POST("/logout", r.handlers.Auth.HandleLogout)
+			protected.POST("/refresh-token", r.handlers.Auth.HandleRefreshToken)
 		}
+	}
+
+	// Gateway administration
+	admin := engine.Group("/admin")
+	admin.Use(r.jwtAuth.Authenticate(), r.jwtAuth.RequireRoles(adminRole), r.policies.Authorize(), r.rateLimits.Authenticated())
+	{
+		admin.POST("/tokens/revoke", r.handlers.Admin.HandleRevokeToken)
+		admin.POST("/cache/purge", r.handlers.Admin.HandlePurgeCache)
+		admin.GET("/services", r.handlers.Admin.HandleListServices)
+		admin.GET("/services/:name", r.handlers.Admin.HandleGetService)
+		admin.POST("/services/:name/check", r.handlers.Admin.HandleCheckService)
+	}
+
+	// Proxied routes declared in configuration
+	for _, route := range routes {
+		r.registerRoute(engine, route)
+	}
+
+	return engine, nil
+}
+
+// registerRoute registers a configured route that proxies to a downstream service
+func (r *Router) registerRoute(engine *gin.Engine, route config.RouteConfig) {
+	group := engine.Group(strings.TrimSuffix(route.PathPrefix, "/"))
+	if route.AuthRequired {
+		group.Use(r.jwtAuth.Authenticate(), r.policies.Authorize(), r.rateLimits.Authenticated())
+	}
+	group.Use(r.cache.Handler(route))
+
+	handler := r.handlers.Proxy.ProxyRoute(route)
+
+	methods := route.Methods
+	if len(methods) == 0 {
+		methods = []string{
+			http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+			http.MethodPatch, http.MethodDelete, http.MethodOptions,
+		}
+	}
 
-		// Protected routes
-		//protected := v1.Group("/")
-		//protected.Use(auth.JWTAuth(r.config))
-		//{
-		//	// User service routes
-		//	users := protected.Group("/users")
-		//	{
-		//		users.GET("/", r.handlers.Users.GetUsers)
-		//		users.GET("/:id", r.handlers.Users.GetUser)
-		//		users.PUT("/:id", r.handlers.Users.UpdateUser)
-		//		users.DELETE("/:id", r.handlers.Users.DeleteUser)
-		//	}
-		//
-		//	// Notification service routes
-		//	notifications := protected.Group("/notifications")
-		//	{
-		//		notifications.GET("/", r.handlers.Notifications.GetNotifications)
-		//		notifications.POST("/", r.handlers.Notifications.CreateNotification)
-		//	}
-		//
-		//	// Appointment service routes
-		//	appointments := protected.Group("/appointments")
-		//	{
-		//		appointments.GET("/", r.handlers.Appointments.GetAppointments)
-		//		appointments.POST("/", r.handlers.Appointments.CreateAppointment)
-		//		appointments.PUT("/:id", r.handlers.Appointments.UpdateAppointment)
-		//		appointments.DELETE("/:id", r.handlers.Appointments.DeleteAppointment)
-		//	}
-		//}
+	for _, method := range methods {
+		method = strings.ToUpper(method)
+		group.Handle(method, "", handler)
+		group.Handle(method, "/*proxyPath", handler)
 	}
 
-	// Documentation routes
-	r.engine.GET("/docs/*any", r.handlers.ServeDocs)
+	r.logger.Info("route registered",
+		zap.String("prefix", route.PathPrefix),
+		zap.String("service", route.Service),
+		zap.Strings("methods", methods),
+		zap.Bool("auth_required", route.AuthRequired),
+	)
 }
 
-// GetEngine returns the configured Gin engine
+// GetEngine returns the current Gin engine
 func (r *Router) GetEngine() *gin.Engine {
-	return r.engine
+	return r.engine.Load()
 }
@@ -0,0 +1,141 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/api/handlers"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/middlewares/auth"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/middlewares/ratelimit"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/metrics"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/services"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestRouter creates a router for the routes of cfg, without setting it up
+func newTestRouter(t *testing.T, routes ...config.RouteConfig) *Router {
+	t.Helper()
+
+	cfg := &config.Config{
+		Auth: config.AuthConfig{SigningMode: "hmac", JWTSecret: "test-secret"},
+		Services: config.ServicesConfig{Registry: map[string]config.ServiceConfig{
+			"user-service": {BaseURL: "http://user-service:5000"},
+		}},
+		Routes: routes,
+	}
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	logger := zap.NewNop()
+	collector := metrics.NewCollector(prometheus.NewRegistry())
+	discovery := services.NewServiceDiscovery(&cfg.Services, collector, logger)
+	jwtAuth, err := auth.NewJWTAuthMiddleware(context.Background(), &cfg.Auth, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policies, err := auth.NewPolicyEnforcer(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rateLimits, err := ratelimit.NewPolicyEngine(cfg, client, collector, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := handlers.NewHandlers(cfg, discovery, nil, nil, collector, logger)
+	return NewRouter(cfg, h, jwtAuth, policies, rateLimits, nil, collector, logger)
+}
+
+func TestSetupRejectsConflictingRoutes(t *testing.T) {
+	users := config.RouteConfig{PathPrefix: "/api/v1/users", Service: "user-service"}
+
+	tests := []struct {
+		name   string
+		routes []config.RouteConfig
+		want   string
+	}{
+		{
+			name:   "nested prefixes",
+			routes: []config.RouteConfig{{PathPrefix: "/api/v1/accounts", Service: "user-service"}, {PathPrefix: "/api/v1/accounts/admins", Service: "user-service"}},
+			want:   "is nested under routes[0]",
+		},
+		{
+			name:   "gateway path",
+			routes: []config.RouteConfig{users, {PathPrefix: "/api/v1/public", Service: "user-service"}},
+			want:   "conflicts with the gateway path /api/v1/public/login",
+		},
+		{
+			name:   "rejected by gin",
+			routes: []config.RouteConfig{{PathPrefix: "/api/v1/*users", Service: "user-service"}},
+			want:   "failed to register routes",
+		},
+	}
+
+	for _, tt := range tests {
+		err := newTestRouter(t, tt.routes...).Setup()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Setup error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestUpdateKeepsRoutesOnConflict(t *testing.T) {
+	router := newTestRouter(t, config.RouteConfig{PathPrefix: "/api/v1/users", Service: "user-service"})
+	if err := router.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	engine := router.GetEngine()
+
+	err := router.Update(&config.Config{Routes: []config.RouteConfig{
+		{PathPrefix: "/api/v1/users", Service: "user-service"},
+		{PathPrefix: "/health", Service: "user-service"},
+	}})
+	if err == nil {
+		t.Fatal("Update accepted a route on /health")
+	}
+	if router.GetEngine() != engine {
+		t.Error("routes replaced after a failed update")
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /health = %d, want 200", w.Code)
+	}
+}
+
+func TestBuildLeavesRoutesInPlace(t *testing.T) {
+	router := newTestRouter(t, config.RouteConfig{PathPrefix: "/api/v1/users", Service: "user-service"})
+	if err := router.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	current := router.GetEngine()
+
+	cfg := &config.Config{Routes: []config.RouteConfig{{PathPrefix: "/api/v1/orders", Service: "order-service"}}}
+	engine, err := router.Build(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if router.GetEngine() != current {
+		t.Fatal("Build replaced the routes")
+	}
+
+	router.Swap(cfg, engine)
+	if router.GetEngine() != engine {
+		t.Error("Swap did not put the built routes in place")
+	}
+}
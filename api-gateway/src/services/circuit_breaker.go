@@ -0,0 +1,288 @@
+// services/circuit_breaker.go
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// ErrCircuitOpen is returned when a circuit breaker rejects a request
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState represents the state of a circuit breaker. The values match
+// the api_gateway_circuit_breaker_state metric.
+type CircuitState int
+
+const (
+	CircuitOpen     CircuitState = 0
+	CircuitHalfOpen CircuitState = 1
+	CircuitClosed   CircuitState = 2
+)
+
+// String returns the name of the state
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Circuit breaker defaults applied to zero config values
+const (
+	defaultFailureThreshold    = 5
+	defaultMinRequests         = 20
+	defaultWindowSecs          = 60
+	defaultOpenTimeoutSecs     = 30
+	defaultHalfOpenMaxRequests = 1
+)
+
+// CircuitOpenError is returned when a request is short-circuited
+type CircuitOpenError struct {
+	Name       string
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s: %v, retry after %s", e.Name, ErrCircuitOpen, e.RetryAfter)
+}
+
+// RetryAfterSeconds returns the Retry-After value in whole seconds
+func (e *CircuitOpenError) RetryAfterSeconds() int {
+	seconds := int(math.Ceil(e.RetryAfter.Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
+// Unwrap allows errors.Is(err, ErrCircuitOpen)
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// windowBucket counts requests within one second of the error rate window
+type windowBucket struct {
+	second   int64
+	total    int
+	failures int
+}
+
+// CircuitBreaker guards a backend with closed, open and half-open states
+type CircuitBreaker struct {
+	name      string
+	cfg       config.CircuitBreakerConfig
+	logger    *zap.Logger
+	collector *metrics.Collector
+	now       func() time.Time // Clock of the breaker, replaced in tests
+
+	mu                  sync.Mutex
+	state               CircuitState
+	consecutiveFailures int
+	buckets             []windowBucket
+	openedAt            time.Time
+	halfOpenInFlight    int
+	halfOpenSuccesses   int
+}
+
+// NewCircuitBreaker creates a closed circuit breaker
+func NewCircuitBreaker(name string, cfg config.CircuitBreakerConfig, collector *metrics.Collector, logger *zap.Logger) *CircuitBreaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaultFailureThreshold
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = defaultMinRequests
+	}
+	if cfg.WindowSecs <= 0 {
+		cfg.WindowSecs = defaultWindowSecs
+	}
+	if cfg.OpenTimeoutSecs <= 0 {
+		cfg.OpenTimeoutSecs = defaultOpenTimeoutSecs
+	}
+	if cfg.HalfOpenMaxRequests <= 0 {
+		cfg.HalfOpenMaxRequests = defaultHalfOpenMaxRequests
+	}
+
+	cb := &CircuitBreaker{
+		name:      name,
+		cfg:       cfg,
+		logger:    logger,
+		collector: collector,
+		now:       time.Now,
+		state:     CircuitClosed,
+		buckets:   make([]windowBucket, cfg.WindowSecs),
+	}
+	cb.collector.SetCircuitBreakerState(name, float64(CircuitClosed))
+
+	return cb
+}
+
+// Allow reports whether a request may proceed. On success the returned
+// function must be called with the outcome of the request.
+func (cb *CircuitBreaker) Allow() (func(success bool), error) {
+	if cb == nil {
+		return func(bool) {}, nil
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := cb.now()
+	if cb.state == CircuitOpen {
+		openTimeout := time.Duration(cb.cfg.OpenTimeoutSecs) * time.Second
+		if elapsed := now.Sub(cb.openedAt); elapsed < openTimeout {
+			return nil, &CircuitOpenError{Name: cb.name, RetryAfter: openTimeout - elapsed}
+		}
+		cb.transition(CircuitHalfOpen)
+	}
+
+	halfOpen := cb.state == CircuitHalfOpen
+	if halfOpen {
+		if cb.halfOpenInFlight >= cb.cfg.HalfOpenMaxRequests {
+			return nil, &CircuitOpenError{Name: cb.name, RetryAfter: time.Second}
+		}
+		cb.halfOpenInFlight++
+	}
+
+	var once sync.Once
+	return func(success bool) {
+		once.Do(func() { cb.record(success, halfOpen) })
+	}, nil
+}
+
+// IsOpen reports whether the breaker is open and still rejecting requests
+func (cb *CircuitBreaker) IsOpen() bool {
+	if cb == nil {
+		return false
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	return cb.state == CircuitOpen &&
+		cb.now().Sub(cb.openedAt) < time.Duration(cb.cfg.OpenTimeoutSecs)*time.Second
+}
+
+// State returns the current state of the breaker
+func (cb *CircuitBreaker) State() CircuitState {
+	if cb == nil {
+		return CircuitClosed
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	return cb.state
+}
+
+// record updates the breaker with the outcome of a request
+func (cb *CircuitBreaker) record(success, probe bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if probe {
+		cb.halfOpenInFlight--
+	}
+
+	// Results of requests admitted in another state only count toward the window
+	if probe && cb.state == CircuitHalfOpen {
+		if !success {
+			cb.transition(CircuitOpen)
+			return
+		}
+		cb.halfOpenSuccesses++
+		if cb.halfOpenSuccesses >= cb.cfg.HalfOpenMaxRequests {
+			cb.transition(CircuitClosed)
+		}
+		return
+	}
+
+	cb.observe(success)
+	if cb.state != CircuitClosed {
+		return
+	}
+
+	if success {
+		cb.consecutiveFailures = 0
+		return
+	}
+
+	cb.consecutiveFailures++
+	if cb.consecutiveFailures >= cb.cfg.FailureThreshold {
+		cb.transition(CircuitOpen)
+		return
+	}
+
+	if cb.cfg.ErrorRateThreshold > 0 {
+		total, failures := cb.windowCounts()
+		if total >= cb.cfg.MinRequests && float64(failures)/float64(total) >= cb.cfg.ErrorRateThreshold {
+			cb.transition(CircuitOpen)
+		}
+	}
+}
+
+// observe adds a result to the error rate window
+func (cb *CircuitBreaker) observe(success bool) {
+	second := cb.now().Unix()
+	bucket := &cb.buckets[second%int64(len(cb.buckets))]
+	if bucket.second != second {
+		*bucket = windowBucket{second: second}
+	}
+
+	bucket.total++
+	if !success {
+		bucket.failures++
+	}
+}
+
+// windowCounts sums the requests and failures within the window
+func (cb *CircuitBreaker) windowCounts() (int, int) {
+	oldest := cb.now().Unix() - int64(len(cb.buckets))
+
+	var total, failures int
+	for _, bucket := range cb.buckets {
+		if bucket.second > oldest {
+			total += bucket.total
+			failures += bucket.failures
+		}
+	}
+	return total, failures
+}
+
+// transition moves the breaker to a new state, resetting counters
+func (cb *CircuitBreaker) transition(to CircuitState) {
+	from := cb.state
+	if from == to {
+		return
+	}
+
+	cb.state = to
+	cb.consecutiveFailures = 0
+	cb.halfOpenSuccesses = 0
+
+	switch to {
+	case CircuitOpen:
+		cb.openedAt = cb.now()
+	case CircuitClosed:
+		cb.buckets = make([]windowBucket, len(cb.buckets))
+	}
+
+	cb.collector.SetCircuitBreakerState(cb.name, float64(to))
+	cb.logger.Info("circuit breaker state changed",
+		zap.String("breaker", cb.name),
+		zap.String("from", from.String()),
+		zap.String("to", to.String()),
+	)
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// fakeClock is a clock that only moves when the test advances it
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// newTestBreaker creates a circuit breaker running on a fake clock
+func newTestBreaker(cfg config.CircuitBreakerConfig) (*CircuitBreaker, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	cb := NewCircuitBreaker("test", cfg, metrics.NewCollector(prometheus.NewRegistry()), zap.NewNop())
+	cb.now = clock.Now
+	return cb, clock
+}
+
+// send passes one request with the given outcome through the breaker
+func send(t *testing.T, cb *CircuitBreaker, success bool) {
+	t.Helper()
+
+	done, err := cb.Allow()
+	if err != nil {
+		t.Fatalf("Allow error = %v, want the request admitted", err)
+	}
+	done(success)
+}
+
+// assertState fails the test when the breaker is not in state want
+func assertState(t *testing.T, cb *CircuitBreaker, want CircuitState) {
+	t.Helper()
+
+	if got := cb.State(); got != want {
+		t.Fatalf("state = %s, want %s", got, want)
+	}
+}
+
+func TestCircuitBreakerOpensOnConsecutiveFailures(t *testing.T) {
+	cb, clock := newTestBreaker(config.CircuitBreakerConfig{FailureThreshold: 3, OpenTimeoutSecs: 30})
+
+	// A success resets the consecutive failure count
+	send(t, cb, false)
+	send(t, cb, false)
+	send(t, cb, true)
+	send(t, cb, false)
+	send(t, cb, false)
+	assertState(t, cb, CircuitClosed)
+
+	send(t, cb, false)
+	assertState(t, cb, CircuitOpen)
+	if !cb.IsOpen() {
+		t.Error("IsOpen = false, want true")
+	}
+
+	clock.advance(10 * time.Second)
+	_, err := cb.Allow()
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) || !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Allow error = %v, want a *CircuitOpenError", err)
+	}
+	if openErr.RetryAfter != 20*time.Second || openErr.RetryAfterSeconds() != 20 {
+		t.Errorf("RetryAfter = %s, want 20s", openErr.RetryAfter)
+	}
+}
+
+func TestCircuitBreakerOpensOnErrorRate(t *testing.T) {
+	cb, clock := newTestBreaker(config.CircuitBreakerConfig{
+		FailureThreshold:   100,
+		ErrorRateThreshold: 0.5,
+		MinRequests:        10,
+		WindowSecs:         10,
+	})
+
+	// Failures that left the window no longer count
+	for i := 0; i < 8; i++ {
+		send(t, cb, false)
+	}
+	clock.advance(11 * time.Second)
+	send(t, cb, false)
+	assertState(t, cb, CircuitClosed)
+
+	// Below the minimum number of requests the rate is not evaluated
+	for i := 0; i < 4; i++ {
+		send(t, cb, true)
+		clock.advance(time.Second)
+		send(t, cb, false)
+	}
+	assertState(t, cb, CircuitClosed)
+
+	// Successes never open the circuit, the next failure makes 6 of 11
+	send(t, cb, true)
+	assertState(t, cb, CircuitClosed)
+	clock.advance(time.Second)
+	send(t, cb, false)
+	assertState(t, cb, CircuitOpen)
+}
+
+func TestCircuitBreakerHalfOpenProbes(t *testing.T) {
+	cb, clock := newTestBreaker(config.CircuitBreakerConfig{
+		FailureThreshold:    1,
+		OpenTimeoutSecs:     30,
+		HalfOpenMaxRequests: 2,
+	})
+
+	send(t, cb, false)
+	assertState(t, cb, CircuitOpen)
+
+	// Once the open timeout passes, a limited number of probes are admitted
+	clock.advance(30 * time.Second)
+	if cb.IsOpen() {
+		t.Error("IsOpen = true after the open timeout, want false")
+	}
+	first, err := cb.Allow()
+	if err != nil {
+		t.Fatalf("first probe rejected: %v", err)
+	}
+	assertState(t, cb, CircuitHalfOpen)
+	second, err := cb.Allow()
+	if err != nil {
+		t.Fatalf("second probe rejected: %v", err)
+	}
+	if _, err := cb.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("third probe error = %v, want %v", err, ErrCircuitOpen)
+	}
+
+	// Every probe has to succeed before the circuit closes
+	first(true)
+	assertState(t, cb, CircuitHalfOpen)
+	second(true)
+	assertState(t, cb, CircuitClosed)
+}
+
+func TestCircuitBreakerFailedProbeReopens(t *testing.T) {
+	cb, clock := newTestBreaker(config.CircuitBreakerConfig{FailureThreshold: 1, OpenTimeoutSecs: 30})
+
+	send(t, cb, false)
+	clock.advance(30 * time.Second)
+	send(t, cb, false)
+	assertState(t, cb, CircuitOpen)
+
+	// The open timeout starts over from the failed probe
+	clock.advance(20 * time.Second)
+	if !cb.IsOpen() {
+		t.Error("IsOpen = false 20s after the failed probe, want true")
+	}
+	clock.advance(10 * time.Second)
+	send(t, cb, true)
+	assertState(t, cb, CircuitClosed)
+}
+
+func TestCircuitBreakerIgnoresLateResults(t *testing.T) {
+	cb, clock := newTestBreaker(config.CircuitBreakerConfig{FailureThreshold: 1, OpenTimeoutSecs: 30})
+
+	// A request admitted while closed finishes after the circuit opened
+	slow, err := cb.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	send(t, cb, false)
+	clock.advance(30 * time.Second)
+	probe, err := cb.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the probe decides whether the half-open circuit closes
+	slow(true)
+	assertState(t, cb, CircuitHalfOpen)
+	probe(true)
+	assertState(t, cb, CircuitClosed)
+}
+
+func TestNilCircuitBreaker(t *testing.T) {
+	var cb *CircuitBreaker
+
+	done, err := cb.Allow()
+	if err != nil {
+		t.Fatalf("Allow error = %v, want nil", err)
+	}
+	done(false)
+	if cb.IsOpen() || cb.State() != CircuitClosed {
+		t.Error("a nil breaker must behave like a closed one")
+	}
+}
@@ -5,16 +5,21 @@ package services
 import (
 	"context"
 	"fmt"
+	"maps"
+	"net/http"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/metrics"
 	"go.uber.org/zap"
 )
 
 // ServiceDiscovery handles service discovery and health monitoring
 type ServiceDiscovery struct {
 	registry    *ServiceRegistry
+	collector   *metrics.Collector
 	logger      *zap.Logger
 	config      *config.ServicesConfig
 	healthCheck *HealthChecker
@@ -27,9 +32,13 @@ type ServiceInfo struct {
 	URL          string
 	Status       ServiceStatus
 	LastChecked  time.Time
-	ResponseTime time.Duration
-	ErrorCount   int64
-	SuccessCount int64
+	ResponseTime time.Duration // Of the last health check
+	ErrorCount   int64         // Failed health checks
+	SuccessCount int64         // Successful health checks
+	Weight       int
+	Latency      LatencyPercentiles // Of recent proxied requests
+	Circuit      CircuitState
+	InFlight     int64
 }
 
 type ServiceStatus string
@@ -41,9 +50,10 @@ const (
 )
 
 // NewServiceDiscovery creates a new service discovery instance
-func NewServiceDiscovery(cfg *config.ServicesConfig, logger *zap.Logger) *ServiceDiscovery {
+func NewServiceDiscovery(cfg *config.ServicesConfig, collector *metrics.Collector, logger *zap.Logger) *ServiceDiscovery {
 	sd := &ServiceDiscovery{
-		registry:    NewServiceRegistry(cfg, logger),
+		registry:    NewServiceRegistry(cfg, collector, logger),
+		collector:   collector,
 		logger:      logger,
 		config:      cfg,
 		healthCheck: NewHealthChecker(logger),
@@ -67,68 +77,250 @@ func (sd *ServiceDiscovery) Start(ctx context.Context) error {
 
 // initializeServices registers all configured services
 func (sd *ServiceDiscovery) initializeServices() error {
-	services := []struct {
-		name   string
-		config config.ServiceConfig
-	}{
-		{"user-service", sd.config.UserService},
-		{"notification-service", sd.config.NotificationService},
-		{"appointment-service", sd.config.AppointmentService},
-	}
-
-	for _, svc := range services {
-		if err := sd.registerService(svc.name, svc.config); err != nil {
-			return fmt.Errorf("failed to register service %s: %w", svc.name, err)
+	services := sd.config.Registry
+	for _, name := range slices.Sorted(maps.Keys(services)) {
+		if err := sd.registerService(name, services[name]); err != nil {
+			return fmt.Errorf("failed to register service %s: %w", name, err)
 		}
 	}
 
 	return nil
 }
 
-// registerService registers a new service
-func (sd *ServiceDiscovery) registerService(name string, cfg config.ServiceConfig) error {
-	//serviceInfo := &ServiceInfo{
-	//	Name:   name,
-	//	URL:    cfg.BaseURL,
-	//	Status: StatusUnknown,
-	//}
+// Update reconciles the registered services with cfg and replaces them
+// atomically. Instances whose endpoint, weight, health check and circuit
+// breaker settings are unchanged are kept as is; changed instances keep
+// their health, and new ones are health checked right away. The current
+// services are kept if a service cannot be created.
+func (sd *ServiceDiscovery) Update(cfg *config.ServicesConfig) error {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	pools := make(map[string][]*ServiceInstance)
+	balancers := make(map[string]LoadBalancer)
+	transports := make(map[*http.Transport]bool)
+	var unchecked []*ServiceInstance
+
+	for name, svc := range cfg.Registry {
+		lb, err := NewLoadBalancer(svc.LoadBalancer, svc.HashHeader)
+		if err != nil {
+			return fmt.Errorf("service %s: %w", name, err)
+		}
+
+		current, _ := sd.registry.GetService(name)
+		prev, existed := sd.config.Registry[name]
+		keepBreakers := existed && prev.CircuitBreaker == svc.CircuitBreaker
+		keepTransport := existed && prev.TLS == svc.TLS && len(current) > 0
+		keepInstances := keepBreakers && keepTransport && prev.HealthCheck == svc.HealthCheck
+
+		var transport *http.Transport
+		if keepTransport {
+			transport = current[0].Transport()
+		} else if transport, err = newServiceTransport(svc.TLS); err != nil {
+			return fmt.Errorf("service %s: %w", name, err)
+		}
+		transports[transport] = true
+
+		pool, fresh := sd.reconcilePool(name, svc, current, transport, keepBreakers, keepInstances)
+		pools[name] = pool
+		balancers[name] = lb
+		unchecked = append(unchecked, fresh...)
+	}
+
+	previous := sd.registry.ListServices()
+	sd.registry.replaceServices(pools, balancers)
+	sd.config = cfg
+
+	// Close the idle connections of transports no longer in use
+	for _, instance := range previous {
+		if transport := instance.Transport(); !transports[transport] && transport != defaultTransport {
+			transport.CloseIdleConnections()
+		}
+	}
+
+	for _, instance := range unchecked {
+		go sd.healthCheck.CheckServiceHealth(instance, sd.registry)
+	}
+
+	sd.logger.Info("services updated",
+		zap.Int("services", len(pools)),
+		zap.Int("new_instances", len(unchecked)),
+	)
+	return nil
+}
+
+// reconcilePool creates the instances of a service from its configuration,
+// reusing the current breakers and unchanged instances if allowed. It also
+// returns the instances that have never been health checked.
+func (sd *ServiceDiscovery) reconcilePool(name string, cfg config.ServiceConfig, current []*ServiceInstance, transport *http.Transport, keepBreakers, keepInstances bool) ([]*ServiceInstance, []*ServiceInstance) {
+	byURL := make(map[string]*ServiceInstance, len(current))
+	for _, instance := range current {
+		byURL[instance.BaseURL] = instance
+	}
+
+	// Share one breaker across the pool unless configured per instance
+	var breaker *CircuitBreaker
+	if !cfg.CircuitBreaker.PerInstance {
+		if keepBreakers && len(current) > 0 {
+			breaker = current[0].breaker
+		} else {
+			breaker = NewCircuitBreaker(name, cfg.CircuitBreaker, sd.collector, sd.logger)
+		}
+	}
+
+	var pool, fresh []*ServiceInstance
+	for _, endpoint := range cfg.Endpoints() {
+		existing := byURL[endpoint.BaseURL]
+		if keepInstances && existing != nil && existing.Weight == endpoint.Weight {
+			pool = append(pool, existing)
+			continue
+		}
 
+		instance := &ServiceInstance{
+			Name:      name,
+			BaseURL:   endpoint.BaseURL,
+			HealthURL: cfg.HealthCheck,
+			Weight:    endpoint.Weight,
+			breaker:   breaker,
+			transport: transport,
+		}
+		if cfg.CircuitBreaker.PerInstance {
+			if keepBreakers && existing != nil {
+				instance.breaker = existing.breaker
+			} else {
+				instance.breaker = NewCircuitBreaker(name+"@"+endpoint.BaseURL, cfg.CircuitBreaker, sd.collector, sd.logger)
+			}
+		}
+
+		if existing == nil {
+			fresh = append(fresh, instance)
+		} else {
+			// Health fields are updated under the registry lock
+			sd.registry.mu.RLock()
+			instance.IsHealthy = existing.IsHealthy
+			instance.LastChecked = existing.LastChecked
+			instance.ResponseTime = existing.ResponseTime
+			instance.ErrorCount = existing.ErrorCount
+			instance.SuccessCount = existing.SuccessCount
+			sd.registry.mu.RUnlock()
+		}
+		pool = append(pool, instance)
+	}
+
+	return pool, fresh
+}
+
+// registerService registers every instance of a service and its load balancer
+func (sd *ServiceDiscovery) registerService(name string, cfg config.ServiceConfig) error {
 	sd.mu.Lock()
 	defer sd.mu.Unlock()
 
-	if err := sd.registry.RegisterService(name, &ServiceInstance{
-		Name:      name,
-		BaseURL:   cfg.BaseURL,
-		HealthURL: cfg.HealthCheck,
-	}); err != nil {
+	lb, err := NewLoadBalancer(cfg.LoadBalancer, cfg.HashHeader)
+	if err != nil {
+		return err
+	}
+	transport, err := newServiceTransport(cfg.TLS)
+	if err != nil {
 		return err
 	}
+	sd.registry.SetLoadBalancer(name, lb)
+
+	// Share one breaker across the pool unless configured per instance
+	var breaker *CircuitBreaker
+	if !cfg.CircuitBreaker.PerInstance {
+		breaker = NewCircuitBreaker(name, cfg.CircuitBreaker, sd.collector, sd.logger)
+	}
+
+	for _, endpoint := range cfg.Endpoints() {
+		instanceBreaker := breaker
+		if cfg.CircuitBreaker.PerInstance {
+			instanceBreaker = NewCircuitBreaker(name+"@"+endpoint.BaseURL, cfg.CircuitBreaker, sd.collector, sd.logger)
+		}
+
+		if err := sd.registry.RegisterService(name, &ServiceInstance{
+			Name:      name,
+			BaseURL:   endpoint.BaseURL,
+			HealthURL: cfg.HealthCheck,
+			Weight:    endpoint.Weight,
+			breaker:   instanceBreaker,
+			transport: transport,
+		}); err != nil {
+			return err
+		}
+	}
 
 	sd.logger.Info("service registered",
 		zap.String("name", name),
-		zap.String("url", cfg.BaseURL),
+		zap.Int("instances", len(cfg.Endpoints())),
+		zap.String("load_balancer", cfg.LoadBalancer),
 	)
 
 	return nil
 }
 
-// GetService returns information about a specific service
-func (sd *ServiceDiscovery) GetService(name string) (*ServiceInfo, error) {
+// Registry returns the underlying service registry
+func (sd *ServiceDiscovery) Registry() *ServiceRegistry {
+	return sd.registry
+}
+
+// GetService returns information about every instance of a service
+func (sd *ServiceDiscovery) GetService(name string) ([]*ServiceInfo, error) {
 	sd.mu.RLock()
 	defer sd.mu.RUnlock()
 
-	service, err := sd.registry.GetService(name)
+	instances, err := sd.registry.GetService(name)
 	if err != nil {
 		return nil, fmt.Errorf("service not found: %w", err)
 	}
 
-	return &ServiceInfo{
-		Name:         service.Name,
-		URL:          service.BaseURL,
-		Status:       sd.getServiceStatus(service),
-		LastChecked:  service.LastChecked,
-		ResponseTime: service.ResponseTime,
-	}, nil
+	// Health fields are updated under the registry lock
+	sd.registry.mu.RLock()
+	defer sd.registry.mu.RUnlock()
+
+	infos := make([]*ServiceInfo, 0, len(instances))
+	for _, instance := range instances {
+		infos = append(infos, &ServiceInfo{
+			Name:         instance.Name,
+			URL:          instance.BaseURL,
+			Status:       sd.getServiceStatus(instance),
+			LastChecked:  instance.LastChecked,
+			ResponseTime: instance.ResponseTime,
+			ErrorCount:   instance.ErrorCount,
+			SuccessCount: instance.SuccessCount,
+			Weight:       instance.weight(),
+			Latency:      instance.Latency(),
+			Circuit:      instance.Breaker().State(),
+			InFlight:     instance.InFlight(),
+		})
+	}
+
+	return infos, nil
+}
+
+// ServiceNames returns the names of all registered services, sorted
+func (sd *ServiceDiscovery) ServiceNames() []string {
+	return sd.registry.ServiceNames()
+}
+
+// CheckService runs an immediate health check of every instance of a
+// service and returns their updated information
+func (sd *ServiceDiscovery) CheckService(name string) ([]*ServiceInfo, error) {
+	instances, err := sd.registry.GetService(name)
+	if err != nil {
+		return nil, fmt.Errorf("service not found: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	for _, instance := range instances {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sd.healthCheck.CheckServiceHealth(instance, sd.registry)
+		}()
+	}
+	wg.Wait()
+
+	return sd.GetService(name)
 }
 
 // startHealthChecks begins periodic health checking of services
@@ -7,29 +7,33 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+// healthCheckTimeout bounds a single health check
+const healthCheckTimeout = 5 * time.Second
+
 // HealthChecker handles health checking of registered services
 type HealthChecker struct {
-	logger     *zap.Logger
-	httpClient *http.Client
+	logger *zap.Logger
 }
 
 // NewHealthChecker creates a new health checker instance
 func NewHealthChecker(logger *zap.Logger) *HealthChecker {
 	return &HealthChecker{
 		logger: logger,
-		httpClient: &http.Client{
-			Timeout: 5 * time.Second,
-			Transport: &http.Transport{
-				MaxIdleConns:        100,
-				IdleConnTimeout:     90 * time.Second,
-				DisableCompression:  true,
-				MaxConnsPerHost:     10,
-				MaxIdleConnsPerHost: 10,
-			},
-		},
+	}
+}
+
+// client returns the client health checks of service are sent with, using
+// the service's transport so checks of https endpoints use its TLS settings
+func (hc *HealthChecker) client(service *ServiceInstance) *http.Client {
+	return &http.Client{
+		Transport: service.Transport(),
+		Timeout:   healthCheckTimeout,
 	}
 }
 
@@ -37,6 +41,9 @@ func NewHealthChecker(logger *zap.Logger) *HealthChecker {
 func (hc *HealthChecker) StartChecks(ctx context.Context, interval time.Duration, registry *ServiceRegistry) {
 	ticker := time.NewTicker(interval)
 	go func() {
+		// Check immediately so instances become routable without waiting a full interval
+		hc.checkServices(registry)
+
 		for {
 			select {
 			case <-ctx.Done():
@@ -49,7 +56,7 @@ func (hc *HealthChecker) StartChecks(ctx context.Context, interval time.Duration
 	}()
 }
 
-// checkServices performs health checks on all registered services
+// checkServices performs health checks on all registered service instances
 func (hc *HealthChecker) checkServices(registry *ServiceRegistry) {
 	services := registry.ListServices()
 
@@ -58,7 +65,7 @@ func (hc *HealthChecker) checkServices(registry *ServiceRegistry) {
 	}
 }
 
-// checkService performs a health check on a single service
+// checkService performs a health check on a single service instance
 func (hc *HealthChecker) checkService(service *ServiceInstance, registry *ServiceRegistry) {
 	startTime := time.Now()
 
@@ -67,63 +74,94 @@ func (hc *HealthChecker) checkService(service *ServiceInstance, registry *Servic
 	if err != nil {
 		hc.logger.Error("failed to create health check request",
 			zap.String("service", service.Name),
+			zap.String("instance", service.BaseURL),
 			zap.Error(err),
 		)
-		registry.UpdateServiceHealth(service.Name, false, 0)
+		registry.UpdateServiceHealth(service, false, 0)
 		return
 	}
 
-	resp, err := hc.httpClient.Do(req)
+	req, span := hc.startSpan(req, service)
+	defer span.End()
+
+	resp, err := hc.client(service).Do(req)
 	responseTime := time.Since(startTime)
+	tracing.RecordResponse(span, resp, err)
 
 	if err != nil {
 		hc.logger.Warn("health check failed",
 			zap.String("service", service.Name),
+			zap.String("instance", service.BaseURL),
 			zap.Error(err),
 			zap.Duration("response_time", responseTime),
 		)
-		registry.UpdateServiceHealth(service.Name, false, responseTime)
+		registry.UpdateServiceHealth(service, false, responseTime)
 		return
 	}
 	defer resp.Body.Close()
 
 	isHealthy := resp.StatusCode == http.StatusOK
-	registry.UpdateServiceHealth(service.Name, isHealthy, responseTime)
+	registry.UpdateServiceHealth(service, isHealthy, responseTime)
 
 	if !isHealthy {
 		hc.logger.Warn("service reported unhealthy status",
 			zap.String("service", service.Name),
+			zap.String("instance", service.BaseURL),
 			zap.Int("status_code", resp.StatusCode),
 			zap.Duration("response_time", responseTime),
 		)
 	} else {
 		hc.logger.Debug("health check successful",
 			zap.String("service", service.Name),
+			zap.String("instance", service.BaseURL),
 			zap.Duration("response_time", responseTime),
 		)
 	}
 }
 
-// CheckServiceHealth performs an immediate health check on a specific service
+// CheckServiceHealth performs an immediate health check on a specific service instance
 func (hc *HealthChecker) CheckServiceHealth(service *ServiceInstance, registry *ServiceRegistry) bool {
 	startTime := time.Now()
 
 	healthURL := service.BaseURL + service.HealthURL
-	resp, err := hc.httpClient.Get(healthURL)
+	req, err := http.NewRequest(http.MethodGet, healthURL, nil)
+	if err != nil {
+		hc.logger.Error("failed to create health check request",
+			zap.String("service", service.Name),
+			zap.String("instance", service.BaseURL),
+			zap.Error(err),
+		)
+		registry.UpdateServiceHealth(service, false, 0)
+		return false
+	}
+
+	req, span := hc.startSpan(req, service)
+	defer span.End()
+
+	resp, err := hc.client(service).Do(req)
 	responseTime := time.Since(startTime)
+	tracing.RecordResponse(span, resp, err)
 
 	if err != nil {
 		hc.logger.Warn("immediate health check failed",
 			zap.String("service", service.Name),
+			zap.String("instance", service.BaseURL),
 			zap.Error(err),
 		)
-		registry.UpdateServiceHealth(service.Name, false, responseTime)
+		registry.UpdateServiceHealth(service, false, responseTime)
 		return false
 	}
 	defer resp.Body.Close()
 
 	isHealthy := resp.StatusCode == http.StatusOK
-	registry.UpdateServiceHealth(service.Name, isHealthy, responseTime)
+	registry.UpdateServiceHealth(service, isHealthy, responseTime)
 
 	return isHealthy
 }
+
+// startSpan starts the trace of a health check request
+func (hc *HealthChecker) startSpan(req *http.Request, service *ServiceInstance) (*http.Request, trace.Span) {
+	return tracing.StartClient(req, "health_check "+service.Name,
+		attribute.String("gateway.service", service.Name),
+	)
+}
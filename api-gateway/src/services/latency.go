@@ -0,0 +1,64 @@
+// services/latency.go
+
+package services
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// latencySamples is the number of recent requests latency percentiles are
+// computed over
+const latencySamples = 512
+
+// LatencyPercentiles summarizes the latency of recent requests to an instance
+type LatencyPercentiles struct {
+	P50     time.Duration
+	P90     time.Duration
+	P99     time.Duration
+	Samples int
+}
+
+// latencyWindow keeps the latencies of the most recent requests in a ring
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+// observe records the latency of a request
+func (w *latencyWindow) observe(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.samples) < latencySamples {
+		w.samples = append(w.samples, d)
+		return
+	}
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % latencySamples
+}
+
+// percentiles computes the latency percentiles of the recorded requests
+func (w *latencyWindow) percentiles() LatencyPercentiles {
+	w.mu.Lock()
+	sorted := slices.Clone(w.samples)
+	w.mu.Unlock()
+
+	if len(sorted) == 0 {
+		return LatencyPercentiles{}
+	}
+	slices.Sort(sorted)
+
+	// Nearest-rank percentile
+	rank := func(p int) time.Duration {
+		return sorted[(len(sorted)*p+99)/100-1]
+	}
+	return LatencyPercentiles{
+		P50:     rank(50),
+		P90:     rank(90),
+		P99:     rank(99),
+		Samples: len(sorted),
+	}
+}
@@ -0,0 +1,149 @@
+// services/loadbalancer.go
+
+package services
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Supported load balancing strategies
+const (
+	StrategyRoundRobin         = "round-robin"
+	StrategyWeightedRoundRobin = "weighted-round-robin"
+	StrategyLeastInFlight      = "least-in-flight"
+	StrategyRandomTwoChoices   = "random-two-choices"
+	StrategyConsistentHash     = "consistent-hash"
+)
+
+// LoadBalancer selects one instance out of the available instances of a service
+type LoadBalancer interface {
+	// Select picks an instance for a request, instances is never empty
+	Select(instances []*ServiceInstance, headers http.Header) *ServiceInstance
+}
+
+// NewLoadBalancer creates a load balancer for the given strategy
+func NewLoadBalancer(strategy, hashHeader string) (LoadBalancer, error) {
+	switch strategy {
+	case "", StrategyRoundRobin:
+		return &roundRobinBalancer{}, nil
+	case StrategyWeightedRoundRobin:
+		return &weightedRoundRobinBalancer{current: make(map[string]int)}, nil
+	case StrategyLeastInFlight:
+		return &leastInFlightBalancer{}, nil
+	case StrategyRandomTwoChoices:
+		return &randomTwoChoicesBalancer{}, nil
+	case StrategyConsistentHash:
+		if hashHeader == "" {
+			return nil, fmt.Errorf("strategy %s requires a hash header", strategy)
+		}
+		return &consistentHashBalancer{header: hashHeader}, nil
+	default:
+		return nil, fmt.Errorf("unknown load balancing strategy %q", strategy)
+	}
+}
+
+// roundRobinBalancer cycles through instances in order
+type roundRobinBalancer struct {
+	next atomic.Uint64
+}
+
+func (b *roundRobinBalancer) Select(instances []*ServiceInstance, _ http.Header) *ServiceInstance {
+	n := b.next.Add(1) - 1
+	return instances[n%uint64(len(instances))]
+}
+
+// weightedRoundRobinBalancer implements smooth weighted round-robin
+type weightedRoundRobinBalancer struct {
+	mu      sync.Mutex
+	current map[string]int
+}
+
+func (b *weightedRoundRobinBalancer) Select(instances []*ServiceInstance, _ http.Header) *ServiceInstance {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var selected *ServiceInstance
+	total := 0
+	for _, instance := range instances {
+		weight := instance.weight()
+		total += weight
+		b.current[instance.BaseURL] += weight
+
+		if selected == nil || b.current[instance.BaseURL] > b.current[selected.BaseURL] {
+			selected = instance
+		}
+	}
+
+	b.current[selected.BaseURL] -= total
+	return selected
+}
+
+// leastInFlightBalancer picks the instance with the fewest requests in flight
+type leastInFlightBalancer struct {
+	roundRobinBalancer
+}
+
+func (b *leastInFlightBalancer) Select(instances []*ServiceInstance, headers http.Header) *ServiceInstance {
+	// Start from a rotating offset so ties are spread across instances
+	start := b.roundRobinBalancer.Select(instances, headers)
+
+	selected := start
+	for _, instance := range instances {
+		if instance.InFlight() < selected.InFlight() {
+			selected = instance
+		}
+	}
+	return selected
+}
+
+// randomTwoChoicesBalancer picks two random instances and keeps the less loaded one
+type randomTwoChoicesBalancer struct{}
+
+func (b *randomTwoChoicesBalancer) Select(instances []*ServiceInstance, _ http.Header) *ServiceInstance {
+	if len(instances) == 1 {
+		return instances[0]
+	}
+
+	i := rand.IntN(len(instances))
+	j := rand.IntN(len(instances) - 1)
+	if j >= i {
+		j++
+	}
+
+	if instances[j].InFlight() < instances[i].InFlight() {
+		return instances[j]
+	}
+	return instances[i]
+}
+
+// consistentHashBalancer maps a header value to an instance using rendezvous
+// hashing, so only keys of a removed instance move when the pool changes
+type consistentHashBalancer struct {
+	header   string
+	fallback roundRobinBalancer
+}
+
+func (b *consistentHashBalancer) Select(instances []*ServiceInstance, headers http.Header) *ServiceInstance {
+	key := headers.Get(b.header)
+	if key == "" {
+		return b.fallback.Select(instances, headers)
+	}
+
+	var selected *ServiceInstance
+	var highest uint64
+	for _, instance := range instances {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte(instance.BaseURL))
+
+		if score := h.Sum64(); selected == nil || score > highest {
+			selected, highest = instance, score
+		}
+	}
+	return selected
+}
@@ -0,0 +1,291 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// newTestInstances creates healthy instances with the given weights
+func newTestInstances(weights ...int) []*ServiceInstance {
+	instances := make([]*ServiceInstance, len(weights))
+	for i, weight := range weights {
+		instances[i] = &ServiceInstance{
+			Name:      "test-service",
+			BaseURL:   fmt.Sprintf("http://instance-%d", i),
+			Weight:    weight,
+			IsHealthy: true,
+		}
+	}
+	return instances
+}
+
+// selections counts how often each instance is selected out of n requests
+func selections(lb LoadBalancer, instances []*ServiceInstance, headers http.Header, n int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		counts[lb.Select(instances, headers).BaseURL]++
+	}
+	return counts
+}
+
+func TestNewLoadBalancer(t *testing.T) {
+	tests := []struct {
+		strategy   string
+		hashHeader string
+		wantErr    bool
+	}{
+		{strategy: ""},
+		{strategy: StrategyRoundRobin},
+		{strategy: StrategyWeightedRoundRobin},
+		{strategy: StrategyLeastInFlight},
+		{strategy: StrategyRandomTwoChoices},
+		{strategy: StrategyConsistentHash, hashHeader: "X-User-ID"},
+		{strategy: StrategyConsistentHash, wantErr: true},
+		{strategy: "fastest", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		lb, err := NewLoadBalancer(tt.strategy, tt.hashHeader)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewLoadBalancer(%q, %q) error = %v, want error %t", tt.strategy, tt.hashHeader, err, tt.wantErr)
+		}
+		if err == nil && lb == nil {
+			t.Errorf("NewLoadBalancer(%q, %q) returned no balancer", tt.strategy, tt.hashHeader)
+		}
+	}
+}
+
+func TestLoadBalancerDistribution(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		weights  []int
+		inFlight []int64
+		want     map[string]int
+	}{
+		{
+			name:     "round-robin cycles through instances",
+			strategy: StrategyRoundRobin,
+			weights:  []int{1, 1, 1},
+			want:     map[string]int{"http://instance-0": 4, "http://instance-1": 4, "http://instance-2": 4},
+		},
+		{
+			name:     "round-robin ignores weights",
+			strategy: StrategyRoundRobin,
+			weights:  []int{5, 1},
+			want:     map[string]int{"http://instance-0": 6, "http://instance-1": 6},
+		},
+		{
+			name:     "weighted round-robin follows weights",
+			strategy: StrategyWeightedRoundRobin,
+			weights:  []int{4, 1, 1},
+			want:     map[string]int{"http://instance-0": 8, "http://instance-1": 2, "http://instance-2": 2},
+		},
+		{
+			name:     "weighted round-robin treats unset weights as 1",
+			strategy: StrategyWeightedRoundRobin,
+			weights:  []int{0, 0, 2},
+			want:     map[string]int{"http://instance-0": 3, "http://instance-1": 3, "http://instance-2": 6},
+		},
+		{
+			name:     "least in-flight avoids busy instances",
+			strategy: StrategyLeastInFlight,
+			weights:  []int{1, 1, 1},
+			inFlight: []int64{3, 0, 1},
+			want:     map[string]int{"http://instance-1": 12},
+		},
+		{
+			name:     "least in-flight spreads ties",
+			strategy: StrategyLeastInFlight,
+			weights:  []int{1, 1, 1},
+			inFlight: []int64{2, 2, 2},
+			want:     map[string]int{"http://instance-0": 4, "http://instance-1": 4, "http://instance-2": 4},
+		},
+		{
+			name:     "random two choices keeps the less loaded instance",
+			strategy: StrategyRandomTwoChoices,
+			weights:  []int{1, 1},
+			inFlight: []int64{5, 0},
+			want:     map[string]int{"http://instance-1": 12},
+		},
+		{
+			name:     "random two choices with a single instance",
+			strategy: StrategyRandomTwoChoices,
+			weights:  []int{1},
+			want:     map[string]int{"http://instance-0": 12},
+		},
+		{
+			name:     "consistent hash without key falls back to round-robin",
+			strategy: StrategyConsistentHash,
+			weights:  []int{1, 1},
+			want:     map[string]int{"http://instance-0": 6, "http://instance-1": 6},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb, err := NewLoadBalancer(tt.strategy, "X-User-ID")
+			if err != nil {
+				t.Fatal(err)
+			}
+			instances := newTestInstances(tt.weights...)
+			for i, n := range tt.inFlight {
+				instances[i].inFlight.Store(n)
+			}
+
+			got := selections(lb, instances, http.Header{}, 12)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("selections = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeightedRoundRobinIsSmooth(t *testing.T) {
+	lb, _ := NewLoadBalancer(StrategyWeightedRoundRobin, "")
+	instances := newTestInstances(5, 1, 1)
+
+	// Smooth weighted round-robin interleaves the light instances instead of
+	// sending five requests in a row to the heavy one
+	var got []string
+	for i := 0; i < 7; i++ {
+		got = append(got, lb.Select(instances, nil).BaseURL[len("http://instance-"):])
+	}
+	if want := []string{"0", "0", "1", "0", "2", "0", "0"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("sequence = %v, want %v", got, want)
+	}
+}
+
+func TestConsistentHashIsStable(t *testing.T) {
+	lb, _ := NewLoadBalancer(StrategyConsistentHash, "X-User-ID")
+	instances := newTestInstances(1, 1, 1, 1)
+
+	assigned := make(map[string]*ServiceInstance)
+	spread := make(map[*ServiceInstance]bool)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		headers := http.Header{"X-User-Id": {key}}
+
+		assigned[key] = lb.Select(instances, headers)
+		spread[assigned[key]] = true
+		if again := lb.Select(instances, headers); again != assigned[key] {
+			t.Fatalf("key %s moved from %s to %s", key, assigned[key].BaseURL, again.BaseURL)
+		}
+	}
+	if len(spread) != len(instances) {
+		t.Errorf("100 keys used %d of %d instances", len(spread), len(instances))
+	}
+
+	// Removing an instance only moves the keys that were assigned to it
+	removed := instances[1]
+	remaining := []*ServiceInstance{instances[0], instances[2], instances[3]}
+	for key, before := range assigned {
+		after := lb.Select(remaining, http.Header{"X-User-Id": {key}})
+		if before != removed && after != before {
+			t.Errorf("key %s moved from %s to %s although its instance remained", key, before.BaseURL, after.BaseURL)
+		}
+	}
+}
+
+func TestSelectInstance(t *testing.T) {
+	// openBreaker returns a breaker that rejects requests
+	openBreaker := func() *CircuitBreaker {
+		cb := NewCircuitBreaker("test", config.CircuitBreakerConfig{FailureThreshold: 1}, metrics.NewCollector(prometheus.NewRegistry()), zap.NewNop())
+		done, _ := cb.Allow()
+		done(false)
+		return cb
+	}
+
+	tests := []struct {
+		name    string
+		setup   func(instances []*ServiceInstance)
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "all instances available",
+			want: []string{"http://instance-0", "http://instance-1", "http://instance-2"},
+		},
+		{
+			name: "unhealthy instances are skipped",
+			setup: func(instances []*ServiceInstance) {
+				instances[0].IsHealthy = false
+				instances[2].IsHealthy = false
+			},
+			want: []string{"http://instance-1"},
+		},
+		{
+			name: "instances with an open circuit are skipped",
+			setup: func(instances []*ServiceInstance) {
+				instances[1].breaker = openBreaker()
+			},
+			want: []string{"http://instance-0", "http://instance-2"},
+		},
+		{
+			name: "healthy instances are used when every circuit is open",
+			setup: func(instances []*ServiceInstance) {
+				instances[0].IsHealthy = false
+				instances[1].breaker = openBreaker()
+				instances[2].breaker = openBreaker()
+			},
+			want: []string{"http://instance-1", "http://instance-2"},
+		},
+		{
+			name: "no healthy instances",
+			setup: func(instances []*ServiceInstance) {
+				for _, instance := range instances {
+					instance.IsHealthy = false
+				}
+			},
+			wantErr: ErrNoHealthyInstances,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewServiceRegistry(nil, metrics.NewCollector(prometheus.NewRegistry()), zap.NewNop())
+			instances := newTestInstances(1, 1, 1)
+			for _, instance := range instances {
+				if err := registry.RegisterService("test-service", instance); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.setup != nil {
+				tt.setup(instances)
+			}
+
+			selected := make(map[string]bool)
+			for i := 0; i < 6; i++ {
+				instance, err := registry.SelectInstance("test-service", nil)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("SelectInstance error = %v, want %v", err, tt.wantErr)
+				}
+				if err == nil {
+					selected[instance.BaseURL] = true
+				}
+			}
+
+			want := make(map[string]bool)
+			for _, url := range tt.want {
+				want[url] = true
+			}
+			if fmt.Sprint(selected) != fmt.Sprint(want) {
+				t.Errorf("selected %v, want %v", selected, want)
+			}
+		})
+	}
+}
+
+func TestSelectInstanceUnknownService(t *testing.T) {
+	registry := NewServiceRegistry(nil, metrics.NewCollector(prometheus.NewRegistry()), zap.NewNop())
+	if _, err := registry.SelectInstance("missing", nil); !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("SelectInstance error = %v, want %v", err, ErrServiceNotFound)
+	}
+}
@@ -0,0 +1,19 @@
+// services/redis.go
+
+package services
+
+import (
+	"fmt"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// NewRedisClient creates a Redis client from the application configuration
+func NewRedisClient(cfg *config.RedisConfig) *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:     fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+}
@@ -3,113 +3,259 @@
 package services
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/metrics"
 	"go.uber.org/zap"
 )
 
+// Registry lookup errors
+var (
+	ErrServiceNotFound    = errors.New("service not found")
+	ErrNoHealthyInstances = errors.New("no healthy instances available")
+)
+
 // ServiceInstance represents a registered service instance
 type ServiceInstance struct {
 	Name         string
 	BaseURL      string
 	HealthURL    string
+	Weight       int
 	IsHealthy    bool
 	LastChecked  time.Time
 	ResponseTime time.Duration
 	ErrorCount   int64
 	SuccessCount int64
+
+	breaker   *CircuitBreaker
+	transport *http.Transport
+	inFlight  atomic.Int64
+	latency   latencyWindow
+}
+
+// Breaker returns the circuit breaker guarding the instance, nil if none
+func (si *ServiceInstance) Breaker() *CircuitBreaker {
+	return si.breaker
+}
+
+// Transport returns the transport requests to the instance are sent over
+func (si *ServiceInstance) Transport() *http.Transport {
+	if si.transport == nil {
+		return defaultTransport
+	}
+	return si.transport
+}
+
+// Client returns a client sending requests over the instance's transport
+func (si *ServiceInstance) Client() *http.Client {
+	return &http.Client{Transport: si.Transport()}
+}
+
+// Acquire marks the start of a request sent to the instance
+func (si *ServiceInstance) Acquire() {
+	si.inFlight.Add(1)
+}
+
+// Release marks the end of a request sent to the instance
+func (si *ServiceInstance) Release() {
+	si.inFlight.Add(-1)
+}
+
+// InFlight returns the number of requests currently sent to the instance
+func (si *ServiceInstance) InFlight() int64 {
+	return si.inFlight.Load()
+}
+
+// ObserveLatency records how long the instance took to answer a request
+func (si *ServiceInstance) ObserveLatency(d time.Duration) {
+	si.latency.observe(d)
+}
+
+// Latency returns the latency percentiles of recent requests to the instance
+func (si *ServiceInstance) Latency() LatencyPercentiles {
+	return si.latency.percentiles()
+}
+
+// weight returns the effective load balancing weight of the instance
+func (si *ServiceInstance) weight() int {
+	if si.Weight <= 0 {
+		return 1
+	}
+	return si.Weight
 }
 
 // ServiceRegistry manages service registration and discovery
 type ServiceRegistry struct {
-	services map[string]*ServiceInstance
-	logger   *zap.Logger
-	mu       sync.RWMutex
+	services  map[string][]*ServiceInstance
+	balancers map[string]LoadBalancer
+	collector *metrics.Collector
+	logger    *zap.Logger
+	mu        sync.RWMutex
 }
 
 // NewServiceRegistry creates a new service registry
-func NewServiceRegistry(config *config.ServicesConfig, logger *zap.Logger) *ServiceRegistry {
+func NewServiceRegistry(config *config.ServicesConfig, collector *metrics.Collector, logger *zap.Logger) *ServiceRegistry {
 	return &ServiceRegistry{
-		services: make(map[string]*ServiceInstance),
-		logger:   logger,
+		services:  make(map[string][]*ServiceInstance),
+		balancers: make(map[string]LoadBalancer),
+		collector: collector,
+		logger:    logger,
 	}
 }
 
-// RegisterService registers a new service instance
+// RegisterService adds an instance to the pool of a service
 func (sr *ServiceRegistry) RegisterService(name string, instance *ServiceInstance) error {
 	sr.mu.Lock()
 	defer sr.mu.Unlock()
 
-	if _, exists := sr.services[name]; exists {
-		return fmt.Errorf("service %s already registered", name)
+	for _, existing := range sr.services[name] {
+		if existing.BaseURL == instance.BaseURL {
+			return fmt.Errorf("instance %s of service %s already registered", instance.BaseURL, name)
+		}
+	}
+
+	sr.services[name] = append(sr.services[name], instance)
+	if _, ok := sr.balancers[name]; !ok {
+		sr.balancers[name] = &roundRobinBalancer{}
 	}
 
-	sr.services[name] = instance
-	sr.logger.Info("service registered",
+	sr.logger.Info("service instance registered",
 		zap.String("name", name),
 		zap.String("url", instance.BaseURL),
+		zap.Int("instances", len(sr.services[name])),
 	)
 
 	return nil
 }
 
-// GetService retrieves a service instance by name
-func (sr *ServiceRegistry) GetService(name string) (*ServiceInstance, error) {
+// replaceServices atomically replaces every registered service with pools,
+// balanced by the load balancer of the same name
+func (sr *ServiceRegistry) replaceServices(pools map[string][]*ServiceInstance, balancers map[string]LoadBalancer) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	sr.services = pools
+	sr.balancers = balancers
+}
+
+// SetLoadBalancer sets the load balancer used to select instances of a service
+func (sr *ServiceRegistry) SetLoadBalancer(name string, lb LoadBalancer) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	sr.balancers[name] = lb
+}
+
+// GetService retrieves all instances of a service by name
+func (sr *ServiceRegistry) GetService(name string) ([]*ServiceInstance, error) {
 	sr.mu.RLock()
 	defer sr.mu.RUnlock()
 
-	service, exists := sr.services[name]
+	instances, exists := sr.services[name]
 	if !exists {
-		return nil, fmt.Errorf("service %s not found", name)
+		return nil, fmt.Errorf("service %s: %w", name, ErrServiceNotFound)
+	}
+
+	return append([]*ServiceInstance(nil), instances...), nil
+}
+
+// SelectInstance picks a healthy instance of a service using its load balancer
+func (sr *ServiceRegistry) SelectInstance(name string, headers http.Header) (*ServiceInstance, error) {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
+	instances, exists := sr.services[name]
+	if !exists {
+		return nil, fmt.Errorf("service %s: %w", name, ErrServiceNotFound)
+	}
+
+	healthy := make([]*ServiceInstance, 0, len(instances))
+	for _, instance := range instances {
+		if instance.IsHealthy {
+			healthy = append(healthy, instance)
+		}
+	}
+
+	if len(healthy) == 0 {
+		return nil, fmt.Errorf("service %s: %w", name, ErrNoHealthyInstances)
+	}
+
+	// Prefer instances whose circuit is not open; when every circuit is open
+	// the caller's breaker check reports when to retry
+	available := make([]*ServiceInstance, 0, len(healthy))
+	for _, instance := range healthy {
+		if !instance.breaker.IsOpen() {
+			available = append(available, instance)
+		}
+	}
+	if len(available) == 0 {
+		available = healthy
 	}
 
-	return service, nil
+	return sr.balancers[name].Select(available, headers), nil
 }
 
-// UpdateServiceHealth updates the health status of a service
-func (sr *ServiceRegistry) UpdateServiceHealth(name string, isHealthy bool, responseTime time.Duration) {
+// UpdateServiceHealth updates the health status of a service instance
+func (sr *ServiceRegistry) UpdateServiceHealth(instance *ServiceInstance, isHealthy bool, responseTime time.Duration) {
 	sr.mu.Lock()
 	defer sr.mu.Unlock()
 
-	if service, exists := sr.services[name]; exists {
-		service.IsHealthy = isHealthy
-		service.LastChecked = time.Now()
-		service.ResponseTime = responseTime
+	instance.IsHealthy = isHealthy
+	instance.LastChecked = time.Now()
+	instance.ResponseTime = responseTime
+	sr.collector.SetServiceHealth(instance.Name, instance.BaseURL, isHealthy)
 
-		if isHealthy {
-			service.SuccessCount++
-		} else {
-			service.ErrorCount++
-		}
+	if isHealthy {
+		instance.SuccessCount++
+	} else {
+		instance.ErrorCount++
+	}
+}
+
+// ServiceNames returns the names of all registered services, sorted
+func (sr *ServiceRegistry) ServiceNames() []string {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
+	names := make([]string, 0, len(sr.services))
+	for name := range sr.services {
+		names = append(names, name)
 	}
+	slices.Sort(names)
+	return names
 }
 
-// ListServices returns all registered services
+// ListServices returns all registered service instances
 func (sr *ServiceRegistry) ListServices() []*ServiceInstance {
 	sr.mu.RLock()
 	defer sr.mu.RUnlock()
 
 	services := make([]*ServiceInstance, 0, len(sr.services))
-	for _, service := range sr.services {
-		services = append(services, service)
+	for _, instances := range sr.services {
+		services = append(services, instances...)
 	}
 
 	return services
 }
 
-// DeregisterService removes a service from the registry
+// DeregisterService removes a service and all its instances from the registry
 func (sr *ServiceRegistry) DeregisterService(name string) error {
 	sr.mu.Lock()
 	defer sr.mu.Unlock()
 
 	if _, exists := sr.services[name]; !exists {
-		return fmt.Errorf("service %s not found", name)
+		return fmt.Errorf("service %s: %w", name, ErrServiceNotFound)
 	}
 
 	delete(sr.services, name)
+	delete(sr.balancers, name)
 	sr.logger.Info("service deregistered", zap.String("name", name))
 
 	return nil
@@ -0,0 +1,239 @@
+// services/retry.go
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.uber.org/zap"
+)
+
+// DeadlineHeader tells backends how many milliseconds remain before the
+// gateway stops waiting for their response
+const DeadlineHeader = "X-Request-Timeout-Ms"
+
+// ErrorCodeServiceTimeout is the error code of 504 responses
+const ErrorCodeServiceTimeout = "service_timeout"
+
+// Retry defaults, applied to services that do not set them
+const (
+	defaultServiceTimeout = 5 * time.Second
+	defaultRetryBackoff   = 100 * time.Millisecond
+)
+
+// maxDrainBytes bounds how much of a discarded response is read to keep its
+// connection reusable
+const maxDrainBytes = 64 << 10
+
+// errAttemptTimeout cancels an attempt that exceeded its timeout
+var errAttemptTimeout = errors.New("attempt timed out")
+
+// TimeoutError is returned when a service does not respond before the
+// request's deadline
+type TimeoutError struct {
+	Service string
+	Timeout time.Duration
+}
+
+// Error describes the timeout
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("service %s did not respond within %s", e.Service, e.Timeout)
+}
+
+// RetryPolicy holds the timeouts and retries of requests to a service. The
+// timeouts bound the wait for the response headers, response bodies are
+// streamed without a deadline.
+type RetryPolicy struct {
+	Timeout        time.Duration // Overall deadline across all attempts
+	AttemptTimeout time.Duration // Deadline of a single attempt, the remaining overall time when 0
+	RetryCount     int           // Retries after failed attempts while time remains
+	Backoff        time.Duration // Delay before the first retry, doubled for each further retry
+}
+
+// NewRetryPolicy creates the retry policy of a service from its configuration
+func NewRetryPolicy(cfg config.ServiceConfig) RetryPolicy {
+	policy := RetryPolicy{
+		Timeout:        time.Duration(cfg.Timeout) * time.Second,
+		AttemptTimeout: time.Duration(cfg.AttemptTimeoutMs) * time.Millisecond,
+		RetryCount:     cfg.RetryCount,
+		Backoff:        time.Duration(cfg.RetryBackoffMs) * time.Millisecond,
+	}
+	if policy.Timeout <= 0 {
+		policy.Timeout = defaultServiceTimeout
+	}
+	if policy.Backoff <= 0 {
+		policy.Backoff = defaultRetryBackoff
+	}
+	return policy
+}
+
+// Send sends req to instance, retrying failed attempts within the policy's
+// deadline or the request context's, whichever comes first. Attempts fail
+// when the backend cannot be reached or answers 502, 503 or 504; the last
+// such response is returned when no retry is left. Every attempt passes the
+// instance's circuit breaker and tells the backend its remaining time in
+// DeadlineHeader. Only idempotent requests are retried, and only while their
+// body can be replayed. A *TimeoutError is returned once the deadline
+// expires.
+func (p RetryPolicy) Send(req *http.Request, instance *ServiceInstance, logger *zap.Logger) (*http.Response, error) {
+	start := time.Now()
+	deadline := start.Add(p.Timeout)
+	if d, ok := req.Context().Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	timeoutErr := &TimeoutError{Service: instance.Name, Timeout: deadline.Sub(start).Round(time.Millisecond)}
+
+	client := instance.Client()
+	retries := p.RetryCount
+	if !isIdempotent(req) {
+		retries = 0
+	}
+
+	var lastErr error
+	for i := 0; i <= retries; i++ {
+		// Rewind the body for retries, streamed bodies cannot be replayed
+		if i > 0 {
+			if req.GetBody == nil {
+				logger.Warn("request body is streamed, not retrying")
+				break
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to rewind request body: %w", err)
+			}
+			req.Body = body
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, timeoutErr
+		}
+		timeout := remaining
+		if p.AttemptTimeout > 0 && p.AttemptTimeout < remaining {
+			timeout = p.AttemptTimeout
+		}
+
+		done, err := instance.Breaker().Allow()
+		if err != nil {
+			return nil, err
+		}
+
+		response, err := p.attempt(client, req, i, timeout)
+		done(err == nil && response.StatusCode < http.StatusInternalServerError)
+		if err == nil {
+			if i == retries || !isRetryableStatus(response.StatusCode) || req.GetBody == nil ||
+				time.Until(deadline) <= p.Backoff<<i {
+				return response, nil
+			}
+			// Discard the response to retry, keeping its connection reusable
+			io.Copy(io.Discard, io.LimitReader(response.Body, maxDrainBytes))
+			response.Body.Close()
+			err = fmt.Errorf("service responded with status %d", response.StatusCode)
+		}
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			if errors.Is(ctxErr, context.DeadlineExceeded) {
+				return nil, timeoutErr
+			}
+			// The caller gave up, there is nobody to retry for
+			return nil, err
+		}
+
+		lastErr = err
+		if i == retries {
+			break
+		}
+
+		// Wait before retry, unless the deadline passes in the meantime
+		backoff := p.Backoff << i
+		if time.Until(deadline) <= backoff {
+			break
+		}
+		logger.Warn("request failed, retrying",
+			zap.String("service", instance.Name),
+			zap.Int("attempt", i+1),
+			zap.Duration("backoff", backoff),
+			zap.Error(err),
+		)
+		select {
+		case <-time.After(backoff):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	if errors.Is(lastErr, errAttemptTimeout) || !time.Now().Before(deadline) {
+		return nil, timeoutErr
+	}
+	return nil, fmt.Errorf("all retry attempts failed: %w", lastErr)
+}
+
+// attempt sends req once, giving up on the response headers after timeout.
+// The response body stays readable until it is closed.
+func (p RetryPolicy) attempt(client *http.Client, req *http.Request, n int, timeout time.Duration) (*http.Response, error) {
+	ctx, cancel := context.WithCancelCause(req.Context())
+	timer := time.AfterFunc(timeout, func() { cancel(errAttemptTimeout) })
+
+	attempt := req.WithContext(ctx)
+	attempt.Header.Set(DeadlineHeader, strconv.FormatInt(timeout.Milliseconds(), 10))
+	attempt, span := tracing.StartClient(attempt, fmt.Sprintf("%s attempt %d", req.Method, n+1),
+		semconv.HTTPRequestResendCount(n),
+	)
+	defer span.End()
+
+	response, err := client.Do(attempt)
+	if !timer.Stop() && err == nil {
+		// The timeout fired just as the headers arrived and cut off the body
+		response.Body.Close()
+		err = errAttemptTimeout
+	}
+	if err != nil && context.Cause(ctx) == errAttemptTimeout {
+		err = fmt.Errorf("%w after %s", errAttemptTimeout, timeout)
+	}
+	tracing.RecordResponse(span, response, err)
+	if err != nil {
+		cancel(nil)
+		return nil, err
+	}
+
+	response.Body = &cancelOnClose{ReadCloser: response.Body, cancel: cancel}
+	return response, nil
+}
+
+// cancelOnClose releases the context of an attempt once its response body
+// is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelCauseFunc
+}
+
+// Close closes the body and cancels the attempt's context
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel(nil)
+	return err
+}
+
+// isRetryableStatus reports whether a response signals a failure of the
+// backend or a proxy in front of it that another attempt may not hit
+func isRetryableStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+// isIdempotent reports whether req may be sent more than once: idempotent
+// methods and requests carrying an Idempotency-Key
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
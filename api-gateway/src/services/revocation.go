@@ -0,0 +1,216 @@
+// services/revocation.go
+
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/pkg/cache"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// ErrRevocationDisabled is returned when revoking without a revocation store
+var ErrRevocationDisabled = errors.New("token revocation is disabled")
+
+// defaultMaxTokenLifetime matches the access tokens of the authentication service
+const defaultMaxTokenLifetime = 24 * time.Hour
+
+// Redis key prefixes of the denylist
+const (
+	revokedTokenKeyPrefix = "revoked:jti:"
+	revokedUserKeyPrefix  = "revoked:user:"
+)
+
+// tokenHashPrefix marks the IDs of tokens issued without a jti
+const tokenHashPrefix = "sha256:"
+
+// TokenID returns the ID a token is denylisted under: its jti, or a hash of
+// the raw token for issuers that do not set one, like the authentication
+// service
+func TokenID(jti, rawToken string) string {
+	if jti != "" {
+		return jti
+	}
+	sum := sha256.Sum256([]byte(rawToken))
+	return tokenHashPrefix + hex.EncodeToString(sum[:])
+}
+
+// raiseWatermarkScript stores a user's revocation watermark unless a later
+// one is already set
+var raiseWatermarkScript = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[1]))
+if current == nil or current < tonumber(ARGV[1]) then
+	redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[2])
+end
+return 1
+`)
+
+// RevocationStore is a denylist of access tokens shared by all gateway
+// instances through Redis. Tokens are revoked individually by TokenID, or for a
+// whole user through a watermark invalidating every token issued up to it.
+// Lookups go through a local LRU cache; negative answers are only trusted
+// for a short time so revocations made elsewhere are picked up quickly.
+type RevocationStore struct {
+	client        redis.Cmdable
+	logger        *zap.Logger
+	cacheTTL      time.Duration
+	tokenLifetime time.Duration
+
+	tokens *cache.LRU[string, bool]
+	users  *cache.LRU[string, int64]
+}
+
+// NewRevocationStore creates a revocation store backed by client
+func NewRevocationStore(client redis.Cmdable, cfg *config.AuthConfig, logger *zap.Logger) *RevocationStore {
+	// Revocations must outlive every token they apply to, which the gateway's
+	// own token expiry says nothing about
+	lifetime := time.Duration(cfg.Revocation.MaxTokenLifetimeSecs) * time.Second
+	if lifetime <= 0 {
+		lifetime = defaultMaxTokenLifetime
+	}
+
+	return &RevocationStore{
+		client:        client,
+		logger:        logger,
+		cacheTTL:      time.Duration(cfg.Revocation.CacheTTLSecs) * time.Second,
+		tokenLifetime: lifetime + time.Duration(cfg.LeewaySecs)*time.Second,
+		tokens:        cache.NewLRU[string, bool](cfg.Revocation.CacheSize),
+		users:         cache.NewLRU[string, int64](cfg.Revocation.CacheSize),
+	}
+}
+
+// RevokeToken denylists a TokenID until the token expires. A zero
+// expiresAt keeps the entry for the maximum token lifetime.
+func (s *RevocationStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	if s == nil {
+		return ErrRevocationDisabled
+	}
+
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(s.tokenLifetime)
+	}
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		// Already expired, nothing to revoke
+		return nil
+	}
+
+	if err := s.client.Set(ctx, revokedTokenKeyPrefix+jti, 1, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	s.tokens.Add(jti, true, ttl)
+
+	s.logger.Info("token revoked", zap.String("jti", jti), zap.Time("expires_at", expiresAt))
+	return nil
+}
+
+// RevokeUserTokens invalidates all tokens of a user issued at or before the
+// given time. Issue times have whole-second precision, so tokens issued later
+// within the same second are invalidated as well.
+func (s *RevocationStore) RevokeUserTokens(ctx context.Context, userID string, before time.Time) error {
+	if s == nil {
+		return ErrRevocationDisabled
+	}
+
+	// Tokens issued before the watermark have all expired after one lifetime
+	ttl := time.Until(before.Add(s.tokenLifetime))
+	if ttl <= 0 {
+		return nil
+	}
+
+	watermark := before.Unix()
+	key := revokedUserKeyPrefix + userID
+	if err := raiseWatermarkScript.Run(ctx, s.client, []string{key}, watermark, int64(ttl.Seconds())+1).Err(); err != nil {
+		return fmt.Errorf("failed to revoke user tokens: %w", err)
+	}
+	s.users.Remove(userID)
+
+	s.logger.Info("user tokens revoked", zap.String("user_id", userID), zap.Time("issued_before", before))
+	return nil
+}
+
+// IsRevoked reports whether the token with the given ID, issued to userID at
+// issuedAt, has been revoked. Tokens without an issue time are considered
+// revoked once their user has a watermark.
+func (s *RevocationStore) IsRevoked(ctx context.Context, jti, userID string, issuedAt time.Time) (bool, error) {
+	if s == nil {
+		return false, nil
+	}
+
+	revoked, tokenCached := false, jti == ""
+	if jti != "" {
+		revoked, tokenCached = s.tokens.Get(jti)
+	}
+	if revoked {
+		return true, nil
+	}
+
+	var watermark int64
+	userCached := userID == ""
+	if userID != "" {
+		watermark, userCached = s.users.Get(userID)
+	}
+
+	if !tokenCached || !userCached {
+		var tokenCmd, userCmd *redis.StringCmd
+		pipe := s.client.Pipeline()
+		if !tokenCached {
+			tokenCmd = pipe.Get(ctx, revokedTokenKeyPrefix+jti)
+		}
+		if !userCached {
+			userCmd = pipe.Get(ctx, revokedUserKeyPrefix+userID)
+		}
+		if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+			return false, fmt.Errorf("failed to read revocation list: %w", err)
+		}
+
+		if tokenCmd != nil {
+			if err := tokenCmd.Err(); err != nil && !errors.Is(err, redis.Nil) {
+				return false, fmt.Errorf("failed to read revoked token: %w", err)
+			}
+			revoked = tokenCmd.Err() == nil
+			s.cacheToken(jti, revoked)
+		}
+
+		if userCmd != nil {
+			value, err := userCmd.Result()
+			if err != nil && !errors.Is(err, redis.Nil) {
+				return false, fmt.Errorf("failed to read revoked user: %w", err)
+			}
+			if err == nil {
+				watermark, _ = strconv.ParseInt(value, 10, 64)
+			}
+			s.cacheUser(userID, watermark)
+		}
+	}
+
+	if revoked {
+		return true, nil
+	}
+	return watermark > 0 && issuedAt.Unix() <= watermark, nil
+}
+
+// cacheToken caches a token lookup. Revocations are permanent, so positive
+// answers are kept for a full token lifetime.
+func (s *RevocationStore) cacheToken(jti string, revoked bool) {
+	if revoked {
+		s.tokens.Add(jti, true, s.tokenLifetime)
+	} else if s.cacheTTL > 0 {
+		s.tokens.Add(jti, false, s.cacheTTL)
+	}
+}
+
+// cacheUser caches a user's watermark lookup
+func (s *RevocationStore) cacheUser(userID string, watermark int64) {
+	if s.cacheTTL > 0 {
+		s.users.Add(userID, watermark, s.cacheTTL)
+	}
+}
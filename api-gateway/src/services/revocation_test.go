@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// newTestRevocationStores creates two revocation stores sharing one Redis
+// stand-in, like two gateway instances
+func newTestRevocationStores(t *testing.T, cfg config.RevocationConfig) (*miniredis.Miniredis, *RevocationStore, *RevocationStore) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+
+	auth := &config.AuthConfig{LeewaySecs: 30, Revocation: cfg}
+	return mr, NewRevocationStore(client, auth, zap.NewNop()), NewRevocationStore(client, auth, zap.NewNop())
+}
+
+// isRevoked asks store whether a token is revoked, failing the test on errors
+func isRevoked(t *testing.T, store *RevocationStore, jti, userID string, issuedAt time.Time) bool {
+	t.Helper()
+
+	revoked, err := store.IsRevoked(context.Background(), jti, userID, issuedAt)
+	if err != nil {
+		t.Fatalf("IsRevoked: %v", err)
+	}
+	return revoked
+}
+
+func TestRevokeToken(t *testing.T) {
+	mr, store, other := newTestRevocationStores(t, config.RevocationConfig{})
+	ctx := context.Background()
+	now := time.Now()
+
+	if err := store.RevokeToken(ctx, "token-1", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if !isRevoked(t, store, "token-1", "42", now) || !isRevoked(t, other, "token-1", "42", now) {
+		t.Error("revoked token accepted")
+	}
+	if isRevoked(t, other, "token-2", "42", now) {
+		t.Error("other token of the same user rejected")
+	}
+
+	// The entry lives as long as the token itself
+	if ttl := mr.TTL(revokedTokenKeyPrefix + "token-1"); ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Errorf("denylist TTL = %s, want the remaining token lifetime of 1h", ttl)
+	}
+
+	// Expired tokens are rejected anyway and are not stored
+	if err := store.RevokeToken(ctx, "expired", now.Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(revokedTokenKeyPrefix + "expired") {
+		t.Error("expired token was denylisted")
+	}
+}
+
+func TestRevokeTokenWithoutExpiry(t *testing.T) {
+	mr, store, _ := newTestRevocationStores(t, config.RevocationConfig{MaxTokenLifetimeSecs: 86400})
+
+	if err := store.RevokeToken(context.Background(), "token-1", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without an expiry the entry outlives any token the issuer signs
+	want := 24*time.Hour + 30*time.Second
+	if ttl := mr.TTL(revokedTokenKeyPrefix + "token-1"); ttl < want-time.Second || ttl > want {
+		t.Errorf("denylist TTL = %s, want %s", ttl, want)
+	}
+}
+
+func TestRevokeUserTokens(t *testing.T) {
+	mr, store, other := newTestRevocationStores(t, config.RevocationConfig{})
+	ctx := context.Background()
+	watermark := time.Unix(time.Now().Unix(), 0)
+
+	if err := store.RevokeUserTokens(ctx, "42", watermark.Add(500*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		userID   string
+		issuedAt time.Time
+		want     bool
+	}{
+		{name: "issued before", userID: "42", issuedAt: watermark.Add(-time.Second), want: true},
+		{name: "issued in the same second", userID: "42", issuedAt: watermark.Add(900 * time.Millisecond), want: true},
+		{name: "issued after", userID: "42", issuedAt: watermark.Add(time.Second)},
+		{name: "without issue time", userID: "42", want: true},
+		{name: "other user", userID: "43", issuedAt: watermark.Add(-time.Second)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRevoked(t, other, "", tt.userID, tt.issuedAt); got != tt.want {
+				t.Errorf("IsRevoked = %t, want %t", got, tt.want)
+			}
+		})
+	}
+
+	// The watermark is kept for the default maximum token lifetime of a day,
+	// longer than the gateway's own token expiry
+	if ttl := mr.TTL(revokedUserKeyPrefix + "42"); ttl < 24*time.Hour {
+		t.Errorf("watermark TTL = %s, want at least 24h", ttl)
+	}
+
+	// An earlier revocation does not lower the watermark
+	if err := store.RevokeUserTokens(ctx, "42", watermark.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if !isRevoked(t, other, "", "42", watermark.Add(-time.Second)) {
+		t.Error("watermark was lowered")
+	}
+}
+
+func TestRevocationCache(t *testing.T) {
+	mr, store, other := newTestRevocationStores(t, config.RevocationConfig{CacheTTLSecs: 5})
+	ctx := context.Background()
+	now := time.Now()
+	other.cacheTTL = 50 * time.Millisecond
+
+	// A negative answer is trusted locally until the cache TTL passes
+	if isRevoked(t, other, "token-1", "42", now) {
+		t.Fatal("token revoked before revocation")
+	}
+	if err := store.RevokeToken(ctx, "token-1", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if isRevoked(t, other, "token-1", "42", now) {
+		t.Error("cached negative answer not used")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if !isRevoked(t, other, "token-1", "42", now) {
+		t.Error("revocation not seen after the cache TTL")
+	}
+
+	// Positive answers are kept, even while Redis is unreachable
+	mr.Close()
+	if !isRevoked(t, other, "token-1", "42", now) {
+		t.Error("cached revocation lost")
+	}
+}
+
+func TestRevocationWithoutCache(t *testing.T) {
+	_, store, other := newTestRevocationStores(t, config.RevocationConfig{})
+	now := time.Now()
+
+	if isRevoked(t, other, "token-1", "42", now) {
+		t.Fatal("token revoked before revocation")
+	}
+	if err := store.RevokeToken(context.Background(), "token-1", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if !isRevoked(t, other, "token-1", "42", now) {
+		t.Error("revocation not seen immediately without a cache TTL")
+	}
+}
+
+func TestRevocationRedisUnavailable(t *testing.T) {
+	mr, store, _ := newTestRevocationStores(t, config.RevocationConfig{})
+	mr.Close()
+
+	// The caller decides whether to fail open or closed
+	if _, err := store.IsRevoked(context.Background(), "token-1", "42", time.Now()); err == nil {
+		t.Error("IsRevoked succeeded without Redis")
+	}
+	if err := store.RevokeToken(context.Background(), "token-1", time.Now().Add(time.Hour)); err == nil {
+		t.Error("RevokeToken succeeded without Redis")
+	}
+}
+
+func TestNilRevocationStore(t *testing.T) {
+	var store *RevocationStore
+
+	if revoked, err := store.IsRevoked(context.Background(), "token-1", "42", time.Now()); revoked || err != nil {
+		t.Errorf("IsRevoked = %t, %v, want false, nil", revoked, err)
+	}
+	if err := store.RevokeToken(context.Background(), "token-1", time.Time{}); !errors.Is(err, ErrRevocationDisabled) {
+		t.Errorf("RevokeToken error = %v, want %v", err, ErrRevocationDisabled)
+	}
+	if err := store.RevokeUserTokens(context.Background(), "42", time.Now()); !errors.Is(err, ErrRevocationDisabled) {
+		t.Errorf("RevokeUserTokens error = %v, want %v", err, ErrRevocationDisabled)
+	}
+}
@@ -0,0 +1,199 @@
+// services/stream.go
+
+package services
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Streaming defaults applied to zero config values
+const (
+	defaultRetryBufferBytes = 64 << 10
+	defaultETagBufferBytes  = 1 << 20
+	defaultFlushInterval    = 100 * time.Millisecond
+)
+
+// RetryBufferBytes returns the configured replay buffer size or the default
+func RetryBufferBytes(limit int64) int64 {
+	if limit <= 0 {
+		return defaultRetryBufferBytes
+	}
+	return limit
+}
+
+// ETagBufferBytes returns the configured response buffer size or the default
+func ETagBufferBytes(limit int64) int64 {
+	if limit <= 0 {
+		return defaultETagBufferBytes
+	}
+	return limit
+}
+
+// FlushInterval returns the configured flush interval or the default.
+// A negative value flushes after every write.
+func FlushInterval(ms int) time.Duration {
+	if ms == 0 {
+		return defaultFlushInterval
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// PrepareBody prepares a request body for forwarding. Bodies of at most limit
+// bytes are buffered and can be replayed through the returned getBody; larger
+// bodies are streamed as they arrive and getBody is nil.
+func PrepareBody(body io.ReadCloser, contentLength, limit int64) (io.ReadCloser, func() (io.ReadCloser, error), error) {
+	if body == nil || body == http.NoBody {
+		return http.NoBody, func() (io.ReadCloser, error) { return http.NoBody, nil }, nil
+	}
+
+	// Known to be too large, stream without touching it
+	if contentLength > limit {
+		return body, nil, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Unknown length turned out too large, stream the buffered prefix and the rest
+	if int64(len(data)) > limit {
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), body), body}, nil, nil
+	}
+
+	body.Close()
+	getBody := func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	buffered, _ := getBody()
+	return buffered, getBody, nil
+}
+
+// BufferResponse reads a backend response body of known length up to limit
+// bytes. Streaming and larger responses are left untouched and reported as
+// not buffered.
+func BufferResponse(resp *http.Response, limit int64) ([]byte, bool, error) {
+	if isStreamingResponse(resp) || resp.ContentLength > limit {
+		return nil, false, nil
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// StreamResponse copies a backend response body to the client as it arrives.
+// Event streams and responses of unknown length are flushed after every
+// write, other responses at most every flushInterval. The caller writes the
+// status line and headers beforehand.
+func StreamResponse(w http.ResponseWriter, resp *http.Response, flushInterval time.Duration) error {
+	if isStreamingResponse(resp) {
+		flushInterval = -1
+	}
+
+	dst := newFlushWriter(w, flushInterval)
+	defer dst.stop()
+
+	buf := make([]byte, 32<<10)
+	if _, err := io.CopyBuffer(dst, resp.Body, buf); err != nil {
+		return err
+	}
+
+	// Forward trailers announced by the backend
+	for key, values := range resp.Trailer {
+		for _, value := range values {
+			w.Header().Add(http.TrailerPrefix+key, value)
+		}
+	}
+
+	return nil
+}
+
+// isStreamingResponse reports whether a response must be flushed immediately
+func isStreamingResponse(resp *http.Response) bool {
+	if resp.ContentLength == -1 {
+		return true
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType == "text/event-stream"
+}
+
+// flushWriter flushes writes to the client after at most a fixed latency
+type flushWriter struct {
+	w       io.Writer
+	rc      *http.ResponseController
+	latency time.Duration
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	pending bool
+}
+
+// newFlushWriter creates a writer flushing after latency, or after every
+// write when latency is negative
+func newFlushWriter(w http.ResponseWriter, latency time.Duration) *flushWriter {
+	return &flushWriter{
+		w:       w,
+		rc:      http.NewResponseController(w),
+		latency: latency,
+	}
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	n, err := fw.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	if fw.latency < 0 {
+		fw.rc.Flush()
+		return n, nil
+	}
+
+	if !fw.pending {
+		fw.pending = true
+		if fw.timer == nil {
+			fw.timer = time.AfterFunc(fw.latency, fw.delayedFlush)
+		} else {
+			fw.timer.Reset(fw.latency)
+		}
+	}
+	return n, nil
+}
+
+func (fw *flushWriter) delayedFlush() {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	// Skip if stopped or already flushed
+	if !fw.pending {
+		return
+	}
+	fw.rc.Flush()
+	fw.pending = false
+}
+
+// stop cancels any scheduled flush
+func (fw *flushWriter) stop() {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	fw.pending = false
+	if fw.timer != nil {
+		fw.timer.Stop()
+	}
+}
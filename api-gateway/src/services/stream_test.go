@@ -0,0 +1,259 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// trackingBody is a request body that remembers whether it was closed
+type trackingBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *trackingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+// readAll reads body to the end, failing the test on errors
+func readAll(t *testing.T, body io.Reader) string {
+	t.Helper()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestPrepareBody(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		wantBuffered  bool
+	}{
+		{name: "small body", body: "hello", contentLength: 5, wantBuffered: true},
+		{name: "body at the limit", body: "0123456789", contentLength: 10, wantBuffered: true},
+		{name: "small body of unknown length", body: "hello", contentLength: -1, wantBuffered: true},
+		{name: "large body", body: "0123456789abcdef", contentLength: 16},
+		{name: "large body of unknown length", body: "0123456789abcdef", contentLength: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := &trackingBody{Reader: strings.NewReader(tt.body)}
+			body, getBody, err := PrepareBody(original, tt.contentLength, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := readAll(t, body); got != tt.body {
+				t.Errorf("body = %q, want %q", got, tt.body)
+			}
+			if (getBody != nil) != tt.wantBuffered {
+				t.Fatalf("getBody set = %t, want %t", getBody != nil, tt.wantBuffered)
+			}
+			if !tt.wantBuffered {
+				if original.closed {
+					t.Error("streamed body was closed before forwarding")
+				}
+				return
+			}
+
+			if !original.closed {
+				t.Error("buffered body was not closed")
+			}
+			// Every replay starts from the beginning
+			for i := 0; i < 2; i++ {
+				replay, err := getBody()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := readAll(t, replay); got != tt.body {
+					t.Errorf("replay %d = %q, want %q", i+1, got, tt.body)
+				}
+			}
+		})
+	}
+}
+
+func TestPrepareEmptyBody(t *testing.T) {
+	for _, body := range []io.ReadCloser{nil, http.NoBody} {
+		prepared, getBody, err := PrepareBody(body, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prepared != http.NoBody || getBody == nil {
+			t.Errorf("PrepareBody(%v) = %v, getBody set %t, want a replayable empty body", body, prepared, getBody != nil)
+		}
+	}
+}
+
+func TestBufferResponse(t *testing.T) {
+	tests := []struct {
+		name          string
+		contentType   string
+		contentLength int64
+		wantBuffered  bool
+	}{
+		{name: "known length", contentType: "application/json", contentLength: 5, wantBuffered: true},
+		{name: "larger than the limit", contentType: "application/json", contentLength: 11},
+		{name: "unknown length", contentType: "application/json", contentLength: -1},
+		{name: "event stream", contentType: "text/event-stream; charset=utf-8", contentLength: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				Header:        http.Header{"Content-Type": {tt.contentType}},
+				ContentLength: tt.contentLength,
+				Body:          io.NopCloser(strings.NewReader("hello")),
+			}
+
+			data, buffered, err := BufferResponse(resp, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if buffered != tt.wantBuffered {
+				t.Fatalf("buffered = %t, want %t", buffered, tt.wantBuffered)
+			}
+			if buffered && string(data) != "hello" {
+				t.Errorf("data = %q, want hello", data)
+			}
+			if !buffered && readAll(t, resp.Body) != "hello" {
+				t.Error("unbuffered response body was consumed")
+			}
+		})
+	}
+}
+
+// flushRecorder counts the flushes of a response
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes atomic.Int32
+}
+
+func (r *flushRecorder) Flush() {
+	r.flushes.Add(1)
+}
+
+// chunkedBody returns its chunks one per read
+type chunkedBody struct {
+	chunks []string
+}
+
+func (b *chunkedBody) Read(p []byte) (int, error) {
+	if len(b.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, b.chunks[0])
+	b.chunks = b.chunks[1:]
+	return n, nil
+}
+
+func TestStreamResponseFlushing(t *testing.T) {
+	tests := []struct {
+		name          string
+		contentType   string
+		contentLength int64
+		wantFlushes   int32
+	}{
+		{name: "event stream flushes every write", contentType: "text/event-stream", contentLength: 6, wantFlushes: 3},
+		{name: "unknown length flushes every write", contentType: "application/json", contentLength: -1, wantFlushes: 3},
+		{name: "known length waits for the flush interval", contentType: "application/json", contentLength: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+			resp := &http.Response{
+				Header:        http.Header{"Content-Type": {tt.contentType}},
+				ContentLength: tt.contentLength,
+				Body:          io.NopCloser(&chunkedBody{chunks: []string{"ab", "cd", "ef"}}),
+			}
+
+			if err := StreamResponse(w, resp, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			if got := w.Body.String(); got != "abcdef" {
+				t.Errorf("body = %q, want abcdef", got)
+			}
+			if got := w.flushes.Load(); got != tt.wantFlushes {
+				t.Errorf("flushes = %d, want %d", got, tt.wantFlushes)
+			}
+		})
+	}
+}
+
+func TestStreamResponseFlushInterval(t *testing.T) {
+	w := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	body, pipe := io.Pipe()
+	resp := &http.Response{
+		Header:        http.Header{"Content-Type": {"application/octet-stream"}},
+		ContentLength: 4,
+		Body:          body,
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- StreamResponse(w, resp, 10*time.Millisecond) }()
+
+	// A write is flushed once the interval passes, even while the body is open
+	pipe.Write([]byte("ab"))
+	deadline := time.Now().Add(time.Second)
+	for w.flushes.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := w.flushes.Load(); got != 1 {
+		t.Fatalf("flushes = %d after the interval, want 1", got)
+	}
+
+	pipe.Write([]byte("cd"))
+	pipe.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := w.Body.String(); got != "abcd" {
+		t.Errorf("body = %q, want abcd", got)
+	}
+}
+
+func TestStreamResponseForwardsTrailers(t *testing.T) {
+	w := httptest.NewRecorder()
+	resp := &http.Response{
+		Header:        http.Header{},
+		ContentLength: 2,
+		Body:          io.NopCloser(strings.NewReader("ok")),
+		Trailer:       http.Header{"Checksum": {"abc"}},
+	}
+
+	if err := StreamResponse(w, resp, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.Header().Get(http.TrailerPrefix + "Checksum"); got != "abc" {
+		t.Errorf("trailer = %q, want abc", got)
+	}
+}
+
+func TestFlushInterval(t *testing.T) {
+	tests := []struct {
+		ms   int
+		want time.Duration
+	}{
+		{ms: 0, want: defaultFlushInterval},
+		{ms: 250, want: 250 * time.Millisecond},
+		{ms: -1, want: -time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		if got := FlushInterval(tt.ms); got != tt.want {
+			t.Errorf("FlushInterval(%d) = %s, want %s", tt.ms, got, tt.want)
+		}
+	}
+}
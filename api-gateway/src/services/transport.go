@@ -0,0 +1,75 @@
+// services/transport.go
+
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Mir00r/api-gateway/src/api-gateway/src/config"
+)
+
+// defaultTransport carries requests to services without TLS settings
+var defaultTransport = newTransport(nil)
+
+// newTransport creates a transport for requests to a service. It sets no
+// timeouts, requests are bounded by the service's RetryPolicy so streamed
+// responses are not cut off.
+func newTransport(tlsConfig *tls.Config) *http.Transport {
+	return &http.Transport{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 100,
+		IdleConnTimeout:     90 * time.Second,
+		DisableCompression:  true,
+		TLSClientConfig:     tlsConfig,
+	}
+}
+
+// newServiceTransport creates the transport of a service from its TLS
+// settings, the shared default transport when it has none
+func newServiceTransport(cfg config.ServiceTLSConfig) (*http.Transport, error) {
+	if cfg == (config.ServiceTLSConfig{}) {
+		return defaultTransport, nil
+	}
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newTransport(tlsConfig), nil
+}
+
+// newTLSConfig loads the CA bundle and client certificate of a service
+func newTLSConfig(cfg config.ServiceTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// StrongETag returns a strong entity tag derived from a response body
+func StrongETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:18]) + `"`
+}
+
+// IsNotModified determines if a GET or HEAD request can be answered with
+// 304 Not Modified, given the headers of the current representation.
+// If-Modified-Since is only evaluated without If-None-Match.
+func IsNotModified(r *http.Request, header http.Header) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if values := r.Header.Values("If-None-Match"); len(values) > 0 {
+		return ETagMatches(values, header.Get("ETag"), false)
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(header.Get("Last-Modified"))
+	return err == nil && !modified.After(since)
+}
+
+// ETagMatches determines if an entity tag is listed in If-Match or
+// If-None-Match header values. "*" matches any tag. Strong comparison, as
+// required by If-Match, never matches weak tags.
+func ETagMatches(values []string, etag string, strong bool) bool {
+	if etag == "" {
+		return false
+	}
+	if strong && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+
+	for _, value := range values {
+		for _, candidate := range strings.Split(value, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" {
+				return true
+			}
+			if strong {
+				if candidate == etag {
+					return true
+				}
+			} else if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -10,6 +11,7 @@ import (
 type ErrorResponse struct {
 	Status    int         `json:"status"`
 	Message   string      `json:"message"`
+	Code      string      `json:"code,omitempty"`
 	Error     string      `json:"error,omitempty"`
 	Details   interface{} `json:"details,omitempty"`
 	RequestID string      `json:"request_id,omitempty"`
@@ -20,7 +22,7 @@ func RespondWithError(c *gin.Context, status int, message string, opts ...ErrorO
 	response := ErrorResponse{
 		Status:    status,
 		Message:   message,
-		RequestID: c.GetString("RequestID"), // Assuming request ID middleware is in place
+		RequestID: c.GetString(RequestIDKey),
 	}
 
 	// Apply any optional configurations
@@ -43,6 +45,13 @@ func WithError(err error) ErrorOption {
 	}
 }
 
+// WithCode adds a machine-readable error code to the response
+func WithCode(code string) ErrorOption {
+	return func(r *ErrorResponse) {
+		r.Code = code
+	}
+}
+
 // WithDetails adds additional details to the response
 func WithDetails(details interface{}) ErrorOption {
 	return func(r *ErrorResponse) {
@@ -97,3 +106,33 @@ func IsHopByHopHeader(header string) bool {
 	}
 	return hopByHopHeaders[header]
 }
+
+// IsUpgradeRequest determines if a request asks for a protocol upgrade, e.g. WebSocket
+func IsUpgradeRequest(r *http.Request) bool {
+	return r.Header.Get("Upgrade") != "" && HeaderHasToken(r.Header, "Connection", "upgrade")
+}
+
+// RemoveQueryParam removes a query parameter from the request's URL and
+// request URI, e.g. to keep credentials out of forwarded URLs and logs
+func RemoveQueryParam(r *http.Request, name string) {
+	query := r.URL.Query()
+	if !query.Has(name) {
+		return
+	}
+
+	query.Del(name)
+	r.URL.RawQuery = query.Encode()
+	r.RequestURI = r.URL.RequestURI()
+}
+
+// HeaderHasToken determines if a comma-separated header contains a token, ignoring case
+func HeaderHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+)
+
+// Request ID propagation
+const (
+	RequestIDHeader = "X-Request-ID"
+	RequestIDKey    = "RequestID" // gin context key
+)
+
+// maxRequestIDLength bounds request IDs accepted from clients
+const maxRequestIDLength = 128
+
+// requestIDContextKey is the request context key holding the request ID
+type requestIDContextKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying a request ID
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, if any
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// NewRequestID generates a UUIDv7, which sorts by creation time
+func NewRequestID() string {
+	var uuid [16]byte
+	binary.BigEndian.PutUint64(uuid[:8], uint64(time.Now().UnixMilli())<<16)
+	if _, err := rand.Read(uuid[6:]); err != nil {
+		panic(err) // crypto/rand never fails on supported platforms
+	}
+	uuid[6] = uuid[6]&0x0f | 0x70 // Version 7
+	uuid[8] = uuid[8]&0x3f | 0x80 // RFC 4122 variant
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], uuid[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], uuid[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], uuid[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], uuid[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], uuid[10:])
+	return string(buf[:])
+}
+
+// IsValidRequestID reports whether a client-supplied request ID can be
+// propagated: non-empty, bounded and made of visible ASCII characters
+func IsValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}